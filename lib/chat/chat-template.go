@@ -0,0 +1,62 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Placeholders lists the placeholders that can be used in message templates
+var Placeholders []string = []string{
+	"player",         // name of the player (empty for server info requests)
+	"progress",       // load progress of the starting server
+	"eta",            // estimated time remaining until the server is online
+	"last_online",    // time since a player was last seen on the server
+	"uptime",         // time since the server is online
+	"version",        // minecraft server version
+	"hibernated_for", // time since the server is hibernating (stopped or suspended)
+	"error",          // description of the server major error
+}
+
+// placeholderRe matches a placeholder ("{name}")
+var placeholderRe *regexp.Regexp = regexp.MustCompile(`\{([A-Za-z_]+)\}`)
+
+// CheckTemplate returns an error if the message template contains unknown placeholders
+func CheckTemplate(tpl string) error {
+	for _, m := range placeholderRe.FindAllStringSubmatch(tpl, -1) {
+		if !isPlaceholder(m[1]) {
+			return fmt.Errorf("unknown placeholder %s (available: {%s})", m[0], strings.Join(Placeholders, "}, {"))
+		}
+	}
+	return nil
+}
+
+// Render returns the message template with placeholders replaced by their values.
+// If the template is a JSON text component, values are escaped as JSON string content.
+// Unknown placeholders are left as they are.
+func Render(tpl string, values map[string]string) string {
+	isJSON := json.Valid([]byte(strings.TrimSpace(tpl)))
+
+	return placeholderRe.ReplaceAllStringFunc(tpl, func(p string) string {
+		v, ok := values[p[1:len(p)-1]]
+		if !ok {
+			return p
+		}
+		if isJSON {
+			b, _ := json.Marshal(v)
+			return string(b[1 : len(b)-1])
+		}
+		return v
+	})
+}
+
+// isPlaceholder returns true if name is a known placeholder
+func isPlaceholder(name string) bool {
+	for _, p := range Placeholders {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
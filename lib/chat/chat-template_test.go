@@ -0,0 +1,38 @@
+package chat
+
+import (
+	"testing"
+)
+
+func Test_CheckTemplate(t *testing.T) {
+	tests := map[string]bool{
+		"Server start command issued. Please wait... {progress}":     true,
+		"{player}, you don't have permission to warm this server":    true,
+		`{"text":"hibernating for {hibernated_for}","color":"aqua"}`: true,
+		"no placeholders":         true,
+		"{Player} is not welcome": false,
+		"ready in {etaa}":         false,
+	}
+
+	for tpl, valid := range tests {
+		if err := CheckTemplate(tpl); (err == nil) != valid {
+			t.Errorf("template %q checked as valid %t (expected %t): %v", tpl, err == nil, valid, err)
+		}
+	}
+}
+
+func Test_Render(t *testing.T) {
+	values := map[string]string{"player": `Steve "the miner"`, "progress": "42%"}
+
+	tests := map[string]string{
+		"{player}: {progress}":           `Steve "the miner": 42%`,
+		"{progress} {unknown}":           "42% {unknown}",
+		`{"text":"{player} {progress}"}`: `{"text":"Steve \"the miner\" 42%"}`,
+	}
+
+	for tpl, expect := range tests {
+		if s := Render(tpl, values); s != expect {
+			t.Errorf("%q rendered as %q (expected %q)", tpl, s, expect)
+		}
+	}
+}
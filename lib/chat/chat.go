@@ -0,0 +1,421 @@
+package chat
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// reference:
+// - wiki.vg/Chat
+// - minecraft.wiki/w/Formatting_codes
+
+// Component is a minecraft JSON text component
+type Component struct {
+	Text          string       `json:"text,omitempty"`
+	Translate     string       `json:"translate,omitempty"`
+	With          []*Component `json:"with,omitempty"`
+	Color         string       `json:"color,omitempty"` // color name ("gold") or hex color ("#ffaa00")
+	Bold          *bool        `json:"bold,omitempty"`
+	Italic        *bool        `json:"italic,omitempty"`
+	Underlined    *bool        `json:"underlined,omitempty"`
+	Strikethrough *bool        `json:"strikethrough,omitempty"`
+	Obfuscated    *bool        `json:"obfuscated,omitempty"`
+	Font          string       `json:"font,omitempty"`
+	Insertion     string       `json:"insertion,omitempty"`
+	ClickEvent    *Event       `json:"clickEvent,omitempty"`
+	HoverEvent    *Event       `json:"hoverEvent,omitempty"`
+	Extra         []*Component `json:"extra,omitempty"`
+}
+
+// Event is a click or hover event of a text component (event values are relayed as they are)
+type Event struct {
+	Action   string          `json:"action"`
+	Value    json.RawMessage `json:"value,omitempty"`
+	Contents json.RawMessage `json:"contents,omitempty"`
+}
+
+// style contains the formatting of a text component (inherited by its children)
+type style struct {
+	color                                               string
+	bold, italic, underlined, strikethrough, obfuscated bool
+}
+
+// legacy color codes by color name
+var colorCodes map[string]byte = map[string]byte{
+	"black":        '0',
+	"dark_blue":    '1',
+	"dark_green":   '2',
+	"dark_aqua":    '3',
+	"dark_red":     '4',
+	"dark_purple":  '5',
+	"gold":         '6',
+	"gray":         '7',
+	"dark_gray":    '8',
+	"blue":         '9',
+	"green":        'a',
+	"aqua":         'b',
+	"red":          'c',
+	"light_purple": 'd',
+	"yellow":       'e',
+	"white":        'f',
+}
+
+// ansi color codes by color name
+var colorANSI map[string]string = map[string]string{
+	"black":        "30",
+	"dark_blue":    "34",
+	"dark_green":   "32",
+	"dark_aqua":    "36",
+	"dark_red":     "31",
+	"dark_purple":  "35",
+	"gold":         "33",
+	"gray":         "37",
+	"dark_gray":    "90",
+	"blue":         "94",
+	"green":        "92",
+	"aqua":         "96",
+	"red":          "91",
+	"light_purple": "95",
+	"yellow":       "93",
+	"white":        "97",
+}
+
+// Parse returns the text component described by message.
+// message can be a JSON text component (object, array or string) or a text with legacy formatting codes ("§" or "&").
+func Parse(message string) *Component {
+	trimmed := strings.TrimSpace(message)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") || strings.HasPrefix(trimmed, `"`) {
+		c := &Component{}
+		if err := json.Unmarshal([]byte(trimmed), c); err == nil {
+			return c
+		}
+	}
+
+	return FromLegacy(message)
+}
+
+// FromLegacy returns the text component of a text with legacy formatting codes.
+// Both "§" and "&" are accepted as formatting code prefix ("&" only if followed by a valid lower case code).
+// Hex colors are accepted in the "§x§r§r§g§g§b§b" format.
+func FromLegacy(s string) *Component {
+	return fromLegacy(s, true)
+}
+
+// fromLegacy returns the text component of a text with legacy formatting codes.
+// If amp is true, "&" is accepted as formatting code prefix.
+func fromLegacy(s string, amp bool) *Component {
+	root := &Component{}
+
+	var st style
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			root.Extra = append(root.Extra, st.component(text.String()))
+			text.Reset()
+		}
+	}
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		if (runes[i] != '§' && (runes[i] != '&' || !amp)) || i+1 >= len(runes) || !isCode(runes[i+1]) || (runes[i] == '&' && runes[i+1] != toLower(runes[i+1])) {
+			text.WriteRune(runes[i])
+			continue
+		}
+
+		code := toLower(runes[i+1])
+
+		// hex color: §x§r§r§g§g§b§b
+		if code == 'x' {
+			if hex, ok := legacyHex(runes[i:]); ok {
+				flush()
+				st = style{color: hex}
+				i += 13
+				continue
+			}
+		}
+
+		flush()
+		i++
+
+		switch code {
+		case 'k':
+			st.obfuscated = true
+		case 'l':
+			st.bold = true
+		case 'm':
+			st.strikethrough = true
+		case 'n':
+			st.underlined = true
+		case 'o':
+			st.italic = true
+		case 'r':
+			st = style{}
+		case 'x':
+			// invalid hex color: ignored
+		default:
+			// color codes reset formatting
+			st = style{color: colorName(byte(code))}
+		}
+	}
+	flush()
+
+	// simplify component with a single child
+	if len(root.Extra) == 1 {
+		return root.Extra[0]
+	}
+
+	return root
+}
+
+// UnmarshalJSON decodes a JSON text component in any of its forms (object, array or string)
+func (c *Component) UnmarshalJSON(data []byte) error {
+	data = []byte(strings.TrimSpace(string(data)))
+
+	switch {
+	case len(data) > 0 && data[0] == '"':
+		return json.Unmarshal(data, &c.Text)
+
+	case len(data) > 0 && data[0] == '[':
+		// the first element is the parent of the following ones
+		var list []*Component
+		if err := json.Unmarshal(data, &list); err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			return nil
+		}
+		*c = *list[0]
+		c.Extra = append(c.Extra, list[1:]...)
+		return nil
+
+	default:
+		// component type used to avoid recursion
+		type component Component
+		return json.Unmarshal(data, (*component)(c))
+	}
+}
+
+// MarshalJSON encodes the component as a JSON object.
+// The "text" field is included when the component has no other content (required by minecraft clients).
+func (c *Component) MarshalJSON() ([]byte, error) {
+	type component Component
+
+	if c.Text == "" && c.Translate == "" {
+		return json.Marshal(&struct {
+			Text string `json:"text"`
+			*component
+		}{"", (*component)(c)})
+	}
+
+	return json.Marshal((*component)(c))
+}
+
+// JSON returns the component encoded as JSON
+func (c *Component) JSON() string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return `{"text":""}`
+	}
+	return string(data)
+}
+
+// Legacy returns the component text with legacy formatting codes ("§")
+func (c *Component) Legacy() string {
+	var b strings.Builder
+	var last style
+
+	c.walk(style{}, func(text string, st style) {
+		if st != last {
+			b.WriteString(st.legacy())
+			last = st
+		}
+		b.WriteString(text)
+	})
+
+	return b.String()
+}
+
+// Plain returns the component text without formatting
+func (c *Component) Plain() string {
+	var b strings.Builder
+
+	c.walk(style{}, func(text string, _ style) {
+		b.WriteString(text)
+	})
+
+	return b.String()
+}
+
+// LegacyToANSI converts the legacy formatting codes ("§") of s to ANSI escape codes.
+// base is the ANSI escape code restored when formatting is reset.
+func LegacyToANSI(s, base string) string {
+	if !strings.Contains(s, "§") {
+		return s
+	}
+
+	var b strings.Builder
+	var last style
+
+	fromLegacy(s, false).walk(style{}, func(text string, st style) {
+		if st != last {
+			b.WriteString("\033[0m" + base + st.ansi())
+			last = st
+		}
+		b.WriteString(text)
+	})
+
+	if last != (style{}) {
+		b.WriteString("\033[0m" + base)
+	}
+
+	return b.String()
+}
+
+// walk calls f for each text of the component tree, in order, with its effective style
+func (c *Component) walk(parent style, f func(text string, st style)) {
+	st := parent
+	if c.Color != "" {
+		st.color = c.Color
+	}
+	setFormat(&st.bold, c.Bold)
+	setFormat(&st.italic, c.Italic)
+	setFormat(&st.underlined, c.Underlined)
+	setFormat(&st.strikethrough, c.Strikethrough)
+	setFormat(&st.obfuscated, c.Obfuscated)
+
+	switch {
+	case c.Text != "":
+		f(c.Text, st)
+	case c.Translate != "":
+		// translations are not available: show the translation key and its arguments
+		f(c.Translate, st)
+		for _, w := range c.With {
+			f(" ", st)
+			w.walk(st, f)
+		}
+	}
+
+	for _, e := range c.Extra {
+		e.walk(st, f)
+	}
+}
+
+// component returns a text component with the style
+func (st style) component(text string) *Component {
+	c := &Component{Text: text, Color: st.color}
+	for _, f := range []struct {
+		set bool
+		dst **bool
+	}{{st.bold, &c.Bold}, {st.italic, &c.Italic}, {st.underlined, &c.Underlined}, {st.strikethrough, &c.Strikethrough}, {st.obfuscated, &c.Obfuscated}} {
+		if f.set {
+			t := true
+			*f.dst = &t
+		}
+	}
+	return c
+}
+
+// legacy returns the legacy formatting codes of the style
+func (st style) legacy() string {
+	var b strings.Builder
+
+	switch {
+	case strings.HasPrefix(st.color, "#") && len(st.color) == 7:
+		b.WriteString("§x")
+		for _, r := range st.color[1:] {
+			b.WriteString("§" + string(toLower(r)))
+		}
+	case colorCodes[st.color] != 0:
+		b.WriteString("§" + string(colorCodes[st.color]))
+	default:
+		b.WriteString("§r")
+	}
+
+	for _, f := range []struct {
+		set  bool
+		code string
+	}{{st.obfuscated, "§k"}, {st.bold, "§l"}, {st.strikethrough, "§m"}, {st.underlined, "§n"}, {st.italic, "§o"}} {
+		if f.set {
+			b.WriteString(f.code)
+		}
+	}
+
+	return b.String()
+}
+
+// ansi returns the ANSI escape codes of the style
+func (st style) ansi() string {
+	codes := []string{}
+
+	switch {
+	case strings.HasPrefix(st.color, "#") && len(st.color) == 7:
+		if rgb, err := strconv.ParseUint(st.color[1:], 16, 32); err == nil {
+			codes = append(codes, "38;2;"+strconv.Itoa(int(rgb>>16&0xff))+";"+strconv.Itoa(int(rgb>>8&0xff))+";"+strconv.Itoa(int(rgb&0xff)))
+		}
+	case colorANSI[st.color] != "":
+		codes = append(codes, colorANSI[st.color])
+	}
+
+	for _, f := range []struct {
+		set  bool
+		code string
+	}{{st.bold, "1"}, {st.italic, "3"}, {st.underlined, "4"}, {st.strikethrough, "9"}} {
+		if f.set {
+			codes = append(codes, f.code)
+		}
+	}
+
+	if len(codes) == 0 {
+		return ""
+	}
+
+	return "\033[" + strings.Join(codes, ";") + "m"
+}
+
+// setFormat sets the format to v if v is specified
+func setFormat(format *bool, v *bool) {
+	if v != nil {
+		*format = *v
+	}
+}
+
+// legacyHex returns the hex color of a "§x§r§r§g§g§b§b" sequence at the start of runes
+func legacyHex(runes []rune) (string, bool) {
+	if len(runes) < 14 {
+		return "", false
+	}
+
+	hex := "#"
+	for i := 2; i < 14; i += 2 {
+		if runes[i] != runes[0] || !strings.ContainsRune("0123456789abcdef", toLower(runes[i+1])) {
+			return "", false
+		}
+		hex += string(toLower(runes[i+1]))
+	}
+
+	return hex, true
+}
+
+// colorName returns the color name of a legacy color code
+func colorName(code byte) string {
+	for name, c := range colorCodes {
+		if c == code {
+			return name
+		}
+	}
+	return ""
+}
+
+// isCode returns true if r is a legacy formatting code
+func isCode(r rune) bool {
+	return strings.ContainsRune("0123456789abcdefklmnorx", toLower(r))
+}
+
+// toLower returns the lower case of an ascii letter
+func toLower(r rune) rune {
+	if r >= 'A' && r <= 'Z' {
+		return r + 'a' - 'A'
+	}
+	return r
+}
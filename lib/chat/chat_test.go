@@ -0,0 +1,87 @@
+package chat
+
+import (
+	"testing"
+)
+
+func Test_Parse(t *testing.T) {
+	type test struct {
+		message   string
+		expJSON   string
+		expLegacy string
+	}
+
+	var tests []test = []test{
+		{
+			"hello",
+			`{"text":"hello"}`,
+			"hello",
+		},
+		{
+			"§6§lWARMING UP",
+			`{"text":"WARMING UP","color":"gold","bold":true}`,
+			"§6§lWARMING UP",
+		},
+		{
+			"&fserver status:\n&b&lHIBERNATING",
+			`{"text":"","extra":[{"text":"server status:\n","color":"white"},{"text":"HIBERNATING","color":"aqua","bold":true}]}`,
+			"§fserver status:\n§b§lHIBERNATING",
+		},
+		{
+			"R&D §cdown§r ok",
+			`{"text":"","extra":[{"text":"R\u0026D "},{"text":"down","color":"red"},{"text":" ok"}]}`,
+			"R&D §cdown§r ok",
+		},
+		{
+			"§x§f§f§a§a§0§0hex",
+			`{"text":"hex","color":"#ffaa00"}`,
+			"§x§f§f§a§a§0§0hex",
+		},
+		{
+			`{"text":"hi ","color":"red","extra":[{"text":"there","bold":true,"hoverEvent":{"action":"show_text","contents":"tip"}}]}`,
+			`{"text":"hi ","color":"red","extra":[{"text":"there","bold":true,"hoverEvent":{"action":"show_text","contents":"tip"}}]}`,
+			"§chi §c§lthere",
+		},
+		{
+			`["a",{"text":"b","color":"green"}]`,
+			`{"text":"a","extra":[{"text":"b","color":"green"}]}`,
+			"a§ab",
+		},
+		{
+			`"plain"`,
+			`{"text":"plain"}`,
+			"plain",
+		},
+		{
+			`{"translate":"multiplayer.disconnect.server_shutdown"}`,
+			`{"translate":"multiplayer.disconnect.server_shutdown"}`,
+			"multiplayer.disconnect.server_shutdown",
+		},
+	}
+
+	for _, tt := range tests {
+		c := Parse(tt.message)
+		if j := c.JSON(); j != tt.expJSON {
+			t.Errorf("%q encoded as %s (expected %s)", tt.message, j, tt.expJSON)
+		}
+		if l := c.Legacy(); l != tt.expLegacy {
+			t.Errorf("%q converted to legacy %q (expected %q)", tt.message, l, tt.expLegacy)
+		}
+	}
+}
+
+func Test_LegacyToANSI(t *testing.T) {
+	tests := map[string]string{
+		"no codes":          "no codes",
+		"a&b":               "a&b",
+		"§cred§r normal":    "\033[0mB\033[91mred\033[0mB normal",
+		"§l§obold italic":   "\033[0mB\033[1;3mbold italic\033[0mB",
+		"§x§1§2§3§4§5§6rgb": "\033[0mB\033[38;2;18;52;86mrgb\033[0mB",
+	}
+
+	for s, expect := range tests {
+		if ansi := LegacyToANSI(s, "B"); ansi != expect {
+			t.Errorf("%q converted to %q (expected %q)", s, ansi, expect)
+		}
+	}
+}
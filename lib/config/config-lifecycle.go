@@ -0,0 +1,81 @@
+package config
+
+import (
+	"strings"
+
+	"msh/lib/errco"
+)
+
+const (
+	LIFECYCLE_PROCESS  string = "process"    // ms is started by msh as a child process (Commands.StartServer)
+	LIFECYCLE_COMMANDS string = "commands"   // ms is managed by the lifecycle commands (start, stop, suspend, resume, status)
+	LIFECYCLE_DOCKER   string = "docker"     // ms runs in a docker container managed with the docker engine api
+	LIFECYCLE_KUBE     string = "kubernetes" // ms runs in a kubernetes workload scaled between 0 and 1 replicas with the kubernetes api
+
+	dockerSocketDefault string = "/var/run/docker.sock" // default unix socket of the docker engine api
+)
+
+// lifecycleModes are the lifecycle modes supported by msh
+var lifecycleModes []string = []string{LIFECYCLE_PROCESS, LIFECYCLE_COMMANDS, LIFECYCLE_DOCKER, LIFECYCLE_KUBE}
+
+// kubeResources maps the kinds of kubernetes workloads (and their kubectl aliases) to their api resources
+var kubeResources map[string]string = map[string]string{
+	"statefulset": "statefulsets", "statefulsets": "statefulsets", "sts": "statefulsets",
+	"deployment": "deployments", "deployments": "deployments", "deploy": "deployments",
+}
+
+// checkLifecycle checks the lifecycle config of the minecraft server.
+//
+// An unknown lifecycle mode or missing start command / container name / workload are major errors.
+// Suspension is disabled if the lifecycle mode can't suspend the minecraft server.
+func (c *Configuration) checkLifecycle() {
+	switch c.Lifecycle.Mode {
+	case "":
+		// lifecycle not specified in config (config of previous msh versions)
+		c.Lifecycle.Mode = LIFECYCLE_PROCESS
+
+	case LIFECYCLE_PROCESS:
+
+	case LIFECYCLE_COMMANDS:
+		if c.Lifecycle.Start == "" {
+			logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "lifecycle mode %s requires a start command (%s)", c.Lifecycle.Mode, c.Name)
+			c.setMajorError(logMsh)
+		}
+		if c.Msh.SuspendAllow && (c.Lifecycle.Suspend == "" || c.Lifecycle.Resume == "") {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "SuspendAllow disabled since lifecycle suspend/resume commands are not set (%s)", c.Name)
+			c.Msh.SuspendAllow = false
+		}
+
+	case LIFECYCLE_DOCKER:
+		if c.Lifecycle.Container == "" {
+			logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "lifecycle mode %s requires a container name (%s)", c.Lifecycle.Mode, c.Name)
+			c.setMajorError(logMsh)
+		}
+		if c.Lifecycle.DockerSocket == "" {
+			c.Lifecycle.DockerSocket = dockerSocketDefault
+		}
+
+	case LIFECYCLE_KUBE:
+		// workload is normalized to "<api resource>/<name>"
+		kind, name, _ := strings.Cut(c.Lifecycle.Workload, "/")
+		if resource, ok := kubeResources[strings.ToLower(kind)]; ok && name != "" {
+			c.Lifecycle.Workload = resource + "/" + name
+		} else {
+			logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "lifecycle mode %s requires a workload (statefulset/<name> - deployment/<name>) (%s)", c.Lifecycle.Mode, c.Name)
+			c.setMajorError(logMsh)
+		}
+		if c.Msh.SuspendAllow {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "SuspendAllow disabled since lifecycle mode %s can't suspend the minecraft server (%s)", c.Lifecycle.Mode, c.Name)
+			c.Msh.SuspendAllow = false
+		}
+		if c.Lifecycle.Host == "" {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "lifecycle mode %s should specify the minecraft server service as host (%s)", c.Lifecycle.Mode, c.Name)
+		}
+
+	default:
+		logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "lifecycle mode %q is not valid (%s) (%s)", c.Lifecycle.Mode, strings.Join(lifecycleModes, " - "), c.Name)
+		c.setMajorError(logMsh)
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "minecraft server lifecycle mode: %s (%s)", c.Lifecycle.Mode, c.Name)
+}
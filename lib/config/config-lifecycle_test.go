@@ -0,0 +1,51 @@
+package config
+
+import (
+	"testing"
+)
+
+func Test_checkLifecycle(t *testing.T) {
+	tests := []struct {
+		mode, start, suspend string
+		expectMode           string
+		expectMajor, suspAll bool
+	}{
+		{"", "", "", LIFECYCLE_PROCESS, false, true},                                     // config of previous msh versions
+		{LIFECYCLE_COMMANDS, "systemctl start mc", "", LIFECYCLE_COMMANDS, false, false}, // suspension requires suspend/resume commands
+		{LIFECYCLE_COMMANDS, "systemctl start mc", "kill -STOP $PID", LIFECYCLE_COMMANDS, false, true},
+		{LIFECYCLE_COMMANDS, "", "", LIFECYCLE_COMMANDS, true, false}, // start command required
+		{LIFECYCLE_DOCKER, "", "", LIFECYCLE_DOCKER, true, true},      // container name required
+		{LIFECYCLE_KUBE, "", "", LIFECYCLE_KUBE, true, false},         // workload required, suspension not supported
+		{"systemd", "", "", "systemd", true, true},                    // unknown mode
+	}
+
+	for _, test := range tests {
+		c := &Configuration{}
+		c.Msh.SuspendAllow = true
+		c.Lifecycle.Mode, c.Lifecycle.Start = test.mode, test.start
+		c.Lifecycle.Suspend, c.Lifecycle.Resume = test.suspend, test.suspend
+
+		c.checkLifecycle()
+		if c.Lifecycle.Mode != test.expectMode || (c.MajorError != nil) != test.expectMajor || c.Msh.SuspendAllow != test.suspAll {
+			t.Errorf("%+v: mode %q, major error %v, SuspendAllow %t", test, c.Lifecycle.Mode, c.MajorError, c.Msh.SuspendAllow)
+		}
+	}
+
+	// kubernetes workloads are normalized to api resources
+	workloads := map[string]string{
+		"statefulset/mc": "statefulsets/mc",
+		"deploy/mc":      "deployments/mc",
+		"Deployment/mc":  "deployments/mc",
+		"pod/mc":         "",
+		"statefulset":    "",
+	}
+	for workload, expect := range workloads {
+		c := &Configuration{}
+		c.Lifecycle.Mode, c.Lifecycle.Workload = LIFECYCLE_KUBE, workload
+
+		c.checkLifecycle()
+		if (expect == "") != (c.MajorError != nil) || (expect != "" && c.Lifecycle.Workload != expect) {
+			t.Errorf("workload %q: normalized to %q, major error %v", workload, c.Lifecycle.Workload, c.MajorError)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"sort"
+
+	"msh/lib/chat"
+	"msh/lib/errco"
+)
+
+// names of the client-facing messages (keys of Msh.Messages)
+const (
+	MSG_STOPPING         string = "Stopping"        // server info while ms is stopping
+	MSG_STARTING         string = "Starting"        // join response after ms warm was issued
+	MSG_NOT_WHITELISTED  string = "NotWhitelisted"  // join response to players that are not allowed to warm ms
+	MSG_WARM_ERROR       string = "WarmError"       // join response when ms warm failed
+	MSG_DIAL_ERROR       string = "DialError"       // join response when msh can't connect to ms
+	MSG_MAJOR_ERROR      string = "MajorError"      // server info and join response while ms has major errors
+	MSG_REQ_UNKNOWN      string = "RequestUnknown"  // response to unknown client requests
+	MSG_CONN_LIMIT       string = "ConnLimit"       // rejection: max concurrent connections reached
+	MSG_CONN_RATE        string = "ConnRate"        // rejection: connection rate exceeded by client address
+	MSG_WARM_RATE        string = "WarmRate"        // rejection: warm attempts rate exceeded by client address
+	MSG_BANNED           string = "Banned"          // rejection: client address is banned
+	MSG_REFUSED          string = "Refused"         // rejection: other reasons
+	MSG_LIMBO_PROGRESS   string = "LimboProgress"   // action bar shown to players waiting in limbo
+	MSG_LIMBO_STOPPED    string = "LimboStopped"    // disconnection from limbo when ms is not starting
+	MSG_LIMBO_TIMEOUT    string = "LimboTimeout"    // disconnection from limbo when LimboMaxWait is exceeded
+	MSG_RCON_HIBERNATING string = "RconHibernating" // msh rcon response to commands forwarded while ms is hibernating (and RconWarm is disabled)
+)
+
+// defaultMessages contains the default templates of client-facing messages
+var defaultMessages map[string]string = map[string]string{
+	MSG_STOPPING:         "server is stopping...\nrefresh the page",
+	MSG_STARTING:         "Server start command issued. Please wait... {progress} (eta: {eta})",
+	MSG_NOT_WHITELISTED:  "{player}, you don't have permission to warm this server",
+	MSG_WARM_ERROR:       "An error occurred while warming the server: check the msh log",
+	MSG_DIAL_ERROR:       "can't connect to server... check if minecraft server is running and set the correct ServPort",
+	MSG_MAJOR_ERROR:      "{error}",
+	MSG_REQ_UNKNOWN:      "Client request unknown",
+	MSG_CONN_LIMIT:       "msh is handling too many connections, retry later",
+	MSG_CONN_RATE:        "too many connections from your address, retry later",
+	MSG_WARM_RATE:        "too many attempts to warm the server from your address, retry later",
+	MSG_BANNED:           "your address is temporarily banned, retry later",
+	MSG_REFUSED:          "connection refused",
+	MSG_LIMBO_PROGRESS:   "§6Server is starting... §f{progress} §7(eta: {eta})",
+	MSG_LIMBO_STOPPED:    "Server is not starting: please try again",
+	MSG_LIMBO_TIMEOUT:    "Server is taking too long to start: please try again",
+	MSG_RCON_HIBERNATING: "server is hibernating: command not executed (use \"msh start\" to warm it)",
+}
+
+// Message returns the template of the client-facing message
+// (the valid template set in Msh.Messages or the default one)
+func (c *Configuration) Message(name string) string {
+	if c.messages == nil {
+		c.checkMessages()
+	}
+	if tpl, ok := c.messages[name]; ok {
+		return tpl
+	}
+	return defaultMessages[name]
+}
+
+// checkMessages checks the message templates set in config and stores the valid ones.
+// Unknown messages and templates with unknown placeholders are logged and ignored (default template is used).
+func (c *Configuration) checkMessages() {
+	for _, info := range []struct{ name, tpl string }{{"InfoHibernation", c.Msh.InfoHibernation}, {"InfoStarting", c.Msh.InfoStarting}} {
+		if err := chat.CheckTemplate(info.tpl); err != nil {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "%s is not valid (unknown placeholders are shown as they are): %s", info.name, err.Error())
+		}
+	}
+
+	names := []string{}
+	for name := range c.Msh.Messages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	messages := map[string]string{}
+	for _, name := range names {
+		if _, ok := defaultMessages[name]; !ok {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "message %s is unknown (ignored)", name)
+			continue
+		}
+		if err := chat.CheckTemplate(c.Msh.Messages[name]); err != nil {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "message %s is not valid (default message is used): %s", name, err.Error())
+			continue
+		}
+		messages[name] = c.Msh.Messages[name]
+	}
+
+	c.messages = messages
+}
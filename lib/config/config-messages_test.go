@@ -0,0 +1,36 @@
+package config
+
+import (
+	"testing"
+)
+
+func Test_Message(t *testing.T) {
+	c := &Configuration{}
+	c.Msh.Messages = map[string]string{
+		MSG_STARTING:        "§6{player}, the server is ready in {eta}",
+		MSG_NOT_WHITELISTED: "{player} is not welcome here, {reason}",
+		"Unknown":           "ignored",
+	}
+
+	tests := map[string]string{
+		MSG_STARTING:        "§6{player}, the server is ready in {eta}",                // valid override
+		MSG_NOT_WHITELISTED: "{player}, you don't have permission to warm this server", // unknown placeholder: default is used
+		MSG_STOPPING:        "server is stopping...\nrefresh the page",                 // not overridden
+		"Unknown":           "",                                                        // unknown message
+	}
+
+	for name, expect := range tests {
+		if tpl := c.Message(name); tpl != expect {
+			t.Errorf("message %s is %q (expected %q)", name, tpl, expect)
+		}
+	}
+
+	// default templates must be valid
+	for name, tpl := range defaultMessages {
+		c.Msh.Messages = map[string]string{name: tpl}
+		c.checkMessages()
+		if _, ok := c.messages[name]; !ok {
+			t.Errorf("default message %s is not valid", name)
+		}
+	}
+}
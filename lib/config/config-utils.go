@@ -5,29 +5,53 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"image"
 	"image/jpeg"
 	"image/png"
 	"io"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 
+	"msh/lib/conn/protocol"
 	"msh/lib/errco"
 	"msh/lib/model"
 	"msh/lib/utility"
 )
 
-// IsWhitelist checks if the parameters are in config whitelist.
-// (Currently this function accepts as arguments the client request packet and the client address)
-func (c *Configuration) IsWhitelist(reqPacket []byte, clientAddress string) *errco.MshLog {
-	var foundMatch bool = false
+// IsWhitelist checks if the player or the client address are allowed to warm the server by config whitelist.
+//
+// The player is matched by name (case insensitive, as minecraft player names) or by uuid
+// (uuid is empty if the client did not send it: clients before 1.19.1).
+func (c *Configuration) IsWhitelist(playerName, playerUUID, clientAddress string) *errco.MshLog {
+	allowed, reason := c.CheckWhitelist(playerName, playerUUID, clientAddress)
+	if !allowed {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_WHITELIST_CHECK, "whitelist check failed: player %s (%s) is not allowed to warm the server (%s)", playerName, clientAddress, reason)
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "whitelist ok: player %s (%s) %s", playerName, clientAddress, reason)
+	return nil
+}
 
+// CheckWhitelist returns if the player or the client address are allowed to warm the server
+// and the reason of the decision (whitelist entry matched).
+func (c *Configuration) CheckWhitelist(playerName, playerUUID, clientAddress string) (bool, string) {
 	// check if at least one whitelist type is enabled
 	if !c.Msh.WhitelistImport && len(c.Msh.Whitelist) == 0 {
-		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "whitelist not enabled at all")
-		return nil
+		return true, "whitelist not enabled"
+	}
+
+	// check whitelist from msh config (deny entries take precedence)
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "searching whitelist for: %s, %s, %s", clientAddress, playerName, playerUUID)
+	entry, deny := c.WhitelistMatch(playerName, playerUUID, clientAddress)
+	switch {
+	case entry != "" && deny:
+		return false, fmt.Sprintf("matched deny entry %s in msh config", entry)
+	case entry != "":
+		return true, fmt.Sprintf("matched entry %s in msh config", entry)
 	}
 
 	// check whitelist from minecraft server config
@@ -36,59 +60,59 @@ func (c *Configuration) IsWhitelist(reqPacket []byte, clientAddress string) *err
 
 		// read from file whitelist.json file
 		// load minecraft server whitelist
-		// check elements of minecraft server whitelist against request packet
+		// check elements of minecraft server whitelist against player name and uuid
 		if data, err := os.ReadFile(filepath.Join(c.Server.Folder, "whitelist.json")); err != nil {
 			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_WHITELIST_CHECK, "whitelist.json file file can't be read")
 		} else if err = json.Unmarshal(data, &wl); err != nil {
 			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_WHITELIST_CHECK, "whitelist.json file format error")
 		} else {
 			for _, e := range wl {
-				// nameLen contains [ lenght of name + name ] (to increase safety)
-				// omitted lenght of name:	"gekigek99 can be found both in "gekigek99" and "gekigek99-twin"
-				// with lenght of name:		"[9]gekigek99" can be found in "[9]gekigek99" and not in "[14]gekigek99-twin"
-				nameLen := append([]byte{byte(len(e.Name))}, []byte(e.Name)...)
-				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "searching byte array for: %s (whitelist import enabled)", e.Name)
-				if bytes.Contains(reqPacket, nameLen) {
-					foundMatch = true
+				switch {
+				case e.UUID != "" && uuidEqual(e.UUID, playerUUID):
+					return true, fmt.Sprintf("matched uuid %s in whitelist.json", e.UUID)
+				case e.Name != "" && strings.EqualFold(e.Name, playerName):
+					return true, fmt.Sprintf("matched name %s in whitelist.json", e.Name)
 				}
 			}
 		}
 
-	} else {
-		// minecraft server whitelist import not enabled
-		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "minecraft server whitelist import not enabled")
+	} else if !c.hasAllowEntries() {
+		// msh config whitelist contains only deny entries
+		return true, "no deny entry matched"
 	}
 
-	// check whitelist from msh config
-	if len(c.Msh.Whitelist) > 0 {
-		// check client address against msh config whitelist
-		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "searching whitelist for: %s", clientAddress)
-		if utility.SliceContain(clientAddress, c.Msh.Whitelist) {
-			foundMatch = true
-		}
+	// no match found
+	return false, "no entry matched"
+}
 
-		// check elements of msh config whitelist against request packet
-		for _, w := range c.Msh.Whitelist {
-			// wLen contains [ lenght of w + name ] (to increase safety)
-			// follows same explanation of nameLen
-			wLen := append([]byte{byte(len(w))}, []byte(w)...)
-			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "searching byte array for: %s", w)
-			if bytes.Contains(reqPacket, wLen) {
-				foundMatch = true
-			}
+// hasAllowEntries returns true if msh config whitelist contains entries that are not deny entries
+func (c *Configuration) hasAllowEntries() bool {
+	for _, w := range c.Msh.Whitelist {
+		if !strings.HasPrefix(strings.TrimSpace(w), "!") {
+			return true
 		}
+	}
+	return false
+}
+
+// uuidEqual returns true if the two uuids are equal (dashes and case are ignored).
+// Empty uuids are never equal.
+func uuidEqual(a, b string) bool {
+	normalize := func(u string) string {
+		return strings.ToLower(strings.ReplaceAll(u, "-", ""))
+	}
 
-	} else {
-		// msh config whitelist not enabled
-		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "msh config whitelist not enabled")
+	if normalize(a) == "" || normalize(b) == "" {
+		return false
 	}
 
-	if foundMatch {
-		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "whitelist ok!")
-		return nil
-	} else {
-		// no match found
-		return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_WHITELIST_CHECK, "msh config whitelist check failed")
+	return normalize(a) == normalize(b)
+}
+
+// setMajorError sets *Configuration.MajorError only if nil
+func (c *Configuration) setMajorError(e *errco.MshLog) {
+	if c.MajorError == nil {
+		c.MajorError = e
 	}
 }
 
@@ -96,7 +120,7 @@ func (c *Configuration) IsWhitelist(reqPacket []byte, clientAddress string) *err
 // The default icon is loaded by default
 func (c *Configuration) loadIcon() *errco.MshLog {
 	// set default server icon
-	ServerIcon = defaultServerIcon
+	c.ServerIcon = defaultServerIcon
 
 	// get the path of the user specified server icon
 	userIconPaths := []string{}
@@ -150,7 +174,7 @@ func (c *Configuration) loadIcon() *errco.MshLog {
 		}
 
 		// load user specified server icon as base64 encoded string
-		ServerIcon = base64.RawStdEncoding.EncodeToString(buff.Bytes())
+		c.ServerIcon = base64.RawStdEncoding.EncodeToString(buff.Bytes())
 
 		// as soon as a good image is loaded, break and return
 		break
@@ -201,6 +225,81 @@ func (c *Configuration) getVersionInfo() (string, int, *errco.MshLog) {
 	return "", -1, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_VERSION_LOAD, "minecraft server version and protocol could not be extracted from version.json")
 }
 
+// completeVersion fills ms version or protocol (if missing) with the known protocol versions
+func (c *Configuration) completeVersion() {
+	switch {
+	case c.Server.Version == "" && c.Server.Protocol > 0:
+		c.Server.Version = protocol.VersionName(int32(c.Server.Protocol))
+	case c.Server.Version != "" && c.Server.Protocol <= 0:
+		if p, ok := protocol.VersionProtocol(c.Server.Version); ok {
+			c.Server.Protocol = int(p)
+		}
+	}
+}
+
+// isLocalHost returns true if host is an address of the machine running msh
+// (localhost, loopback and unspecified addresses or addresses of the network interfaces)
+func isLocalHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() || ip.IsUnspecified() {
+		return true
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sameHost returns true if hosts a and b are the same host
+// (local addresses are the same host)
+func sameHost(a, b string) bool {
+	if strings.EqualFold(a, b) {
+		return true
+	}
+	if ipA, ipB := net.ParseIP(a), net.ParseIP(b); ipA != nil && ipA.Equal(ipB) {
+		return true
+	}
+	return isLocalHost(a) && isLocalHost(b)
+}
+
+// MSRcon returns the rcon port and password of ms.
+// Lifecycle.RconPort and Lifecycle.RconPassword are used if set, otherwise they are read from server.properties.
+// If rcon is not enabled, password is empty.
+func (c *Configuration) MSRcon() (int, string) {
+	password := c.Lifecycle.RconPassword
+	if password == "" {
+		if enabled, logMsh := c.ParsePropertiesBool("enable-rcon"); logMsh != nil || !enabled {
+			return 0, ""
+		}
+		password, _ = c.ParsePropertiesString("rcon.password")
+	}
+
+	port := c.Lifecycle.RconPort
+	if port == 0 {
+		var logMsh *errco.MshLog
+		if port, logMsh = c.ParsePropertiesInt("rcon.port"); logMsh != nil {
+			port = 25575 // default
+		}
+	}
+
+	return port, password
+}
+
 // ParsePropertiesString reads server.properties file and returns the requested variable
 func (c *Configuration) ParsePropertiesString(key string) (string, *errco.MshLog) {
 	data, err := os.ReadFile(filepath.Join(c.Server.Folder, "server.properties"))
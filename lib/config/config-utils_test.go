@@ -0,0 +1,72 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_IsWhitelist(t *testing.T) {
+	type test struct {
+		name    string
+		uuid    string
+		address string
+		expOk   bool
+	}
+
+	c := &Configuration{}
+	c.Server.Folder = t.TempDir()
+	c.Msh.Whitelist = []string{"127.0.0.1", "gekigek99", "069a79f4-44e9-4726-a5be-fca90e38aaf5"}
+	c.Msh.WhitelistImport = true
+
+	wl := `[{"uuid": "c45dfca9-92bd-4501-a9d0-9cc9cdc50271", "name": "alice"}]`
+	if err := os.WriteFile(filepath.Join(c.Server.Folder, "whitelist.json"), []byte(wl), 0644); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	var tests []test = []test{
+		// positive cases [msh config]
+		{"someone", "", "127.0.0.1", true},
+		{"gekigek99", "", "10.0.0.1", true},
+		{"GEKIGEK99", "", "10.0.0.1", true},
+		{"notch", "069a79f444e94726a5befca90e38aaf5", "10.0.0.1", true},
+
+		// positive cases [whitelist.json]
+		{"alice", "", "10.0.0.1", true},
+		{"alice-renamed", "c45dfca9-92bd-4501-a9d0-9cc9cdc50271", "10.0.0.1", true},
+
+		// negative cases
+		{"gekigek99-twin", "", "10.0.0.1", false},
+		{"gekigek9", "", "10.0.0.1", false},
+		{"malice", "00000000-0000-0000-0000-000000000000", "10.0.0.1", false},
+		{"bob", "", "127.0.0.10", false},
+	}
+
+	for _, tt := range tests {
+		logMsh := c.IsWhitelist(tt.name, tt.uuid, tt.address)
+		if (logMsh == nil) != tt.expOk {
+			t.Errorf("player %s (uuid: %s, address: %s): whitelist result %t different from expected", tt.name, tt.uuid, tt.address, logMsh == nil)
+		}
+	}
+}
+
+func Test_sameHost(t *testing.T) {
+	tests := []struct {
+		a, b   string
+		expect bool
+	}{
+		{"127.0.0.1", "127.0.0.1", true},
+		{"127.0.0.1", "localhost", true},
+		{"0.0.0.0", "::1", true},
+		{"minecraft-1", "MINECRAFT-1", true},
+		{"minecraft-1", "minecraft-2", false},
+		{"127.0.0.1", "minecraft-1", false},
+		{"192.0.2.1", "192.0.2.2", false},
+		{"2001:db8::1", "2001:0db8::1", true},
+	}
+	for _, test := range tests {
+		if same := sameHost(test.a, test.b); same != test.expect {
+			t.Errorf("%s and %s same host: %t (expected %t)", test.a, test.b, same, test.expect)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"encoding/hex"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+
+	"msh/lib/errco"
+)
+
+// whitelistM protects the compiled whitelist rules of all configurations
+var whitelistM *sync.Mutex = &sync.Mutex{}
+
+// wlRule is a compiled msh config whitelist entry
+type wlRule struct {
+	entry string         // entry as specified in msh config
+	deny  bool           // entry starts with "!": matching players are not allowed to warm the server
+	nets  []*net.IPNet   // address, CIDR range or resolved hostname addresses
+	uuid  string         // player uuid
+	name  *regexp.Regexp // player name (with "*" wildcards)
+}
+
+// LoadWhitelist compiles the msh config whitelist entries into whitelist rules.
+// Hostnames are resolved now: call it again to resolve them again.
+//
+// Entry types ("!" prefix denies the entry, deny entries take precedence):
+//   - ip address         "192.168.1.2"
+//   - CIDR range         "192.168.1.0/24", "2001:db8::/64"
+//   - hostname           "home.example.com" (must contain a dot)
+//   - player uuid        "069a79f4-44e9-4726-a5be-fca90e38aaf5"
+//   - player name        "gekigek99", "gek*" (case insensitive, "*" matches any sequence of characters)
+func (c *Configuration) LoadWhitelist() {
+	rules := []*wlRule{}
+
+	for _, entry := range c.Msh.Whitelist {
+		r := &wlRule{entry: entry}
+		e := strings.TrimSpace(entry)
+		if strings.HasPrefix(e, "!") {
+			r.deny, e = true, strings.TrimSpace(e[1:])
+		}
+
+		switch {
+		case e == "":
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_WHITELIST_CHECK, "whitelist entry %q is empty (ignored)", entry)
+			continue
+
+		case strings.Contains(e, "/"):
+			_, n, err := net.ParseCIDR(e)
+			if err != nil {
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_WHITELIST_CHECK, "whitelist entry %q is not a valid CIDR range (ignored)", entry)
+				continue
+			}
+			r.nets = []*net.IPNet{n}
+
+		case net.ParseIP(e) != nil:
+			r.nets = []*net.IPNet{ipNet(net.ParseIP(e))}
+
+		case isUUID(e):
+			r.uuid = e
+
+		case strings.Contains(e, "."):
+			ips, err := net.LookupIP(e)
+			if err != nil {
+				// the rule is kept: it does not match any address until hostname is resolved again
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_WHITELIST_CHECK, "whitelist entry %q could not be resolved: %s", entry, err.Error())
+			}
+			for _, ip := range ips {
+				r.nets = append(r.nets, ipNet(ip))
+			}
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "whitelist entry %q resolved to %v", entry, ips)
+
+		default:
+			r.name = regexp.MustCompile("(?i)^" + strings.ReplaceAll(regexp.QuoteMeta(e), `\*`, ".*") + "$")
+		}
+
+		rules = append(rules, r)
+	}
+
+	whitelistM.Lock()
+	c.wlRules = rules
+	whitelistM.Unlock()
+}
+
+// WhitelistMatch returns the first msh config whitelist entry matched by the player or the client address.
+// Deny entries are checked first. If no entry matches, entry is empty.
+func (c *Configuration) WhitelistMatch(playerName, playerUUID, clientAddress string) (entry string, deny bool) {
+	whitelistM.Lock()
+	if c.wlRules == nil {
+		whitelistM.Unlock()
+		c.LoadWhitelist()
+		whitelistM.Lock()
+	}
+	rules := c.wlRules
+	whitelistM.Unlock()
+
+	ip := net.ParseIP(strings.Trim(clientAddress, "[]"))
+
+	for _, deny := range []bool{true, false} {
+		for _, r := range rules {
+			if r.deny == deny && r.match(playerName, playerUUID, ip) {
+				return r.entry, r.deny
+			}
+		}
+	}
+
+	return "", false
+}
+
+// match returns true if the player or the client ip match the rule
+func (r *wlRule) match(playerName, playerUUID string, ip net.IP) bool {
+	for _, n := range r.nets {
+		if ip != nil && n.Contains(ip) {
+			return true
+		}
+	}
+
+	switch {
+	case r.uuid != "":
+		return uuidEqual(r.uuid, playerUUID)
+	case r.name != nil:
+		return playerName != "" && r.name.MatchString(playerName)
+	default:
+		return false
+	}
+}
+
+// ipNet returns the network containing only the specified ip
+func ipNet(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// isUUID returns true if s is a uuid (dashes are ignored)
+func isUUID(s string) bool {
+	s = strings.ReplaceAll(s, "-", "")
+	_, err := hex.DecodeString(s)
+	return len(s) == 32 && err == nil
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"testing"
+)
+
+func Test_WhitelistMatch(t *testing.T) {
+	type test struct {
+		name     string
+		uuid     string
+		address  string
+		expEntry string
+		expDeny  bool
+	}
+
+	c := &Configuration{}
+	c.Msh.Whitelist = []string{
+		"192.168.1.0/24",
+		"!192.168.1.66",
+		"2001:db8:1::/64",
+		"10.0.0.1",
+		"gek*",
+		"!*_bot",
+		"069a79f4-44e9-4726-a5be-fca90e38aaf5",
+		"not/a/cidr",
+	}
+	c.LoadWhitelist()
+
+	var tests []test = []test{
+		// address entries
+		{"someone", "", "192.168.1.2", "192.168.1.0/24", false},
+		{"someone", "", "[2001:db8:1::abcd]", "2001:db8:1::/64", false},
+		{"someone", "", "2001:db8:1::abcd", "2001:db8:1::/64", false},
+		{"someone", "", "10.0.0.1", "10.0.0.1", false},
+		{"someone", "", "10.0.0.10", "", false},
+		{"someone", "", "2001:db8:2::1", "", false},
+
+		// player entries
+		{"gekigek99", "", "172.16.0.1", "gek*", false},
+		{"GEKIGEK99", "", "172.16.0.1", "gek*", false},
+		{"notch", "069a79f444e94726a5befca90e38aaf5", "172.16.0.1", "069a79f4-44e9-4726-a5be-fca90e38aaf5", false},
+		{"agek", "", "172.16.0.1", "", false},
+
+		// deny entries take precedence
+		{"someone", "", "192.168.1.66", "!192.168.1.66", true},
+		{"gek_bot", "", "192.168.1.2", "!*_bot", true},
+	}
+
+	for _, tt := range tests {
+		entry, deny := c.WhitelistMatch(tt.name, tt.uuid, tt.address)
+		if entry != tt.expEntry || deny != tt.expDeny {
+			t.Errorf("player %s (uuid: %s, address: %s) matched %q (deny: %t), expected %q (deny: %t)", tt.name, tt.uuid, tt.address, entry, deny, tt.expEntry, tt.expDeny)
+		}
+	}
+
+	// only deny entries: everyone else is allowed
+	c = &Configuration{}
+	c.Msh.Whitelist = []string{"!192.168.1.66"}
+	if allowed, reason := c.CheckWhitelist("someone", "", "192.168.1.2"); !allowed {
+		t.Errorf("player not denied was not allowed (%s)", reason)
+	}
+	if allowed, _ := c.CheckWhitelist("someone", "", "192.168.1.66"); allowed {
+		t.Errorf("denied player was allowed")
+	}
+}
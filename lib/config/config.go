@@ -9,10 +9,10 @@ import (
 	"path/filepath"
 	"strings"
 
+	"msh/lib/conn/protocol"
 	"msh/lib/errco"
 	"msh/lib/model"
 	"msh/lib/opsys"
-	"msh/lib/servstats"
 	"msh/lib/utility"
 
 	"github.com/google/shlex"
@@ -21,25 +21,39 @@ import (
 var (
 	configFileName string = "msh-config.json" // configFileName is the config file name
 
-	ConfigDefault *Configuration = &Configuration{} // ConfigDefault contains parameters of config in file
-	ConfigRuntime *Configuration = &Configuration{} // ConfigRuntime contains parameters of config in runtime
+	ConfigDefault *Configuration = &Configuration{}   // ConfigDefault contains parameters of config in file
+	ConfigRuntime *Configuration = newConfiguration() // ConfigRuntime contains parameters of config in runtime (default minecraft server)
+
+	// ConfigServers contains the runtime config of each minecraft server managed by msh.
+	// ConfigServers[0] is ConfigRuntime, additional servers follow in the order of config file.
+	ConfigServers []*Configuration = []*Configuration{ConfigRuntime}
 
 	configDefaultSave bool = false // if true, the config will be saved after successful loading
 
 	JavaV string // Javav is the java version on the system. format: "java 16.0.1 2021-04-20"
 
-	ServerIcon string = defaultServerIcon // ServerIcon contains the minecraft server icon
-
-	MshHost       string = "0.0.0.0"   // MshHost		is the ip address for clients to connect to msh
-	MshPort       int                  // MshPort		is the port for clients to connect to msh
-	MshPortQuery  int                  // MshPortQuery	is the port for clients to perform stats query requests at msh
-	ServHost      string = "127.0.0.1" // ServHost		is the ip address for msh to connect to minecraft server
-	ServPort      int                  // ServPort		is the port for msh to connect to minecraft server
-	ServPortQuery int                  // ServPortQuery	is the port for msh to perform stats query requests at minecraft server
+	MshHost string = "0.0.0.0" // MshHost		is the ip address for clients to connect to msh
 )
 
 type Configuration struct {
 	model.Configuration
+
+	ServHost      string        `json:"-"` // ServHost		is the ip address for msh to connect to minecraft server
+	ServPort      int           `json:"-"` // ServPort		is the port for msh to connect to minecraft server
+	ServPortQuery int           `json:"-"` // ServPortQuery	is the port for msh to perform stats query requests at minecraft server
+	ServerIcon    string        `json:"-"` // ServerIcon		contains the minecraft server icon
+	MajorError    *errco.MshLog `json:"-"` // MajorError		is the first major error found while loading the minecraft server config
+
+	wlRules  []*wlRule         // compiled msh config whitelist entries (nil if not compiled)
+	messages map[string]string // valid msh config message templates (nil if not checked)
+}
+
+// newConfiguration returns a runtime config initialized to runtime defaults
+func newConfiguration() *Configuration {
+	return &Configuration{
+		ServHost:   "127.0.0.1",
+		ServerIcon: defaultServerIcon,
+	}
 }
 
 // LoadConfig loads config file into default/runtime config.
@@ -71,6 +85,12 @@ func LoadConfig() *errco.MshLog {
 		return logMsh.AddTrace()
 	}
 
+	// load config of additional minecraft servers
+	logMsh = loadServers(ConfigDefault)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
 	// ---------------- save config ---------------- //
 
 	if configDefaultSave {
@@ -176,7 +196,8 @@ func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 	var logMsh *errco.MshLog
 
 	// initialize config to base
-	*c = *confdef
+	*c = *newConfiguration()
+	c.Configuration = confdef.Configuration
 
 	// specify arguments
 	flag.StringVar(&c.Server.Folder, "folder", c.Server.Folder, "Specify minecraft server folder path.")
@@ -189,12 +210,24 @@ func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 	// c.Commands.StopServer should not be set by a flag
 	flag.IntVar(&c.Commands.StopServerAllowKill, "allowkill", c.Commands.StopServerAllowKill, "Specify after how many seconds the server should be killed (if stop command fails).")
 
+	flag.StringVar(&c.Lifecycle.Mode, "lifecycle", c.Lifecycle.Mode, "Specify how msh manages the minecraft server (process - commands - docker - kubernetes).")
+	// c.Lifecycle.Start, c.Lifecycle.Stop, c.Lifecycle.Suspend, c.Lifecycle.Resume, c.Lifecycle.Status should not be set by a flag
+	flag.StringVar(&c.Lifecycle.Host, "servhost", c.Lifecycle.Host, "Specify the minecraft server address.")
+	// c.Lifecycle.Port is overridden by the -servport flag
+	flag.IntVar(&c.Lifecycle.RconPort, "servrconport", c.Lifecycle.RconPort, "Specify the minecraft server rcon port.")
+	flag.StringVar(&c.Lifecycle.RconPassword, "servrconpass", c.Lifecycle.RconPassword, "Specify the minecraft server rcon password.")
+	flag.StringVar(&c.Lifecycle.Container, "container", c.Lifecycle.Container, "Specify the minecraft server docker container.")
+	flag.StringVar(&c.Lifecycle.DockerSocket, "dockersock", c.Lifecycle.DockerSocket, "Specify the docker engine api unix socket.")
+	flag.StringVar(&c.Lifecycle.Workload, "workload", c.Lifecycle.Workload, "Specify the minecraft server kubernetes workload (statefulset/<name> - deployment/<name>).")
+	flag.StringVar(&c.Lifecycle.Namespace, "namespace", c.Lifecycle.Namespace, "Specify the minecraft server kubernetes namespace.")
+	flag.StringVar(&c.Lifecycle.Kubeconfig, "kubeconfig", c.Lifecycle.Kubeconfig, "Specify the kubeconfig file (yaml or json format).")
+
 	flag.IntVar(&c.Msh.Debug, "d", c.Msh.Debug, "Specify debug level.")
 	// c.Msh.ID should not be set by a flag
 	flag.IntVar(&c.Msh.MshPort, "port", c.Msh.MshPort, "Specify msh port.")
 	flag.IntVar(&c.Msh.MshPortQuery, "portquery", c.Msh.MshPortQuery, "Specify msh port for queries.")
-	flag.IntVar(&ServPort, "servport", ServPort, "Specify the minecraft server port.")
-	flag.IntVar(&ServPortQuery, "servportquery", ServPortQuery, "Specify minecraft server port for queries.")
+	flag.IntVar(&c.ServPort, "servport", c.ServPort, "Specify the minecraft server port.")
+	flag.IntVar(&c.ServPortQuery, "servportquery", c.ServPortQuery, "Specify minecraft server port for queries.")
 	flag.BoolVar(&c.Msh.EnableQuery, "enablequery", c.Msh.EnableQuery, "Enables queries handling.")
 	flag.Int64Var(&c.Msh.TimeBeforeStoppingEmptyServer, "timeout", c.Msh.TimeBeforeStoppingEmptyServer, "Specify time to wait before stopping minecraft server.")
 	flag.BoolVar(&c.Msh.SuspendAllow, "suspendallow", c.Msh.SuspendAllow, "Enables minecraft server process suspension.")
@@ -207,6 +240,27 @@ func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 	flag.BoolVar(&c.Msh.WhitelistImport, "wlimport", c.Msh.WhitelistImport, "Enables minecraft server whitelist import.")
 	flag.BoolVar(&c.Msh.ShowResourceUsage, "showres", c.Msh.ShowResourceUsage, "Enables logging of msh resource usage (cpu / mem percentage).")
 	flag.BoolVar(&c.Msh.ShowInternetUsage, "showint", c.Msh.ShowInternetUsage, "Enables logging of msh interent usage (->clients / ->server).")
+	flag.BoolVar(&c.Msh.AcceptProxyProtocol, "acceptproxy", c.Msh.AcceptProxyProtocol, "Enables reading of PROXY protocol header from clients.")
+	flag.BoolVar(&c.Msh.SendProxyProtocol, "sendproxy", c.Msh.SendProxyProtocol, "Enables sending of PROXY protocol header to minecraft server.")
+	flag.IntVar(&c.Msh.ConnIdleTimeout, "idletimeout", c.Msh.ConnIdleTimeout, "Specify after how many seconds without data a proxied connection is closed.")
+	flag.IntVar(&c.Msh.ConnKeepAlive, "keepalive", c.Msh.ConnKeepAlive, "Specify tcp keepalive period of proxied connections.")
+	flag.IntVar(&c.Msh.MaxConnections, "maxconn", c.Msh.MaxConnections, "Specify max concurrent client connections.")
+	flag.IntVar(&c.Msh.MaxConnRatePerIP, "maxconnrate", c.Msh.MaxConnRatePerIP, "Specify max connections per minute from the same client address.")
+	flag.IntVar(&c.Msh.MaxWarmPerIP, "maxwarmrate", c.Msh.MaxWarmPerIP, "Specify max warm attempts per hour from the same client address.")
+	flag.IntVar(&c.Msh.BanDuration, "banduration", c.Msh.BanDuration, "Specify for how many seconds a client address exceeding the rates is banned.")
+	// c.Msh.PlayersSample (type []string, not worth to make it a flag)
+	flag.IntVar(&c.Msh.PlayersSampleRecent, "samplerecent", c.Msh.PlayersSampleRecent, "Specify how many recently seen players are shown in the players list.")
+	flag.BoolVar(&c.Msh.ProtocolEcho, "protocolecho", c.Msh.ProtocolEcho, "Enables reporting of client protocol as minecraft server protocol.")
+	// c.Msh.AcceptedProtocols (type []string, not worth to make it a flag)
+	flag.IntVar(&c.Msh.MshPortBedrock, "portbedrock", c.Msh.MshPortBedrock, "Specify msh port for bedrock edition clients.")
+	flag.IntVar(&c.Msh.ServPortBedrock, "servportbedrock", c.Msh.ServPortBedrock, "Specify the minecraft server port for bedrock edition clients.")
+	flag.BoolVar(&c.Msh.EnableLimbo, "limbo", c.Msh.EnableLimbo, "Enables holding of joining players in a limbo while minecraft server starts.")
+	flag.IntVar(&c.Msh.LimboMaxWait, "limbomaxwait", c.Msh.LimboMaxWait, "Specify for how many seconds a player can be held in limbo.")
+	flag.IntVar(&c.Msh.HoldMaxWait, "holdmaxwait", c.Msh.HoldMaxWait, "Specify for how many seconds a joining client connection can be held open until minecraft server is online.")
+	flag.IntVar(&c.Msh.MshPortRcon, "portrcon", c.Msh.MshPortRcon, "Specify msh port for rcon connections.")
+	flag.StringVar(&c.Msh.RconPassword, "rconpass", c.Msh.RconPassword, "Specify msh rcon password.")
+	flag.BoolVar(&c.Msh.RconWarm, "rconwarm", c.Msh.RconWarm, "Enables warming of minecraft server by commands forwarded by msh rcon.")
+	// c.Msh.Messages (type map[string]string, not worth to make it a flag)
 
 	// backward compatibility
 	flag.IntVar(&c.Commands.StopServerAllowKill, "allowKill", c.Commands.StopServerAllowKill, "Specify after how many seconds the server should be killed (if stop command fails).") // msh pterodactyl egg
@@ -233,15 +287,116 @@ func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_0, errco.ERROR_NIL, "setting log level to: %d", c.Msh.Debug)
 	errco.DebugLvl = errco.LogLvl(c.Msh.Debug)
 
+	// the default minecraft server is named "default" if not specified
+	if c.Name == "" {
+		c.Name = "default"
+	}
+
+	logMsh = c.setup(confdef)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	return nil
+}
+
+// loadServers loads the runtime config of the additional minecraft servers specified in confdef.Servers.
+//
+// Parameters not specified for an additional server are inherited from the default minecraft server in confdef.
+// Start arguments apply only to the default minecraft server.
+func loadServers(confdef *Configuration) *errco.MshLog {
+	// reset additional servers (ConfigRuntime is always the first server)
+	ConfigServers = []*Configuration{ConfigRuntime}
+
+	// base config inherited by additional servers
+	// (marshalled so that each server gets its own copy of slices)
+	base, err := json.Marshal(&confdef.Configuration)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, err.Error())
+	}
+
+	for i, raw := range confdef.Servers {
+		c := newConfiguration()
+
+		if err := json.Unmarshal(base, &c.Configuration); err != nil {
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, err.Error())
+		}
+
+		// server identity and nested servers are not inherited
+		c.Name, c.Hostnames, c.Servers = "", nil, nil
+
+		if err := json.Unmarshal(raw, &c.Configuration); err != nil {
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, "server %d: %s", i+1, err.Error())
+		}
+		c.Servers = nil
+
+		// msh settings are shared by all servers
+		// (msh ports are inherited if not specified: servers on the same msh port are routed by hostname)
+		c.Msh.Debug, c.Msh.ID = ConfigRuntime.Msh.Debug, ConfigRuntime.Msh.ID
+
+		// check server name
+		if c.Name == "" {
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, "server %d: Name not specified", i+1)
+		}
+		for _, cs := range ConfigServers {
+			if strings.EqualFold(cs.Name, c.Name) {
+				return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, "server %d: Name %s already used", i+1, c.Name)
+			}
+		}
+		for _, cs := range ConfigServers {
+			if cs.Msh.MshPort == c.Msh.MshPort && len(c.Hostnames) == 0 {
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "server %s shares MshPort %d with %s but has no Hostnames: clients can't reach it", c.Name, c.Msh.MshPort, cs.Name)
+				break
+			}
+		}
+
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "loading config of minecraft server %s...", c.Name)
+
+		logMsh := c.setup(nil)
+		if logMsh != nil {
+			return logMsh.AddTrace()
+		}
+
+		// check that the server does not share the address with another server
+		// (servers on other hosts can listen on the same port, msh ports are compared only with the ports of local servers)
+		for _, cs := range ConfigServers {
+			switch {
+			case cs.ServPort == c.ServPort && sameHost(cs.ServHost, c.ServHost):
+				logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, "ServHost:ServPort of %s and %s appear to be the same, please change one of them", c.Name, cs.Name)
+				c.setMajorError(logMsh)
+			case cs.Msh.MshPort == c.ServPort && isLocalHost(c.ServHost), cs.ServPort == c.Msh.MshPort && isLocalHost(cs.ServHost):
+				logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, "ServPort and MshPort of %s and %s appear to be the same, please change one of them", c.Name, cs.Name)
+				c.setMajorError(logMsh)
+			}
+		}
+
+		ConfigServers = append(ConfigServers, c)
+	}
+
+	return nil
+}
+
+// setup checks the minecraft server of the runtime config and loads its parameters (ports, version, icon).
+//
+// Found ms version/protocol are saved to confdef (if not nil).
+func (c *Configuration) setup(confdef *Configuration) *errco.MshLog {
+	var logMsh *errco.MshLog
+
 	// ---------------- setup check ---------------- //
 
+	// check lifecycle mode
+	c.checkLifecycle()
+
 	// check if server folder/executeble exist
 	serverFileFolderPath := filepath.Join(c.Server.Folder, c.Server.FileName)
-	if _, err := os.Stat(serverFileFolderPath); os.IsNotExist(err) {
+	if c.Lifecycle.Mode != LIFECYCLE_PROCESS {
+		// ms is not started by msh: server folder/executable and eula.txt are not required
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "minecraft server not started by msh: server file and eula.txt checks skipped (%s)", c.Name)
+	} else if _, err := os.Stat(serverFileFolderPath); os.IsNotExist(err) {
 		// server folder/executeble does not exist
 
 		logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "specified minecraft server folder/file does not exist: %s", serverFileFolderPath)
-		servstats.Stats.SetMajorError(logMsh)
+		c.setMajorError(logMsh)
 	} else {
 		// server folder/executeble exist
 
@@ -269,7 +424,7 @@ func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 			fmt.Print(errco.COLOR_RESET) // reset color
 			if err != nil {
 				logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "couldn't start minecraft server to generate eula.txt (%s)", err.Error())
-				servstats.Stats.SetMajorError(logMsh)
+				c.setMajorError(logMsh)
 			}
 			fallthrough
 
@@ -277,7 +432,7 @@ func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 			// eula.txt exists but is not set to true
 
 			logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "please accept minecraft server eula.txt: %s", eulaFilePath)
-			servstats.Stats.SetMajorError(logMsh)
+			c.setMajorError(logMsh)
 
 		default:
 			// eula.txt exists and is set to true
@@ -287,10 +442,12 @@ func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 	}
 
 	// check if java is installed and get java version
-	_, err = exec.LookPath("java")
-	if err != nil {
+	// (not required if ms is not started by msh)
+	if c.Lifecycle.Mode != LIFECYCLE_PROCESS {
+		// java is not used by msh
+	} else if _, err := exec.LookPath("java"); err != nil {
 		logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "java not installed")
-		servstats.Stats.SetMajorError(logMsh)
+		c.setMajorError(logMsh)
 	} else if out, err := exec.Command("java", "--version").Output(); err != nil {
 		// non blocking error
 		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "could not execute 'java -version' command")
@@ -303,29 +460,31 @@ func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 
 	// load ports
 
-	// MshHost defined in global definition
-	MshPort = c.Msh.MshPort
-	MshPortQuery = c.Msh.MshPortQuery
-
-	// ServHost	defined in global definition
-	if ServPort != 0 {
+	// ServHost defined in config initialization or in lifecycle config
+	if c.Lifecycle.Host != "" {
+		c.ServHost = c.Lifecycle.Host
+	}
+	if c.ServPort != 0 {
 		// ServPort defined in msh start arguments
-	} else if ServPort, logMsh = c.ParsePropertiesInt("server-port"); logMsh != nil {
+	} else if c.Lifecycle.Port != 0 {
+		// ServPort defined in lifecycle config
+		c.ServPort = c.Lifecycle.Port
+	} else if c.ServPort, logMsh = c.ParsePropertiesInt("server-port"); logMsh != nil {
 		logMsh.Log(true)
-	} else if ServPort == c.Msh.MshPort {
+	} else if c.ServPort == c.Msh.MshPort && isLocalHost(c.ServHost) {
 		logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, "ServPort and MshPort appear to be the same, please change one of them")
-		servstats.Stats.SetMajorError(logMsh)
+		c.setMajorError(logMsh)
 	}
-	if ServPortQuery != 0 {
+	if c.ServPortQuery != 0 {
 		// ServPortQuery defined in msh start arguments
-	} else if ServPortQuery, logMsh = c.ParsePropertiesInt("query.port"); logMsh != nil {
+	} else if c.ServPortQuery, logMsh = c.ParsePropertiesInt("query.port"); logMsh != nil {
 		logMsh.Log(true)
-	} else if ServPortQuery == c.Msh.MshPortQuery {
+	} else if c.ServPortQuery == c.Msh.MshPortQuery {
 		logMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_CONFIG_LOAD, "ServPortQuery and MshPortQuery appear to be the same, please change one of them")
-		servstats.Stats.SetMajorError(logMsh)
+		c.setMajorError(logMsh)
 	}
 
-	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "msh connection  proxy setup: %10s:%5d --> %10s:%5d", MshHost, MshPort, ServHost, ServPort)
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "msh connection  proxy setup: %10s:%5d --> %10s:%5d (%s)", MshHost, c.Msh.MshPort, c.ServHost, c.ServPort, c.Name)
 
 	// check if queries are enabled by config, start arguments or ms config
 	if !c.Msh.EnableQuery {
@@ -339,25 +498,52 @@ func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "msh stats query proxy setup: disabled by minecraft server config")
 		c.Msh.EnableQuery = false
 	} else {
-		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "msh stats query proxy setup: %10s:%5d --> %10s:%5d", MshHost, MshPortQuery, ServHost, ServPortQuery)
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "msh stats query proxy setup: %10s:%5d --> %10s:%5d (%s)", MshHost, c.Msh.MshPortQuery, c.ServHost, c.ServPortQuery, c.Name)
 		c.Msh.EnableQuery = true
 	}
 
+	// check that msh rcon is protected by a password
+	if c.Msh.MshPortRcon != 0 && c.Msh.RconPassword == "" {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "msh rcon setup: disabled since RconPassword is not set (%s)", c.Name)
+		c.Msh.MshPortRcon = 0
+	} else if c.Msh.MshPortRcon != 0 {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "msh rcon setup: %10s:%5d (%s)", MshHost, c.Msh.MshPortRcon, c.Name)
+	}
+
 	// load ms version/protocol
-	c.Server.Version, c.Server.Protocol, logMsh = c.getVersionInfo()
+	version, prot, logMsh := c.getVersionInfo()
 	if logMsh != nil {
 		// just log it since ms version/protocol are not vital for the connection with clients
+		// (version/protocol specified in config are kept)
 		logMsh.Log(true)
-	} else if c.Server.Version == "" || c.Server.Protocol == -1 {
+	} else if version == "" || prot == -1 {
 		// found ms version/protocol are invalid
-		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_VERSION_LOAD, "version (%s) and protocol (%d) are invalid", c.Server.Version, c.Server.Protocol)
-	} else if confdef.Server.Version != c.Server.Version || confdef.Server.Protocol != c.Server.Protocol {
-		// replace found ms version/protocol in default config,
-		confdef.Server.Version = c.Server.Version
-		confdef.Server.Protocol = c.Server.Protocol
-		configDefaultSave = true
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_VERSION_LOAD, "version (%s) and protocol (%d) are invalid", version, prot)
+	} else {
+		c.Server.Version, c.Server.Protocol = version, prot
+
+		if confdef != nil && (confdef.Server.Version != c.Server.Version || confdef.Server.Protocol != c.Server.Protocol) {
+			// replace found ms version/protocol in default config,
+			// (only the version of the default minecraft server is saved to config file)
+			confdef.Server.Version = c.Server.Version
+			confdef.Server.Protocol = c.Server.Protocol
+			configDefaultSave = true
+		}
+	}
+
+	// complete ms version/protocol with the known protocol versions
+	c.completeVersion()
+
+	// check accepted protocol ranges
+	for _, r := range c.Msh.AcceptedProtocols {
+		if _, _, ok := protocol.ParseRange(r); !ok {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_CONFIG_CHECK, "accepted protocol range %q is not valid (ignored)", r)
+		}
 	}
 
+	// check client-facing message templates
+	c.checkMessages()
+
 	// load server icon
 	logMsh = c.loadIcon()
 	if logMsh != nil {
@@ -365,5 +551,8 @@ func (c *Configuration) loadRuntime(confdef *Configuration) *errco.MshLog {
 		logMsh.Log(true)
 	}
 
+	// load whitelist rules (resolve whitelist hostnames)
+	c.LoadWhitelist()
+
 	return nil
 }
@@ -0,0 +1,383 @@
+package conn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"msh/lib/chat"
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/servctrl"
+	"msh/lib/traffic"
+)
+
+// reference:
+// - wiki.vg/Raknet_Protocol
+// - wiki.vg/Bedrock_Protocol
+
+// raknet packet ids
+const (
+	ID_UNCONNECTED_PING             byte = 0x01
+	ID_UNCONNECTED_PING_OPEN        byte = 0x02
+	ID_OPEN_CONNECTION_REQUEST_1    byte = 0x05
+	ID_NO_FREE_INCOMING_CONNECTIONS byte = 0x14
+	ID_UNCONNECTED_PONG             byte = 0x1c
+)
+
+const (
+	bedrockProtocol    int           = 712              // bedrock protocol reported while ms is not warm
+	bedrockVersion     string        = "1.21.20"        // bedrock version reported while ms is not warm
+	bedrockSessionIdle time.Duration = 30 * time.Second // time without datagrams after which a bedrock session is closed
+	bedrockBufSize     int           = 2048             // datagram buffer size (greater than raknet max mtu)
+	bedrockMaxSessions int           = 256              // max forwarding sessions (the least recently active session is closed to open a new one)
+	bedrockWarmDelay   time.Duration = 10 * time.Second // time during which the connection requests of a client address after the first one are not handled
+)
+
+// raknetMagic is the sequence of bytes contained in raknet offline messages
+var raknetMagic []byte = []byte{0x00, 0xff, 0xff, 0x00, 0xfe, 0xfe, 0xfe, 0xfe, 0xfd, 0xfd, 0xfd, 0xfd, 0x12, 0x34, 0x56, 0x78}
+
+// bedrock handles the bedrock edition clients of a minecraft server
+type bedrock struct {
+	ms       *servctrl.Server
+	connCli  net.PacketConn             // msh bedrock listener
+	guid     int64                      // raknet server guid reported while ms is not warm
+	m        *sync.Mutex                // protects sessions and requests
+	sessions map[string]*bedrockSession // forwarding sessions by client address
+	requests map[string]time.Time       // time of the last handled connection request by client host
+	maxSess  int                        // max forwarding sessions
+}
+
+// bedrockSession forwards the datagrams of a bedrock client to ms
+type bedrockSession struct {
+	addrCli net.Addr      // client address
+	connSer net.Conn      // connection to ms bedrock port
+	tc      *traffic.Conn // session traffic
+	last    time.Time     // time of the last datagram (protected by bedrock.m)
+	once    *sync.Once    // closes the session once
+}
+
+// HandlerBedrock handles bedrock edition (RakNet) datagrams for the specified minecraft server.
+//
+// Accepts datagrams on config.MshHost, ms.Config.Msh.MshPortBedrock.
+// While ms is not warm, pings are answered with the hibernation/starting info and connection requests warm ms.
+// While ms is warm, datagrams are forwarded to ms.Config.Msh.ServPortBedrock (a session for each client address).
+// [goroutine]
+func HandlerBedrock(ms *servctrl.Server) {
+	connCli, err := net.ListenPacket("udp", net.JoinHostPort(config.MshHost, strconv.Itoa(ms.Config.Msh.MshPortBedrock)))
+	if err != nil {
+		errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CLIENT_LISTEN, err.Error())
+		return
+	}
+
+	b := newBedrock(ms, connCli)
+	go b.cleaner()
+
+	// infinite cycle to handle bedrock clients datagrams
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "%-40s %10s:%5d ...", "listening for new bedrock clients on", config.MshHost, ms.Config.Msh.MshPortBedrock)
+	for {
+		buf := make([]byte, bedrockBufSize)
+		n, addrCli, err := connCli.ReadFrom(buf)
+		if err != nil {
+			errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONN_READ, err.Error())
+			continue
+		}
+
+		logMsh := b.handle(addrCli, buf[:n])
+		if logMsh != nil {
+			logMsh.Log(true)
+		}
+	}
+}
+
+// newBedrock returns a bedrock handler without sessions
+func newBedrock(ms *servctrl.Server, connCli net.PacketConn) *bedrock {
+	return &bedrock{
+		ms:       ms,
+		connCli:  connCli,
+		guid:     rand.New(rand.NewSource(time.Now().UnixNano())).Int63(),
+		m:        &sync.Mutex{},
+		sessions: map[string]*bedrockSession{},
+		requests: map[string]time.Time{},
+		maxSess:  bedrockMaxSessions,
+	}
+}
+
+// handle handles a datagram received from a bedrock client
+func (b *bedrock) handle(addrCli net.Addr, data []byte) *errco.MshLog {
+	if len(data) == 0 {
+		return nil
+	}
+
+	// if ms is warm forward the datagram to ms
+	if b.ms.CheckMSWarm() == nil {
+		s, logMsh := b.session(addrCli)
+		if logMsh != nil {
+			return logMsh.AddTrace()
+		}
+
+		_, err := s.connSer.Write(data)
+		if err != nil {
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONN_WRITE, err.Error())
+		}
+		b.ms.Stats.BytesToServer.Add(int64(len(data)))
+		s.tc.ToServer.Add(int64(len(data)))
+
+		return nil
+	}
+
+	// ms is not warm: sessions can't be used anymore
+	b.closeSession(addrCli.String())
+
+	switch data[0] {
+	case ID_UNCONNECTED_PING, ID_UNCONNECTED_PING_OPEN:
+		// unconnected ping: [ id | time (int64) | magic | client guid (int64) ]
+		if len(data) < 1+8+len(raknetMagic) || !bytes.Equal(data[9:9+len(raknetMagic)], raknetMagic) {
+			return nil
+		}
+
+		mes := b.pong(data[1:9])
+		errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> bedrock client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+		_, err := b.connCli.WriteTo(mes, addrCli)
+		if err != nil {
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONN_WRITE, err.Error())
+		}
+
+	case ID_OPEN_CONNECTION_REQUEST_1:
+		// open connection request 1: [ id | magic | protocol | mtu padding ]
+		if len(data) < 1+len(raknetMagic) || !bytes.Equal(data[1:1+len(raknetMagic)], raknetMagic) {
+			return nil
+		}
+
+		// the client is refused while ms is not warm:
+		// it's informed that ms is starting by the info of the following pings
+		defer func() {
+			mes := append(append([]byte{ID_NO_FREE_INCOMING_CONNECTIONS}, raknetMagic...), binary.BigEndian.AppendUint64(nil, uint64(b.guid))...)
+			b.connCli.WriteTo(mes, addrCli)
+		}()
+
+		// raknet clients send several connection requests for each connection attempt (mtu discovery and retries):
+		// only the first request of the client address is handled
+		clientAddress, _, _ := net.SplitHostPort(addrCli.String())
+		if !b.firstRequest(clientAddress) {
+			return nil
+		}
+
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "a bedrock client tried to join from %s to %s:%d", clientAddress, b.ms.Config.ServHost, b.ms.Config.Msh.ServPortBedrock)
+
+		// bedrock player names are not known before connecting: only the client address is checked
+		logMsh := b.ms.Config.IsWhitelist("", "", clientAddress)
+		if logMsh != nil {
+			return logMsh.AddTrace()
+		}
+
+		// only connection requests that start ms are warm attempts
+		if b.ms.Stats.Status.Load() == errco.SERVER_STATUS_OFFLINE {
+			logMsh = lim.admitWarm(b.ms.Config, clientAddress)
+			if logMsh != nil {
+				return logMsh.AddTrace()
+			}
+		}
+
+		logMsh = b.ms.WarmMS()
+		if logMsh != nil {
+			return logMsh.AddTrace()
+		}
+	}
+
+	return nil
+}
+
+// pong returns the unconnected pong that answers an unconnected ping while ms is not warm
+func (b *bedrock) pong(pingTime []byte) []byte {
+	var mes string
+	switch {
+	case b.ms.Stats.MajorError != nil:
+		mes = message(b.ms, nil, config.MSG_MAJOR_ERROR)
+	case b.ms.Stats.Status.Load() == errco.SERVER_STATUS_STARTING:
+		mes = render(b.ms, nil, b.ms.Config.Msh.InfoStarting)
+	case b.ms.Stats.Status.Load() == errco.SERVER_STATUS_STOPPING:
+		mes = message(b.ms, nil, config.MSG_STOPPING)
+	default:
+		mes = render(b.ms, nil, b.ms.Config.Msh.InfoHibernation)
+	}
+
+	// bedrock clients show 2 lines: the server name and the world name
+	lines := strings.SplitN(chat.Parse(strings.ReplaceAll(mes, "\\n", "\n")).Legacy(), "\n", 2)
+	for i := range lines {
+		lines[i] = strings.ReplaceAll(strings.TrimSpace(lines[i]), ";", ",")
+	}
+	if len(lines) == 1 {
+		lines = append(lines, "msh")
+	}
+
+	maxPlayers, _ := playersInfo(b.ms.Config)
+
+	// server id string: MCPE;motd;protocol;version;online;max;guid;world;gamemode;gamemode id;port ipv4;port ipv6;
+	id := fmt.Sprintf("MCPE;%s;%d;%s;%d;%d;%d;%s;Survival;1;%d;%d;", lines[0], bedrockProtocol, bedrockVersion, 0, maxPlayers, b.guid, lines[1], b.ms.Config.Msh.MshPortBedrock, b.ms.Config.Msh.MshPortBedrock)
+
+	// unconnected pong: [ id | time (int64) | server guid (int64) | magic | server id string (short length) ]
+	buf := bytes.NewBuffer([]byte{ID_UNCONNECTED_PONG})
+	buf.Write(pingTime)
+	buf.Write(binary.BigEndian.AppendUint64(nil, uint64(b.guid)))
+	buf.Write(raknetMagic)
+	buf.Write(binary.BigEndian.AppendUint16(nil, uint16(len(id))))
+	buf.WriteString(id)
+
+	return buf.Bytes()
+}
+
+// firstRequest returns true if the connection request of the client host is the first one in bedrockWarmDelay
+func (b *bedrock) firstRequest(clientAddress string) bool {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if last, ok := b.requests[clientAddress]; ok && time.Since(last) < bedrockWarmDelay {
+		return false
+	}
+
+	// requests of client hosts are not recorded over the max number of sessions
+	// (the requests of spoofed addresses can't grow the requests without limit)
+	if len(b.requests) < b.maxSess {
+		b.requests[clientAddress] = time.Now()
+	}
+
+	return true
+}
+
+// session returns the forwarding session of the client address.
+// A new session is opened if not existing and if the client address is not banned or exceeding the connection rate
+// (if the max number of sessions is reached, the least recently active session is closed).
+func (b *bedrock) session(addrCli net.Addr) (*bedrockSession, *errco.MshLog) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if s, ok := b.sessions[addrCli.String()]; ok {
+		s.last = time.Now()
+		return s, nil
+	}
+
+	clientAddress, _, _ := net.SplitHostPort(addrCli.String())
+	logMsh := lim.admitAddress(b.ms.Config, clientAddress)
+	if logMsh != nil {
+		return nil, logMsh.AddTrace()
+	}
+
+	if len(b.sessions) >= b.maxSess {
+		var oldest *bedrockSession
+		for _, s := range b.sessions {
+			if oldest == nil || s.last.Before(oldest.last) {
+				oldest = s
+			}
+		}
+		delete(b.sessions, oldest.addrCli.String())
+		oldest.close()
+	}
+
+	connSer, err := net.Dial("udp", net.JoinHostPort(b.ms.Config.ServHost, strconv.Itoa(b.ms.Config.Msh.ServPortBedrock)))
+	if err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_DIAL, err.Error())
+	}
+
+	s := &bedrockSession{
+		addrCli: addrCli,
+		connSer: connSer,
+		tc:      traffic.Open(b.ms.Config.Name, addrCli.String(), ""),
+		last:    time.Now(),
+		once:    &sync.Once{},
+	}
+	b.sessions[addrCli.String()] = s
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "bedrock session opened: %s <--> %s", addrCli, connSer.RemoteAddr())
+
+	go b.forwardToClient(s)
+
+	return s, nil
+}
+
+// forwardToClient forwards the datagrams of ms to the session client until the session is closed.
+// [goroutine]
+func (b *bedrock) forwardToClient(s *bedrockSession) {
+	buf := make([]byte, bedrockBufSize)
+	for {
+		n, err := s.connSer.Read(buf)
+		if err != nil {
+			// session closed (or ms bedrock port unreachable)
+			// (the client address might have a new session if this one was closed)
+			b.m.Lock()
+			if b.sessions[s.addrCli.String()] == s {
+				delete(b.sessions, s.addrCli.String())
+			}
+			b.m.Unlock()
+			s.close()
+			return
+		}
+
+		_, err = b.connCli.WriteTo(buf[:n], s.addrCli)
+		if err != nil {
+			errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONN_WRITE, err.Error())
+			continue
+		}
+		b.ms.Stats.BytesToClients.Add(int64(n))
+		s.tc.ToClient.Add(int64(n))
+
+		b.m.Lock()
+		s.last = time.Now()
+		b.m.Unlock()
+	}
+}
+
+// closeSession closes the forwarding session of the client address (if existing)
+func (b *bedrock) closeSession(addrCli string) {
+	b.m.Lock()
+	s, ok := b.sessions[addrCli]
+	delete(b.sessions, addrCli)
+	b.m.Unlock()
+
+	if ok {
+		s.close()
+	}
+}
+
+// close closes the connection to ms and the traffic of the session
+func (s *bedrockSession) close() {
+	s.once.Do(func() {
+		s.connSer.Close()
+		s.tc.Close()
+
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "bedrock session closed: %s", s.addrCli)
+	})
+}
+
+// cleaner closes the sessions that did not forward datagrams for bedrockSessionIdle
+// and removes the expired connection requests.
+// [goroutine]
+func (b *bedrock) cleaner() {
+	for {
+		time.Sleep(bedrockSessionIdle / 2)
+
+		idle := []string{}
+		b.m.Lock()
+		for addr, s := range b.sessions {
+			if time.Since(s.last) > bedrockSessionIdle {
+				idle = append(idle, addr)
+			}
+		}
+		for addr, last := range b.requests {
+			if time.Since(last) >= bedrockWarmDelay {
+				delete(b.requests, addr)
+			}
+		}
+		b.m.Unlock()
+
+		for _, addr := range idle {
+			b.closeSession(addr)
+		}
+	}
+}
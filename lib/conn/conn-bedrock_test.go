@@ -0,0 +1,160 @@
+package conn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/servctrl"
+)
+
+// udpListen returns a udp listener on a random local port
+func udpListen(t *testing.T) net.PacketConn {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+// udpRead reads a datagram with a timeout
+func udpRead(t *testing.T, l net.PacketConn) ([]byte, net.Addr) {
+	buf := make([]byte, bedrockBufSize)
+	l.SetReadDeadline(time.Now().Add(time.Second))
+	n, addr, err := l.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf[:n], addr
+}
+
+func Test_bedrock(t *testing.T) {
+	c := &config.Configuration{}
+	c.Server.Folder = t.TempDir()
+	c.ServHost = "127.0.0.1"
+	c.Msh.InfoHibernation = "§fserver status:\n§b§lHIBERNATING"
+	ms := servctrl.NewServer(c)
+
+	mshConn, clientConn, serverConn := udpListen(t), udpListen(t), udpListen(t)
+	c.Msh.ServPortBedrock = serverConn.LocalAddr().(*net.UDPAddr).Port
+	b := newBedrock(ms, mshConn)
+
+	// unconnected ping is answered while ms is hibernating
+	ping := append(append([]byte{ID_UNCONNECTED_PING, 0, 0, 0, 0, 0, 0, 0, 42}, raknetMagic...), 0, 0, 0, 0, 0, 0, 0, 1)
+	if logMsh := b.handle(clientConn.LocalAddr(), ping); logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	pong, _ := udpRead(t, clientConn)
+	if pong[0] != ID_UNCONNECTED_PONG || binary.BigEndian.Uint64(pong[1:9]) != 42 || !bytes.Equal(pong[17:33], raknetMagic) {
+		t.Fatalf("unexpected unconnected pong: %v", pong)
+	}
+	if id := string(pong[35:]); !strings.HasPrefix(id, "MCPE;§fserver status:;") || !strings.Contains(id, ";0;20;") || !strings.Contains(id, ";§b§lHIBERNATING;") {
+		t.Errorf("unexpected server id: %q", id)
+	}
+
+	// datagrams are forwarded while ms is warm
+	ms.Term.IsActive.Store(true)
+	ms.Stats.Status.Store(errco.SERVER_STATUS_ONLINE)
+	if logMsh := b.handle(clientConn.LocalAddr(), []byte("hello")); logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	data, sessionAddr := udpRead(t, serverConn)
+	if string(data) != "hello" {
+		t.Errorf("ms received %q (expected hello)", data)
+	}
+
+	serverConn.WriteTo([]byte("world"), sessionAddr)
+	if data, _ := udpRead(t, clientConn); string(data) != "world" {
+		t.Errorf("client received %q (expected world)", data)
+	}
+
+	// sessions are closed when ms is not warm anymore
+	ms.Stats.Status.Store(errco.SERVER_STATUS_OFFLINE)
+	b.handle(clientConn.LocalAddr(), []byte{0xff})
+	if len(b.sessions) != 0 {
+		t.Errorf("session not closed while ms is offline")
+	}
+}
+
+func Test_bedrockWarmAttempts(t *testing.T) {
+	defer func(l *limits) { lim = l }(lim)
+	lim = newLimits()
+
+	c := &config.Configuration{}
+	c.Server.Folder = t.TempDir()
+	c.ServHost = "127.0.0.1"
+	c.Msh.MaxWarmPerIP = 1
+	c.Msh.BanDuration = 60
+	ms := servctrl.NewServer(c)
+	ms.Stats.SetMajorError(errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_MINECRAFT_SERVER, "ms can't be started by the test"))
+
+	mshConn, clientConn := udpListen(t), udpListen(t)
+	b := newBedrock(ms, mshConn)
+	ocr1 := append(append([]byte{ID_OPEN_CONNECTION_REQUEST_1}, raknetMagic...), 11, 0, 0, 0)
+
+	// the connection requests of a connection attempt are a single warm attempt
+	for i := 0; i < 5; i++ {
+		b.handle(clientConn.LocalAddr(), ocr1)
+		if refusal, _ := udpRead(t, clientConn); refusal[0] != ID_NO_FREE_INCOMING_CONNECTIONS {
+			t.Fatalf("connection request %d not refused: %v", i, refusal)
+		}
+	}
+	if hits := len(lim.warmHits["127.0.0.1"]); hits != 1 {
+		t.Errorf("%d warm attempts counted for one connection attempt", hits)
+	}
+
+	// connection requests while ms is starting are not warm attempts
+	lim = newLimits()
+	b.requests = map[string]time.Time{}
+	ms.Stats.Status.Store(errco.SERVER_STATUS_STARTING)
+	b.handle(clientConn.LocalAddr(), ocr1)
+	udpRead(t, clientConn)
+	if hits := len(lim.warmHits["127.0.0.1"]); hits != 0 {
+		t.Errorf("%d warm attempts counted while ms is starting", hits)
+	}
+}
+
+func Test_bedrockSessions(t *testing.T) {
+	defer func(l *limits) { lim = l }(lim)
+	lim = newLimits()
+
+	c := &config.Configuration{}
+	c.Server.Folder = t.TempDir()
+	c.ServHost = "127.0.0.1"
+	ms := servctrl.NewServer(c)
+	ms.Term.IsActive.Store(true)
+	ms.Stats.Status.Store(errco.SERVER_STATUS_ONLINE)
+
+	mshConn, serverConn := udpListen(t), udpListen(t)
+	c.Msh.ServPortBedrock = serverConn.LocalAddr().(*net.UDPAddr).Port
+	b := newBedrock(ms, mshConn)
+	b.maxSess = 2
+
+	// the least recently active session is closed when the max number of sessions is reached
+	clients := []net.Addr{udpListen(t).LocalAddr(), udpListen(t).LocalAddr(), udpListen(t).LocalAddr()}
+	for _, addrCli := range clients {
+		if logMsh := b.handle(addrCli, []byte("hello")); logMsh != nil {
+			t.Fatalf(logMsh.Mex, logMsh.Arg...)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	b.m.Lock()
+	_, first := b.sessions[clients[0].String()]
+	count := len(b.sessions)
+	b.m.Unlock()
+	if count != 2 || first {
+		t.Errorf("%d sessions open (first session open: %t)", count, first)
+	}
+
+	// banned client addresses can't open sessions
+	lim.bans["127.0.0.1"] = time.Now().Add(time.Minute)
+	if logMsh := b.handle(udpListen(t).LocalAddr(), []byte("hello")); logMsh == nil || logMsh.Cod != errco.ERROR_CONN_BANNED {
+		t.Errorf("banned client address opened a session (%v)", logMsh)
+	}
+}
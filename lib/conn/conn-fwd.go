@@ -0,0 +1,172 @@
+package conn
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"msh/lib/errco"
+	"msh/lib/servctrl"
+	"msh/lib/traffic"
+)
+
+const (
+	fwdChunk int64         = 64 * 1024   // max bytes copied by a single forward iteration
+	fwdTick  time.Duration = time.Second // max time a single forward iteration waits for data (byte counters are updated at least every fwdTick)
+)
+
+// proxy forwards data between client and minecraft server until both directions are closed.
+//
+// req is used to decide if connection should be counted in ms.Stats.ConnCount
+// and to know the player name for traffic accounting.
+func proxy(ms *servctrl.Server, clientConn, serverConn net.Conn, req *clientReq) {
+	// if client has requested ms join, change connection count
+	if req.reqType == errco.CLIENT_REQ_JOIN {
+		ms.Stats.ConnCount++
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "A CLIENT CONNECTED TO THE SERVER! (join req) - %d active connections", ms.Stats.ConnCount)
+
+		defer func() {
+			ms.Stats.ConnCount--
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "A CLIENT DISCONNECTED FROM THE SERVER! (join req) - %d active connections", ms.Stats.ConnCount)
+
+			ms.FreezeMSSchedule()
+		}()
+	}
+
+	// remove deadlines set while reading client request
+	clientConn.SetDeadline(time.Time{})
+
+	setKeepAlive(clientConn, ms.Config.Msh.ConnKeepAlive)
+	setKeepAlive(serverConn, ms.Config.Msh.ConnKeepAlive)
+
+	// track connection traffic
+	var player string
+	if req.loginStart != nil {
+		player = req.loginStart.Name
+	}
+	tc := traffic.Open(ms.Config.Name, clientConn.RemoteAddr().String(), player)
+	defer tc.Close()
+
+	idle := time.Duration(ms.Config.Msh.ConnIdleTimeout) * time.Second
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		forward(clientConn, serverConn, idle, "client --> server", &ms.Stats.BytesToServer, &tc.ToServer)
+	}()
+	go func() {
+		defer wg.Done()
+		forward(serverConn, clientConn, idle, "server --> client", &ms.Stats.BytesToClients, &tc.ToClient)
+	}()
+	wg.Wait()
+
+	// close the source/destination connections
+	_ = clientConn.Close()
+	_ = serverConn.Close()
+}
+
+// forward copies data from source to destination and adds the bytes copied to counters.
+//
+// When source reaches EOF the write side of destination is closed (half-close) and the other direction keeps flowing.
+// On errors, or when no data is received for longer than idle (idle <= 0 disables the timeout), both connections are closed.
+//
+// Data is copied between the underlying *net.TCPConn so that the kernel can splice it (linux).
+func forward(source, destination net.Conn, idle time.Duration, direction string, counters ...*atomic.Int64) {
+	addrs := strings.Split(source.RemoteAddr().String(), ":")[0] + " --> " + strings.Split(destination.RemoteAddr().String(), ":")[0]
+
+	// data already buffered while decoding the client request must be forwarded first
+	if bc, ok := source.(*bufConn); ok {
+		if n := bc.r.Buffered(); n > 0 {
+			data, _ := bc.r.Peek(n)
+			w, err := destination.Write(data)
+			count(counters, int64(w))
+			if err != nil {
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CONN_WRITE, "closing %s | %s (cause: %s)", addrs, direction, err.Error())
+				_ = destination.Close()
+				_ = source.Close()
+				return
+			}
+			bc.r.Discard(n)
+		}
+	}
+	source, destination = rawConn(source), rawConn(destination)
+
+	lastData := time.Now()
+	for {
+		source.SetReadDeadline(time.Now().Add(fwdTick))
+
+		// io.Copy uses destination ReadFrom: *net.TCPConn -> *net.TCPConn copies are spliced
+		n, err := io.Copy(destination, &io.LimitedReader{R: source, N: fwdChunk})
+		count(counters, n)
+		if n > 0 {
+			lastData = time.Now()
+		}
+
+		switch {
+		case err == nil && n < fwdChunk:
+			// source EOF: propagate it to destination
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_CONN_EOF, "half-closing %s | %s", addrs, direction)
+			if tcpConn, ok := destination.(*net.TCPConn); ok {
+				_ = tcpConn.CloseWrite()
+			} else {
+				_ = destination.Close()
+			}
+			return
+
+		case err == nil:
+			// chunk copied, continue
+
+		case errors.Is(err, os.ErrDeadlineExceeded):
+			if idle > 0 && time.Since(lastData) > idle {
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CONN_IDLE, "closing %s | %s (cause: no data for %s)", addrs, direction, idle)
+				_ = destination.Close()
+				_ = source.Close()
+				return
+			}
+
+		default:
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CONN_EOF, "closing %s | %s (cause: %s)", addrs, direction, err.Error())
+			_ = destination.Close()
+			_ = source.Close()
+			return
+		}
+	}
+}
+
+// count adds n to each counter
+func count(counters []*atomic.Int64, n int64) {
+	for _, c := range counters {
+		c.Add(n)
+	}
+}
+
+// rawConn returns the connection wrapped by a bufConn (buffered data must be consumed before using it)
+func rawConn(c net.Conn) net.Conn {
+	if bc, ok := c.(*bufConn); ok {
+		return bc.Conn
+	}
+	return c
+}
+
+// setKeepAlive sets the tcp keepalive period (seconds) of the connection.
+// 0 leaves the system default, < 0 disables tcp keepalive.
+func setKeepAlive(c net.Conn, period int) {
+	tcpConn, ok := rawConn(c).(*net.TCPConn)
+	if !ok {
+		return
+	}
+
+	switch {
+	case period < 0:
+		_ = tcpConn.SetKeepAlive(false)
+	case period > 0:
+		_ = tcpConn.SetKeepAlive(true)
+		_ = tcpConn.SetKeepAlivePeriod(time.Duration(period) * time.Second)
+	}
+}
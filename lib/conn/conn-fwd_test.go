@@ -0,0 +1,112 @@
+package conn
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"msh/lib/errco"
+	"msh/lib/servctrl"
+)
+
+// tcpPair returns the two ends of a loopback tcp connection
+func tcpPair(t *testing.T) (*net.TCPConn, *net.TCPConn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	dialed, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dialed.(*net.TCPConn), accepted.(*net.TCPConn)
+}
+
+func Test_proxy(t *testing.T) {
+	ms := servctrl.Servers[0]
+
+	client, clientConn := tcpPair(t)
+	serverConn, server := tcpPair(t)
+
+	// "hello" is buffered while msh decodes the client request
+	client.Write([]byte("hello"))
+	bc := bufferConn(clientConn)
+	if _, err := bc.r.Peek(5); err != nil {
+		t.Fatal(err)
+	}
+
+	ms.Stats.BytesToServer.Store(0)
+	ms.Stats.BytesToClients.Store(0)
+
+	done := make(chan bool)
+	go func() {
+		proxy(ms, bc, serverConn, &clientReq{reqType: errco.CLIENT_REQ_INFO})
+		done <- true
+	}()
+
+	// client half-closes after sending its data: server must receive EOF
+	client.Write([]byte(" world"))
+	client.CloseWrite()
+
+	server.SetDeadline(time.Now().Add(5 * time.Second))
+	data, err := io.ReadAll(server)
+	if err != nil || string(data) != "hello world" {
+		t.Fatalf("server received %q (err: %v)", data, err)
+	}
+
+	// server can still answer the half-closed client
+	server.Write([]byte("pong"))
+	server.Close()
+
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	data, err = io.ReadAll(client)
+	if err != nil || string(data) != "pong" {
+		t.Fatalf("client received %q (err: %v)", data, err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("proxy did not return after both directions were closed")
+	}
+
+	if b := ms.Stats.BytesToServer.Load(); b != 11 {
+		t.Errorf("bytes to server counted: %d (expected 11)", b)
+	}
+	if b := ms.Stats.BytesToClients.Load(); b != 4 {
+		t.Errorf("bytes to clients counted: %d (expected 4)", b)
+	}
+}
+
+func Test_forwardIdle(t *testing.T) {
+	_, source := tcpPair(t)
+	destination, peer := tcpPair(t)
+
+	var counter atomic.Int64
+	done := make(chan bool)
+	go func() {
+		forward(source, destination, time.Second, "test", &counter)
+		done <- true
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("idle connection was not closed")
+	}
+
+	// destination peer receives EOF since destination is closed
+	peer.SetDeadline(time.Now().Add(time.Second))
+	if _, err := peer.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("destination was not closed (err: %v)", err)
+	}
+}
@@ -0,0 +1,151 @@
+package conn
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"msh/lib/chat"
+	"msh/lib/config"
+	"msh/lib/conn/protocol"
+	"msh/lib/errco"
+)
+
+// reference:
+// - wiki.vg/Server_List_Ping#1.6
+// - wiki.vg/Server_List_Ping#1.4_to_1.5
+// - wiki.vg/Server_List_Ping#Beta_1.8_to_1.3
+
+// legacy server list ping variants
+const (
+	legacyNone int = iota // modern handshake
+	legacyBeta            // 0xFE (beta 1.8 - 1.3)
+	legacy14              // 0xFE 0x01 (1.4 - 1.5)
+	legacy16              // 0xFE 0x01 0xFA "MC|PingHost" (1.6)
+)
+
+const (
+	legacyWait     time.Duration = 200 * time.Millisecond // time to wait for the bytes following 0xFE before assuming an older ping variant
+	legacyProtocol int32         = 127                    // protocol reported to legacy clients (makes them show the version name)
+	legacyPingHost string        = "MC|PingHost"          // plugin channel of 1.6 ping
+)
+
+// getLegacyReq reads a legacy (pre-1.7) server list ping and returns the decoded client request.
+// The first byte available from the buffered connection must be 0xFE.
+func getLegacyReq(bc *bufConn) (*clientReq, *errco.MshLog) {
+	req := &clientReq{
+		reqType:   errco.CLIENT_REQ_INFO,
+		legacy:    legacyBeta,
+		handshake: &protocol.Handshake{NextState: protocol.STATE_STATUS},
+	}
+
+	bc.r.Discard(1)
+	req.raw = []byte{0xFE}
+
+	// beta clients send only 0xFE and 1.4 clients only 0xFE 0x01:
+	// don't wait too long for bytes that might not come
+	bc.SetDeadline(time.Now().Add(legacyWait))
+	if b, err := bc.r.Peek(1); err != nil || b[0] != 0x01 {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "client legacy ping (beta 1.8 - 1.3)")
+		return req, nil
+	}
+	bc.r.Discard(1)
+	req.raw = append(req.raw, 0x01)
+	req.legacy = legacy14
+
+	if b, err := bc.r.Peek(1); err != nil || b[0] != 0xFA {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "client legacy ping (1.4 - 1.5)")
+		return req, nil
+	}
+	req.legacy = legacy16
+
+	// read plugin message: [ 0xFA | channel (short length + UTF-16BE) | data (short length + bytes) ]
+	bc.SetDeadline(time.Now().Add(1 * time.Second))
+	read := func(n int) ([]byte, error) {
+		b := make([]byte, n)
+		_, err := io.ReadFull(bc.r, b)
+		req.raw = append(req.raw, b...)
+		return b, err
+	}
+
+	header, err := read(3)
+	if err != nil {
+		return req, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CLIENT_REQ, "client request unknown (legacy ping plugin message: %s)", err.Error())
+	}
+	channel, err := read(2 * int(binary.BigEndian.Uint16(header[1:])))
+	if err != nil || decodeUTF16BE(channel) != legacyPingHost {
+		return req, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CLIENT_REQ, "client request unknown (legacy ping plugin message channel: %q)", decodeUTF16BE(channel))
+	}
+	dataLen, err := read(2)
+	if err != nil {
+		return req, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CLIENT_REQ, "client request unknown (legacy ping plugin message: %s)", err.Error())
+	}
+	data, err := read(int(binary.BigEndian.Uint16(dataLen)))
+	if err != nil {
+		return req, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CLIENT_REQ, "client request unknown (legacy ping plugin message: %s)", err.Error())
+	}
+
+	// decode plugin message data: [ protocol (byte) | hostname (short length + UTF-16BE) | port (int) ]
+	if len(data) >= 3 {
+		req.handshake.ProtocolVersion = int32(data[0])
+		hostLen := 2 * int(binary.BigEndian.Uint16(data[1:3]))
+		if len(data) >= 3+hostLen+4 {
+			req.handshake.ServerAddress = decodeUTF16BE(data[3 : 3+hostLen])
+			req.handshake.ServerPort = uint16(binary.BigEndian.Uint32(data[3+hostLen:]))
+		}
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "client legacy ping (1.6): protocol %d, address %s:%d", req.handshake.ProtocolVersion, req.handshake.ServerAddress, req.handshake.ServerPort)
+
+	return req, nil
+}
+
+// buildLegacyMessage returns the legacy kick packet that answers a legacy server list ping.
+// message can be a JSON text component or a text with legacy formatting codes.
+func buildLegacyMessage(c *config.Configuration, req *clientReq, message string) []byte {
+	// replace "\\n" with "\n" in case the new line was set as msh parameter
+	message = strings.ReplaceAll(message, "\\n", "\n")
+
+	// legacy clients show the description on a single line
+	motd := chat.Parse(message)
+	maxPlayers, _ := playersInfo(c)
+
+	var s string
+	switch req.legacy {
+	case legacyBeta:
+		// formatting codes are not supported and "§" separates the fields
+		s = fmt.Sprintf("%s§%d§%d", singleLine(motd.Plain()), 0, maxPlayers)
+	default:
+		prot := legacyProtocol
+		if c.Msh.ProtocolEcho && req.handshake.ProtocolVersion > 0 {
+			prot = req.handshake.ProtocolVersion
+		}
+		s = fmt.Sprintf("§1\x00%d\x00%s\x00%s\x00%d\x00%d", prot, c.Server.Version, singleLine(motd.Legacy()), 0, maxPlayers)
+	}
+
+	// kick packet: [ 0xFF | length (short, in characters) | UTF-16BE string ]
+	units := utf16.Encode([]rune(s))
+	b := []byte{0xFF, byte(len(units) >> 8), byte(len(units))}
+	for _, u := range units {
+		b = append(b, byte(u>>8), byte(u))
+	}
+
+	return b
+}
+
+// singleLine joins the lines of s collapsing repeated spaces
+func singleLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// decodeUTF16BE decodes a UTF-16BE string
+func decodeUTF16BE(b []byte) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = binary.BigEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
@@ -0,0 +1,94 @@
+package conn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"unicode/utf16"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+)
+
+// utf16BE returns s encoded as UTF-16BE
+func utf16BE(s string) []byte {
+	b := []byte{}
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(u>>8), byte(u))
+	}
+	return b
+}
+
+func Test_getLegacyReq(t *testing.T) {
+	// 1.6 ping: 0xFE 0x01 0xFA "MC|PingHost" [ protocol | hostname | port ]
+	data := []byte{78}
+	data = binary.BigEndian.AppendUint16(data, uint16(len("mc.example.com")))
+	data = append(data, utf16BE("mc.example.com")...)
+	data = binary.BigEndian.AppendUint32(data, 25565)
+	ping16 := []byte{0xFE, 0x01, 0xFA}
+	ping16 = binary.BigEndian.AppendUint16(ping16, uint16(len(legacyPingHost)))
+	ping16 = append(ping16, utf16BE(legacyPingHost)...)
+	ping16 = binary.BigEndian.AppendUint16(ping16, uint16(len(data)))
+	ping16 = append(ping16, data...)
+
+	type test struct {
+		title     string
+		ping      []byte
+		expLegacy int
+	}
+
+	var tests []test = []test{
+		{"beta 1.8 - 1.3", []byte{0xFE}, legacyBeta},
+		{"1.4 - 1.5", []byte{0xFE, 0x01}, legacy14},
+		{"1.6", ping16, legacy16},
+	}
+
+	for _, tt := range tests {
+		clientConn, mshConn := net.Pipe()
+		go clientConn.Write(tt.ping)
+
+		req, logMsh := getReqType(mshConn)
+		if logMsh != nil {
+			t.Fatalf("%s: "+logMsh.Mex, append([]interface{}{tt.title}, logMsh.Arg...)...)
+		}
+		if req.reqType != errco.CLIENT_REQ_INFO || req.legacy != tt.expLegacy {
+			t.Errorf("%s: request decoded as type %d, legacy %d (expected legacy %d)", tt.title, req.reqType, req.legacy, tt.expLegacy)
+		}
+		if !bytes.Equal(req.raw, tt.ping) {
+			t.Errorf("%s: raw request is %v (expected %v)", tt.title, req.raw, tt.ping)
+		}
+		if tt.expLegacy == legacy16 && (req.handshake.ProtocolVersion != 78 || req.handshake.ServerAddress != "mc.example.com" || req.handshake.ServerPort != 25565) {
+			t.Errorf("%s: handshake decoded as %+v", tt.title, req.handshake)
+		}
+
+		clientConn.Close()
+		mshConn.Close()
+	}
+}
+
+func Test_buildLegacyMessage(t *testing.T) {
+	c := &config.Configuration{}
+	c.Server.Folder = t.TempDir() // no server.properties: default max players
+	c.Server.Version = "1.19.2"
+
+	type test struct {
+		legacy int
+		expect string
+	}
+
+	var tests []test = []test{
+		{legacyBeta, "server status: HIBERNATING§0§20"},
+		{legacy14, "§1\x00127\x001.19.2\x00§fserver status: §b§lHIBERNATING\x000\x0020"},
+	}
+
+	for _, tt := range tests {
+		mes := buildLegacyMessage(c, &clientReq{legacy: tt.legacy}, "   §fserver status:\n   §b§lHIBERNATING")
+		if mes[0] != 0xFF || int(binary.BigEndian.Uint16(mes[1:3])) != len(utf16.Encode([]rune(tt.expect))) {
+			t.Errorf("legacy %d: unexpected kick packet header %v", tt.legacy, mes[:3])
+		}
+		if s := decodeUTF16BE(mes[3:]); s != tt.expect {
+			t.Errorf("legacy %d: message is %q (expected %q)", tt.legacy, s, tt.expect)
+		}
+	}
+}
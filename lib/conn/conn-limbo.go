@@ -0,0 +1,338 @@
+package conn
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"msh/lib/chat"
+	"msh/lib/config"
+	"msh/lib/conn/protocol"
+	"msh/lib/errco"
+	"msh/lib/servctrl"
+)
+
+// reference:
+// - wiki.vg/Protocol_FAQ#What's_the_normal_login_sequence_for_a_client?
+// - wiki.vg/Protocol (1.20.5+)
+
+const (
+	limboReadTimeout time.Duration = 10 * time.Second // max time to wait for a client packet during login and configuration
+	limboTick        time.Duration = time.Second      // period of ms status checks and progress updates
+	limboKeepAlive   time.Duration = 10 * time.Second // period of keep alives sent to the client
+	limboTransferTTL time.Duration = time.Minute      // time within which a transferred player is expected to reconnect
+	limboSpawnY      float64       = 400              // spawn height (above the build limit the client does not wait for chunks)
+)
+
+// transfers tracks the players that were transferred from limbo to ms (player name -> expiry)
+var transfers = struct {
+	m       sync.Mutex
+	players map[string]time.Time
+}{players: map[string]time.Time{}}
+
+// canLimbo returns true if the joining client can be held in limbo (limbo enabled and client 1.20.5+).
+// The client version must be known: registries are loaded from the vanilla data pack of the client version.
+func canLimbo(ms *servctrl.Server, req *clientReq) bool {
+	p := req.handshake.ProtocolVersion
+	return ms.Config.Msh.EnableLimbo && req.legacy == legacyNone && p >= protocol.PROTOCOL_1_20_5 && protocol.VersionName(p) != ""
+}
+
+// limbo accepts the login of the client and holds it in a void world until ms is online,
+// then the client is transferred to ms (same address and port used to reach msh).
+//
+// The client is disconnected if ms stops, encounters major errors or LimboMaxWait is exceeded.
+// clientConn connection should not be closed here (need to be closed in caller function).
+func limbo(ms *servctrl.Server, clientConn net.Conn, req *clientReq) *errco.MshLog {
+	// all packets must be read from the same buffered connection
+	clientConn = bufferConn(clientConn)
+
+	logMsh := limboLogin(clientConn, req)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+	logMsh = limboConfigure(clientConn, req.handshake.ProtocolVersion)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+	ids := protocol.PlayPacketIDs(req.handshake.ProtocolVersion)
+
+	logMsh = limboSpawn(ms, clientConn, req.handshake.ProtocolVersion)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "player %s is waiting in limbo for %s to start", req.loginStart.Name, ms.Config.Name)
+
+	// client packets are discarded (closed is closed when the client disconnects)
+	clientConn.SetReadDeadline(time.Time{})
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, logMsh := protocol.ReadPacket(clientConn); logMsh != nil {
+				return
+			}
+		}
+	}()
+
+	// wait for the client to disconnect before returning
+	// (the connection is closed by caller function)
+	defer func() {
+		select {
+		case <-closed:
+		case <-time.After(limboReadTimeout):
+		}
+	}()
+
+	ticker := time.NewTicker(limboTick)
+	defer ticker.Stop()
+	start, lastKeepAlive := time.Now(), time.Now()
+
+	for {
+		select {
+		case <-closed:
+			return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_LIMBO, "player %s left the limbo", req.loginStart.Name)
+		case <-ticker.C:
+		}
+
+		switch {
+		case ms.Stats.MajorError != nil:
+			return limboDisconnect(clientConn, ids, message(ms, req, config.MSG_MAJOR_ERROR))
+
+		case ms.Stats.Status.Load() == errco.SERVER_STATUS_ONLINE && !ms.Stats.Suspended.Load():
+			return limboTransfer(clientConn, ids, req)
+
+		case ms.Stats.Status.Load() == errco.SERVER_STATUS_OFFLINE, ms.Stats.Status.Load() == errco.SERVER_STATUS_STOPPING:
+			return limboDisconnect(clientConn, ids, message(ms, req, config.MSG_LIMBO_STOPPED))
+
+		case ms.Config.Msh.LimboMaxWait > 0 && time.Since(start) > time.Duration(ms.Config.Msh.LimboMaxWait)*time.Second:
+			return limboDisconnect(clientConn, ids, message(ms, req, config.MSG_LIMBO_TIMEOUT))
+		}
+
+		packets := []*protocol.Packet{actionBar(ids, message(ms, req, config.MSG_LIMBO_PROGRESS))}
+		if time.Since(lastKeepAlive) >= limboKeepAlive {
+			lastKeepAlive = time.Now()
+			packets = append(packets, protocol.NewPacket(ids.KeepAlive, binary.BigEndian.AppendUint64(nil, uint64(lastKeepAlive.UnixMilli()))))
+		}
+		logMsh = sendPackets(clientConn, packets...)
+		if logMsh != nil {
+			return logMsh.AddTrace()
+		}
+	}
+}
+
+// limboLogin completes the login of the client (login success, then waits for login acknowledged)
+func limboLogin(clientConn net.Conn, req *clientReq) *errco.MshLog {
+	// login success: [ uuid | name | properties count | strict error handling (1.20.5 - 1.21.1) ]
+	data := protocol.AppendUUID(nil, req.loginStart.UUID)
+	data = protocol.AppendString(data, req.loginStart.Name)
+	data = protocol.AppendVarInt(data, 0)
+	if req.handshake.ProtocolVersion < protocol.PROTOCOL_1_21_2 {
+		data = protocol.AppendBool(data, false)
+	}
+
+	logMsh := sendPackets(clientConn, protocol.NewPacket(protocol.ID_LOGIN_SUCCESS, data))
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	_, logMsh = readLimboPacket(clientConn, protocol.ID_LOGIN_ACK)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	return nil
+}
+
+// limboConfigure synchronizes the minimal registries with the client and finishes the configuration
+func limboConfigure(clientConn net.Conn, protocolVersion int32) *errco.MshLog {
+	// known packs: registries entries data is loaded from the vanilla data pack of the client
+	names := protocol.VersionNames(protocolVersion)
+	data := protocol.AppendVarInt(nil, int32(len(names)))
+	for _, name := range names {
+		data = protocol.AppendString(data, "minecraft")
+		data = protocol.AppendString(data, "core")
+		data = protocol.AppendString(data, name)
+	}
+	logMsh := sendPackets(clientConn, protocol.NewPacket(protocol.ID_CONFIG_PACKS_SELECT, data))
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+	_, logMsh = readLimboPacket(clientConn, protocol.ID_CONFIG_PACKS)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	packets := []*protocol.Packet{}
+	for _, r := range protocol.Registries(protocolVersion) {
+		packets = append(packets, r.Packet())
+	}
+	packets = append(packets,
+		protocol.NewPacket(protocol.ID_CONFIG_FEATURE_FLAGS, protocol.AppendString(protocol.AppendVarInt(nil, 1), "minecraft:vanilla")),
+		protocol.NewPacket(protocol.ID_CONFIG_FINISH, nil),
+	)
+	logMsh = sendPackets(clientConn, packets...)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	_, logMsh = readLimboPacket(clientConn, protocol.ID_CONFIG_ACK)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	return nil
+}
+
+// limboSpawn spawns the client as spectator in the void overworld
+func limboSpawn(ms *servctrl.Server, clientConn net.Conn, protocolVersion int32) *errco.MshLog {
+	ids := protocol.PlayPacketIDs(protocolVersion)
+	maxPlayers, _ := playersInfo(ms.Config)
+
+	// login (play)
+	data := binary.BigEndian.AppendUint32(nil, 1)             // entity id
+	data = protocol.AppendBool(data, false)                   // is hardcore
+	data = protocol.AppendVarInt(data, 1)                     // dimension count
+	data = protocol.AppendString(data, "minecraft:overworld") // dimension names
+	data = protocol.AppendVarInt(data, int32(maxPlayers))     // max players
+	data = protocol.AppendVarInt(data, 2)                     // view distance
+	data = protocol.AppendVarInt(data, 2)                     // simulation distance
+	data = protocol.AppendBool(data, false)                   // reduced debug info
+	data = protocol.AppendBool(data, false)                   // enable respawn screen
+	data = protocol.AppendBool(data, false)                   // do limited crafting
+	data = protocol.AppendVarInt(data, 0)                     // dimension type (overworld)
+	data = protocol.AppendString(data, "minecraft:overworld") // dimension name
+	data = binary.BigEndian.AppendUint64(data, 0)             // hashed seed
+	data = append(data, 3, 0xFF)                              // game mode (spectator), previous game mode (none)
+	data = protocol.AppendBool(data, false)                   // is debug
+	data = protocol.AppendBool(data, true)                    // is flat
+	data = protocol.AppendBool(data, false)                   // has death location
+	data = protocol.AppendVarInt(data, 0)                     // portal cooldown
+	if protocolVersion >= protocol.PROTOCOL_1_21_2 {
+		data = protocol.AppendVarInt(data, 63) // sea level
+	}
+	data = protocol.AppendBool(data, false) // enforces secure chat
+	login := protocol.NewPacket(ids.Login, data)
+
+	// game event: [ event (start waiting for level chunks) | value (float) ]
+	gameEvent := protocol.NewPacket(ids.GameEvent, []byte{13, 0, 0, 0, 0})
+
+	// synchronize player position:
+	// 1.20.5 - 1.21.1: [ x | y | z | yaw | pitch | flags (byte) | teleport id ]
+	// 1.21.2+:         [ teleport id | x | y | z | velocity x | velocity y | velocity z | yaw | pitch | flags (int) ]
+	xyz := binary.BigEndian.AppendUint64(nil, math.Float64bits(0))
+	xyz = binary.BigEndian.AppendUint64(xyz, math.Float64bits(limboSpawnY))
+	xyz = binary.BigEndian.AppendUint64(xyz, math.Float64bits(0))
+	if protocolVersion >= protocol.PROTOCOL_1_21_2 {
+		data = protocol.AppendVarInt(nil, 1)
+		data = append(data, xyz...)
+		data = append(data, make([]byte, 3*8)...)               // velocity (double)
+		data = append(data, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0) // yaw, pitch (float), flags (absolute position and velocity)
+	} else {
+		data = append(xyz, 0, 0, 0, 0, 0, 0, 0, 0, 0) // yaw, pitch (float), flags (absolute position)
+		data = protocol.AppendVarInt(data, 1)
+	}
+	position := protocol.NewPacket(ids.Position, data)
+
+	return sendPackets(clientConn, login, gameEvent, position)
+}
+
+// limboTransfer transfers the client to the address used to reach msh
+// (the transferred player is proxied to ms when it reconnects)
+func limboTransfer(clientConn net.Conn, ids protocol.PlayIDs, req *clientReq) *errco.MshLog {
+	transfers.m.Lock()
+	for name, expiry := range transfers.players {
+		if time.Now().After(expiry) {
+			delete(transfers.players, name)
+		}
+	}
+	transfers.players[strings.ToLower(req.loginStart.Name)] = time.Now().Add(limboTransferTTL)
+	transfers.m.Unlock()
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "transferring player %s from limbo to %s:%d", req.loginStart.Name, req.handshake.Host(), req.handshake.ServerPort)
+
+	// transfer: [ host | port ]
+	data := protocol.AppendString(nil, req.handshake.Host())
+	data = protocol.AppendVarInt(data, int32(req.handshake.ServerPort))
+
+	return sendPackets(clientConn, protocol.NewPacket(ids.Transfer, data))
+}
+
+// limboDisconnect disconnects the client from limbo with the specified message
+func limboDisconnect(clientConn net.Conn, ids protocol.PlayIDs, message string) *errco.MshLog {
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "disconnecting player from limbo: %s", message)
+
+	return sendPackets(clientConn, protocol.NewPacket(ids.Disconnect, protocol.AppendNBTString(nil, chat.Parse(message).Legacy())))
+}
+
+// rewriteTransfer replaces the handshake next state of a player that was transferred from limbo
+// so that ms does not need to accept transfers.
+// Returns true if the request was rewritten.
+func rewriteTransfer(req *clientReq) bool {
+	if req.handshake == nil || req.loginStart == nil || req.handshake.NextState != protocol.STATE_TRANSFER {
+		return false
+	}
+
+	transfers.m.Lock()
+	expiry, ok := transfers.players[strings.ToLower(req.loginStart.Name)]
+	delete(transfers.players, strings.ToLower(req.loginStart.Name))
+	transfers.m.Unlock()
+	if !ok || time.Now().After(expiry) {
+		return false
+	}
+
+	// req.raw: [ handshake | login start ]
+	loginStart := req.raw[len(req.handshake.Packet().Bytes()):]
+	handshake := *req.handshake
+	handshake.NextState = protocol.STATE_LOGIN
+	req.handshake = &handshake
+	req.raw = append(handshake.Packet().Bytes(), loginStart...)
+
+	return true
+}
+
+// actionBar returns a system chat packet that shows message in the action bar
+// (message can be a json text component or a text with § / & formatting codes)
+func actionBar(ids protocol.PlayIDs, message string) *protocol.Packet {
+	return protocol.NewPacket(ids.SystemChat, protocol.AppendBool(protocol.AppendNBTString(nil, chat.Parse(message).Legacy()), true))
+}
+
+// readLimboPacket reads client packets until a packet with the specified id is received (other packets are discarded)
+func readLimboPacket(clientConn net.Conn, id int32) (*protocol.Packet, *errco.MshLog) {
+	clientConn.SetReadDeadline(time.Now().Add(limboReadTimeout))
+
+	for {
+		packet, logMsh := protocol.ReadPacket(bufferConn(clientConn))
+		if logMsh != nil {
+			return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_LIMBO, "could not read client packet 0x%02x (%s)", id, fmt.Sprintf(logMsh.Mex, logMsh.Arg...))
+		}
+
+		errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%sclient --> msh%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, packet.Bytes())
+
+		if packet.ID == id {
+			return packet, nil
+		}
+	}
+}
+
+// sendPackets writes packets to the client
+func sendPackets(clientConn net.Conn, packets ...*protocol.Packet) *errco.MshLog {
+	mes := []byte{}
+	for _, p := range packets {
+		mes = append(mes, p.Bytes()...)
+	}
+
+	clientConn.SetWriteDeadline(time.Now().Add(limboReadTimeout))
+	_, err := clientConn.Write(mes)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_LIMBO, "could not write to client (%s)", err.Error())
+	}
+
+	errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package conn
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+
+	"msh/lib/config"
+	"msh/lib/conn/protocol"
+	"msh/lib/errco"
+	"msh/lib/servctrl"
+)
+
+func Test_limbo(t *testing.T) {
+	c := &config.Configuration{}
+	c.Server.Folder = t.TempDir()
+	c.Msh.EnableLimbo = true
+
+	if canLimbo(servctrl.NewServer(c), &clientReq{handshake: &protocol.Handshake{ProtocolVersion: 765}}) {
+		t.Errorf("1.20.4 client can be held in limbo")
+	}
+	if canLimbo(servctrl.NewServer(c), &clientReq{handshake: &protocol.Handshake{ProtocolVersion: 10000}}) {
+		t.Errorf("client of unknown version can be held in limbo")
+	}
+
+	// the limbo flow of each protocol version (parallel subtests complete before the group returns)
+	t.Run("versions", func(t *testing.T) {
+		for _, pv := range []int32{766, 767, 768, 769, 770, 771, 772, 773} {
+			pv := pv
+			t.Run(protocol.VersionName(pv), func(t *testing.T) {
+				t.Parallel()
+				testLimbo(t, c, pv)
+			})
+		}
+	})
+
+	// action bar messages accept json components and & formatting codes
+	for _, message := range []string{`{"text":"ready","color":"gold"}`, "&6ready"} {
+		expect := protocol.AppendBool(protocol.AppendNBTString(nil, "§6ready"), true)
+		if data := actionBar(protocol.PlayPacketIDs(protocol.PROTOCOL_1_21), message).Data; !bytes.Equal(data, expect) {
+			t.Errorf("unexpected action bar of %s: %q", message, data)
+		}
+	}
+
+	// the transferred player reconnects with a login handshake
+	handshake := &protocol.Handshake{ProtocolVersion: protocol.PROTOCOL_1_21, ServerAddress: "mc.example.com", ServerPort: 25565, NextState: protocol.STATE_TRANSFER}
+	loginStart := protocol.NewPacket(protocol.ID_LOGIN_START, append(protocol.AppendString(nil, "Steve"), protocol.AppendUUID(nil, "8667ba71-b85a-4004-af54-457a9734eed7")...)).Bytes()
+	newReq := func() *clientReq {
+		return &clientReq{
+			reqType:    errco.CLIENT_REQ_JOIN,
+			handshake:  handshake,
+			loginStart: &protocol.LoginStart{Name: "steve"},
+			raw:        append(handshake.Packet().Bytes(), loginStart...),
+		}
+	}
+
+	transferred := newReq()
+	if !rewriteTransfer(transferred) {
+		t.Fatalf("transferred player handshake not rewritten")
+	}
+	expected := *handshake
+	expected.NextState = protocol.STATE_LOGIN
+	if !bytes.Equal(transferred.raw, append(expected.Packet().Bytes(), loginStart...)) || handshake.NextState != protocol.STATE_TRANSFER {
+		t.Errorf("unexpected rewritten request: %v", transferred.raw)
+	}
+
+	// transfers not issued by msh are not rewritten
+	if other := newReq(); rewriteTransfer(other) {
+		t.Errorf("handshake rewritten for a player not transferred by msh")
+	}
+}
+
+// testLimbo holds a client of protocol version pv in limbo until ms is online, then checks that it is transferred
+func testLimbo(t *testing.T, c *config.Configuration, pv int32) {
+	ms := servctrl.NewServer(c)
+	ms.Stats.Status.Store(errco.SERVER_STATUS_STARTING)
+	ids := protocol.PlayPacketIDs(pv)
+
+	req := &clientReq{
+		reqType:    errco.CLIENT_REQ_JOIN,
+		handshake:  &protocol.Handshake{ProtocolVersion: pv, ServerAddress: "mc.example.com", ServerPort: 25565, NextState: protocol.STATE_LOGIN},
+		loginStart: &protocol.LoginStart{Name: "Steve", UUID: "8667ba71-b85a-4004-af54-457a9734eed7"},
+	}
+	if !canLimbo(ms, req) {
+		t.Fatalf("client can't be held in limbo")
+	}
+
+	mshConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	done := make(chan *errco.MshLog)
+	go func() {
+		done <- limbo(ms, mshConn, req)
+		mshConn.Close()
+	}()
+
+	r := bufio.NewReader(clientConn)
+	read := func(id int32) *protocol.Packet {
+		t.Helper()
+		p, logMsh := protocol.ReadPacket(r)
+		if logMsh != nil {
+			t.Fatalf(logMsh.Mex, logMsh.Arg...)
+		}
+		if p.ID != id {
+			t.Fatalf("received packet 0x%02x (expected 0x%02x)", p.ID, id)
+		}
+		return p
+	}
+	write := func(p *protocol.Packet) {
+		t.Helper()
+		if _, err := clientConn.Write(p.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// login (strict error handling was removed in 1.21.2)
+	loginSuccessLen := 16 + 6 + 1 + 1
+	if pv >= protocol.PROTOCOL_1_21_2 {
+		loginSuccessLen--
+	}
+	p := read(protocol.ID_LOGIN_SUCCESS)
+	if !bytes.Equal(p.Data[:16], protocol.AppendUUID(nil, req.loginStart.UUID)) || !bytes.Equal(p.Data[16:22], protocol.AppendString(nil, "Steve")) || len(p.Data) != loginSuccessLen {
+		t.Errorf("unexpected login success: %v", p.Data)
+	}
+	write(protocol.NewPacket(protocol.ID_LOGIN_ACK, nil))
+
+	// configuration (client information packet is discarded)
+	p = read(protocol.ID_CONFIG_PACKS_SELECT)
+	if !bytes.Contains(p.Data, protocol.AppendString(nil, protocol.VersionName(pv))) {
+		t.Errorf("known packs don't include %s: %v", protocol.VersionName(pv), p.Data)
+	}
+	write(protocol.NewPacket(0x00, []byte{0x05, 'e', 'n', '_', 'u', 's'}))
+	write(protocol.NewPacket(protocol.ID_CONFIG_PACKS, p.Data))
+	for range protocol.Registries(pv) {
+		read(protocol.ID_CONFIG_REGISTRY_DATA)
+	}
+	read(protocol.ID_CONFIG_FEATURE_FLAGS)
+	read(protocol.ID_CONFIG_FINISH)
+	write(protocol.NewPacket(protocol.ID_CONFIG_ACK, nil))
+
+	// play (synchronize player position changed format in 1.21.2)
+	positionLen := 3*8 + 4 + 4 + 1 + 1
+	if pv >= protocol.PROTOCOL_1_21_2 {
+		positionLen = 1 + 6*8 + 4 + 4 + 4
+	}
+	read(ids.Login)
+	read(ids.GameEvent)
+	if p = read(ids.Position); len(p.Data) != positionLen {
+		t.Errorf("unexpected synchronize player position: %v", p.Data)
+	}
+	if p = read(ids.SystemChat); !bytes.Contains(p.Data, []byte("0%")) || p.Data[len(p.Data)-1] != 1 {
+		t.Errorf("unexpected action bar: %q", p.Data)
+	}
+
+	// the player is transferred when ms is online
+	ms.Stats.Status.Store(errco.SERVER_STATUS_ONLINE)
+	for p.ID == ids.SystemChat {
+		var logMsh *errco.MshLog
+		if p, logMsh = protocol.ReadPacket(r); logMsh != nil {
+			t.Fatalf(logMsh.Mex, logMsh.Arg...)
+		}
+	}
+	if p.ID != ids.Transfer || !bytes.Equal(p.Data, protocol.AppendVarInt(protocol.AppendString(nil, "mc.example.com"), 25565)) {
+		t.Fatalf("unexpected transfer packet 0x%02x: %v", p.ID, p.Data)
+	}
+	clientConn.Close()
+
+	if logMsh := <-done; logMsh != nil {
+		t.Errorf(logMsh.Mex, logMsh.Arg...)
+	}
+}
@@ -0,0 +1,274 @@
+package conn
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/servctrl"
+)
+
+// maxRejecting is the max number of rejected clients that are answered with the rejection reason at the same time
+// (clients rejected above this limit are disconnected without reason)
+const maxRejecting int = 64
+
+const (
+	rconMaxAuthFails   int           = 3                // max failed msh rcon authentications in rconAuthFailWindow from the same client address
+	rconAuthFailWindow time.Duration = 10 * time.Minute // time window in which failed msh rcon authentications are counted
+)
+
+// limits contains the state of the limits applied to clients connecting to msh.
+// Max concurrent connections are specified in the main server configuration and apply to all msh ports,
+// rate limits and ban duration are specified in the configuration of the server that the client reaches.
+type limits struct {
+	m         *sync.Mutex
+	conns     int                    // clients connected to msh
+	rejecting int                    // rejected clients being answered with the rejection reason
+	connHits  map[string][]time.Time // connections of the last minute by client address
+	warmHits  map[string][]time.Time // warm attempts of the last hour by client address
+	authHits  map[string][]time.Time // failed msh rcon authentications of the last rconAuthFailWindow by client address
+	bans      map[string]time.Time   // ban expiration by client address
+}
+
+var lim *limits = newLimits()
+
+func init() {
+	go lim.cleaner()
+}
+
+// newLimits returns limits with no client connected
+func newLimits() *limits {
+	return &limits{
+		m:        &sync.Mutex{},
+		connHits: map[string][]time.Time{},
+		warmHits: map[string][]time.Time{},
+		authHits: map[string][]time.Time{},
+		bans:     map[string]time.Time{},
+	}
+}
+
+// Admit reserves a connection slot for a client that connected to msh.
+// Returns an error if the max number of concurrent connections is reached.
+//
+// Admitted clients must be handled by HandlerClientConn (the slot is released when the client disconnects).
+func Admit() *errco.MshLog {
+	lim.m.Lock()
+	defer lim.m.Unlock()
+
+	if max := config.ConfigRuntime.Msh.MaxConnections; max > 0 && lim.conns >= max {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CONN_LIMIT, "max concurrent connections reached (%d)", max)
+	}
+
+	lim.conns++
+
+	return nil
+}
+
+// CheckBan returns an error if the address of a client that connected to msh is banned.
+// Should be called when the connection is accepted, before Admit, so that banned clients don't take a connection slot
+// (clients relayed by a proxy are checked by their own address when the proxy protocol header is read).
+func CheckBan(clientAddr net.Addr) *errco.MshLog {
+	clientAddress, _, err := net.SplitHostPort(clientAddr.String())
+	if err != nil {
+		clientAddress = clientAddr.String()
+	}
+
+	lim.m.Lock()
+	defer lim.m.Unlock()
+
+	return lim.banned(clientAddress, time.Now())
+}
+
+// RejectClient answers a client that was not admitted with the rejection reason then closes the connection.
+// [non-blocking]
+func RejectClient(clientConn net.Conn, mshPort int, reason *errco.MshLog) {
+	lim.m.Lock()
+	defer lim.m.Unlock()
+
+	// too many clients are being rejected: disconnect without reason
+	if lim.rejecting >= maxRejecting {
+		clientConn.Close()
+		return
+	}
+	lim.rejecting++
+
+	go func() {
+		defer func() {
+			lim.m.Lock()
+			lim.rejecting--
+			lim.m.Unlock()
+		}()
+		defer clientConn.Close()
+
+		bc := bufferConn(clientConn)
+		if servers := servctrl.ServersByPort(mshPort); len(servers) > 0 && servers[0].Config.Msh.AcceptProxyProtocol {
+			if logMsh := readProxyHeader(bc); logMsh != nil {
+				logMsh.Log(true)
+				return
+			}
+		}
+
+		req, logMsh := getReqType(bc)
+		if logMsh != nil {
+			logMsh.Log(true)
+			return
+		}
+
+		ms := servctrl.ServerByHost(mshPort, req.handshake.Host())
+		if ms == nil {
+			ms = servctrl.Servers[0]
+		}
+
+		reject(bc, ms, req, reason)
+	}()
+}
+
+// reject answers the client with the rejection reason.
+// clientConn connection should not be closed here (need to be closed in caller function).
+func reject(clientConn net.Conn, ms *servctrl.Server, req *clientReq, reason *errco.MshLog) {
+	// msh INFO response (and PING response)
+	if req.reqType == errco.CLIENT_REQ_INFO {
+		logMsh := answerInfo(clientConn, ms.Config, req, message(ms, req, rejectMessage(reason)))
+		if logMsh != nil {
+			logMsh.Log(true)
+		}
+		return
+	}
+
+	// msh JOIN response (warn client with rejection reason)
+	mes := buildMessage(ms.Config, req.reqType, req.handshake.ProtocolVersion, message(ms, req, rejectMessage(reason)))
+	clientConn.Write(mes)
+	errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+}
+
+// rejectMessage returns the name of the message shown to a client rejected with the specified reason
+func rejectMessage(reason *errco.MshLog) string {
+	switch reason.Cod {
+	case errco.ERROR_CONN_LIMIT:
+		return config.MSG_CONN_LIMIT
+	case errco.ERROR_CONN_RATE:
+		return config.MSG_CONN_RATE
+	case errco.ERROR_WARM_RATE:
+		return config.MSG_WARM_RATE
+	case errco.ERROR_CONN_BANNED:
+		return config.MSG_BANNED
+	default:
+		return config.MSG_REFUSED
+	}
+}
+
+// release frees the connection slot of an admitted client
+func (l *limits) release() {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	l.conns--
+}
+
+// admitAddress registers a connection from the client address to the server with config c.
+// Returns an error if the client address is banned or exceeds the connection rate
+// (exceeding the connection rate bans the client address).
+func (l *limits) admitAddress(c *config.Configuration, clientAddress string) *errco.MshLog {
+	return l.hit(l.connHits, clientAddress, time.Minute, c.Msh.MaxConnRatePerIP, c.Msh.BanDuration, errco.ERROR_CONN_RATE, "connections per minute")
+}
+
+// admitWarm registers a warm attempt from the client address to the server with config c.
+// Returns an error if the client address is banned or exceeds the warm attempts rate
+// (exceeding the warm attempts rate bans the client address).
+func (l *limits) admitWarm(c *config.Configuration, clientAddress string) *errco.MshLog {
+	return l.hit(l.warmHits, clientAddress, time.Hour, c.Msh.MaxWarmPerIP, c.Msh.BanDuration, errco.ERROR_WARM_RATE, "warm attempts per hour")
+}
+
+// failRconAuth registers a failed msh rcon authentication from the client address to the server with config c.
+// Returns an error if the client address is banned or exceeds the failed authentications rate
+// (exceeding the failed authentications rate bans the client address).
+func (l *limits) failRconAuth(c *config.Configuration, clientAddress string) *errco.MshLog {
+	return l.hit(l.authHits, clientAddress, rconAuthFailWindow, rconMaxAuthFails, c.Msh.BanDuration, errco.ERROR_RCON_AUTH_RATE, "failed rcon authentications in 10 minutes")
+}
+
+// hit registers an event of the client address in hits and checks that no more than max events happened in window
+// (exceeding max bans the client address for banDuration seconds).
+// max <= 0 disables the check, banDuration <= 0 disables the ban.
+func (l *limits) hit(hits map[string][]time.Time, clientAddress string, window time.Duration, max, banDuration int, cod errco.LogCod, what string) *errco.MshLog {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	now := time.Now()
+
+	if logMsh := l.banned(clientAddress, now); logMsh != nil {
+		return logMsh
+	}
+
+	if max <= 0 {
+		return nil
+	}
+
+	hits[clientAddress] = append(prune(hits[clientAddress], now.Add(-window)), now)
+	if len(hits[clientAddress]) <= max {
+		return nil
+	}
+
+	// ban the client address
+	ban := ""
+	if banDuration > 0 {
+		l.bans[clientAddress] = now.Add(time.Duration(banDuration) * time.Second)
+		delete(hits, clientAddress)
+		ban = fmt.Sprintf(" (banned for %ds)", banDuration)
+	}
+
+	return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, cod, "client %s exceeded %d %s%s", clientAddress, max, what, ban)
+}
+
+// banned returns an error if the client address is banned.
+// l.m must be locked by the caller.
+func (l *limits) banned(clientAddress string, now time.Time) *errco.MshLog {
+	if exp, ok := l.bans[clientAddress]; ok && now.Before(exp) {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CONN_BANNED, "client %s is banned for %s", clientAddress, exp.Sub(now).Round(time.Second))
+	}
+	return nil
+}
+
+// cleaner removes expired hits and bans.
+// [goroutine]
+func (l *limits) cleaner() {
+	ticker := time.NewTicker(time.Minute)
+	for {
+		<-ticker.C
+
+		l.m.Lock()
+		now := time.Now()
+		for addr, exp := range l.bans {
+			if now.After(exp) {
+				delete(l.bans, addr)
+			}
+		}
+		pruneAll(l.connHits, now.Add(-time.Minute))
+		pruneAll(l.warmHits, now.Add(-time.Hour))
+		pruneAll(l.authHits, now.Add(-rconAuthFailWindow))
+		l.m.Unlock()
+	}
+}
+
+// pruneAll removes the times before from of each client address (client addresses without times are removed)
+func pruneAll(hits map[string][]time.Time, from time.Time) {
+	for addr, times := range hits {
+		if times = prune(times, from); len(times) == 0 {
+			delete(hits, addr)
+		} else {
+			hits[addr] = times
+		}
+	}
+}
+
+// prune removes the times before from (times must be sorted)
+func prune(times []time.Time, from time.Time) []time.Time {
+	for i, t := range times {
+		if t.After(from) {
+			return times[i:]
+		}
+	}
+	return times[:0]
+}
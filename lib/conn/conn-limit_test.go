@@ -0,0 +1,124 @@
+package conn
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+)
+
+func Test_limits(t *testing.T) {
+	// connection rate (no ban)
+	c := &config.Configuration{}
+	c.Msh.MaxConnRatePerIP = 3
+	c.Msh.BanDuration = 0
+	l := newLimits()
+	for i := 0; i < 3; i++ {
+		if logMsh := l.admitAddress(c, "192.168.1.2"); logMsh != nil {
+			t.Fatalf("connection %d rejected: "+logMsh.Mex, append([]interface{}{i}, logMsh.Arg...)...)
+		}
+	}
+	if logMsh := l.admitAddress(c, "192.168.1.2"); logMsh == nil || logMsh.Cod != errco.ERROR_CONN_RATE {
+		t.Errorf("connection exceeding rate was not rejected")
+	}
+	if logMsh := l.admitAddress(c, "192.168.1.3"); logMsh != nil {
+		t.Errorf("connection from another address was rejected")
+	}
+
+	// exceeding the warm rate bans the client address
+	c.Msh.MaxWarmPerIP = 1
+	c.Msh.BanDuration = 60
+	l = newLimits()
+	if logMsh := l.admitWarm(c, "192.168.1.2"); logMsh != nil {
+		t.Fatalf("first warm attempt rejected")
+	}
+	if logMsh := l.admitWarm(c, "192.168.1.2"); logMsh == nil || logMsh.Cod != errco.ERROR_WARM_RATE {
+		t.Errorf("warm attempt exceeding rate was not rejected")
+	}
+	if logMsh := l.admitAddress(c, "192.168.1.2"); logMsh == nil || logMsh.Cod != errco.ERROR_CONN_BANNED {
+		t.Errorf("connection from banned address was not rejected")
+	}
+
+	// repeated msh rcon authentication failures ban the client address
+	l = newLimits()
+	for i := 0; i < rconMaxAuthFails; i++ {
+		if logMsh := l.failRconAuth(c, "192.168.1.5"); logMsh != nil {
+			t.Fatalf("failed authentication %d banned the client address", i)
+		}
+	}
+	if logMsh := l.failRconAuth(c, "192.168.1.5"); logMsh == nil || logMsh.Cod != errco.ERROR_RCON_AUTH_RATE {
+		t.Errorf("failed authentication exceeding rate was not rejected")
+	}
+	if logMsh := l.admitAddress(c, "192.168.1.5"); logMsh == nil || logMsh.Cod != errco.ERROR_CONN_BANNED {
+		t.Errorf("connection from address banned by failed authentications was not rejected")
+	}
+
+	// limits are taken from the config of the server reached by the client
+	other := &config.Configuration{}
+	other.Msh.MaxWarmPerIP = 3
+	l = newLimits()
+	for i := 0; i < 3; i++ {
+		if logMsh := l.admitWarm(other, "192.168.1.4"); logMsh != nil {
+			t.Fatalf("warm attempt %d rejected with the limit of the other server", i)
+		}
+	}
+
+	// disabled limits
+	c.Msh.MaxConnRatePerIP = 0
+	l = newLimits()
+	for i := 0; i < 100; i++ {
+		if logMsh := l.admitAddress(c, "192.168.1.2"); logMsh != nil {
+			t.Fatalf("connection rejected with disabled limit")
+		}
+	}
+}
+
+func Test_Admit(t *testing.T) {
+	// only the config field of the test is restored (the data usage printer reads the config of the servers)
+	defer func(max int) { config.ConfigRuntime.Msh.MaxConnections = max }(config.ConfigRuntime.Msh.MaxConnections)
+	defer func(l *limits) { lim = l }(lim)
+
+	config.ConfigRuntime.Msh.MaxConnections = 2
+	lim = newLimits()
+
+	for i := 0; i < 2; i++ {
+		if logMsh := Admit(); logMsh != nil {
+			t.Fatalf("client %d not admitted", i)
+		}
+	}
+	if logMsh := Admit(); logMsh == nil || logMsh.Cod != errco.ERROR_CONN_LIMIT {
+		t.Fatalf("client exceeding max connections was admitted")
+	}
+
+	// a released slot can be reused
+	lim.release()
+	if logMsh := Admit(); logMsh != nil {
+		t.Errorf("client not admitted after a slot was released")
+	}
+}
+
+func Test_CheckBan(t *testing.T) {
+	defer func(l *limits) { lim = l }(lim)
+	lim = newLimits()
+
+	lim.bans["192.168.1.2"] = time.Now().Add(time.Minute)
+	lim.bans["2001:db8::1"] = time.Now().Add(time.Minute)
+	lim.bans["192.168.1.3"] = time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		addr   net.Addr
+		banned bool
+	}{
+		{&net.TCPAddr{IP: net.ParseIP("192.168.1.2"), Port: 50000}, true},
+		{&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 50000}, true},
+		{&net.TCPAddr{IP: net.ParseIP("192.168.1.3"), Port: 50000}, false},
+		{&net.TCPAddr{IP: net.ParseIP("192.168.1.4"), Port: 50000}, false},
+	}
+	for _, test := range tests {
+		if logMsh := CheckBan(test.addr); (logMsh != nil) != test.banned || (logMsh != nil && logMsh.Cod != errco.ERROR_CONN_BANNED) {
+			t.Errorf("client %s banned: %t (expected %t)", test.addr, logMsh != nil, test.banned)
+		}
+	}
+}
@@ -1,85 +1,123 @@
 package conn
 
 import (
-	"bytes"
+	"bufio"
 	"encoding/json"
-	"math/big"
+	"fmt"
 	"net"
 	"strings"
 	"time"
 
+	"msh/lib/chat"
 	"msh/lib/config"
+	"msh/lib/conn/protocol"
+	"msh/lib/conn/proxyproto"
 	"msh/lib/errco"
 	"msh/lib/model"
+	"msh/lib/traffic"
+	"msh/lib/utility"
 )
 
-// buildMessage takes the request type and message to write to the client
-func buildMessage(reqType int, message string) []byte {
-	// mountHeader mounts the full header to a specified message
-	var mountHeader = func(data []byte) []byte {
-		//                  ┌--------------------full header--------------------┐
-		// scheme:          [ sub-header1     | sub-header2 | sub-header3       | message   ]
-		// bytes used:      [ 2               | 1           | 2                 | 0 - 16379 ]
-		// value range:     [ 128 0 - 255 127 | 0           | 128 0 - 255 127	| --------- ]
-
-		// addSubHeader mounts 1 sub-header to a specified message
-		var addSubHeader = func(message []byte) []byte {
-			//              ┌------sub-header1/3------┐
-			// scheme:      [ firstByte | secondByte  | data ]
-			// value range: [ 128 - 255 | 0 - 127     | ---- ]
-			// it's a number composed of 2 digits in base-128 (firstByte is least significant byte)
-			// sub-header represents the length of the following data
-
-			firstByte := len(message)%128 + 128
-			secondByte := float64(len(message) / 128)
-			return append([]byte{byte(firstByte), byte(secondByte)}, message...)
-		}
+const (
+	defaultMaxPlayers int    = 20                                     // minecraft default max-players
+	sampleUUID        string = "00000000-0000-0000-0000-000000000000" // uuid of players sample lines
+)
 
-		// sub-header3 calculation
-		data = addSubHeader(data)
+// clientReq represents a client request decoded from the packets received by msh
+type clientReq struct {
+	reqType    int                  // request type (errco.CLIENT_REQ_INFO / errco.CLIENT_REQ_JOIN)
+	handshake  *protocol.Handshake  // handshake packet sent by client
+	loginStart *protocol.LoginStart // login start packet sent by client (only for JOIN requests)
+	raw        []byte               // packets read from client (to be relayed to ms when proxying)
+	legacy     int                  // legacy server list ping variant (legacyNone for modern handshakes)
+}
 
-		// sub-header2 calculation
-		data = append([]byte{0}, data...)
+// bufConn is a net.Conn whose reads are buffered.
+// Packets split across multiple reads (or multiple packets in a single read) are handled by the buffer.
+type bufConn struct {
+	net.Conn
+	r      *bufio.Reader
+	remote net.Addr // client address relayed by proxy protocol header (nil if not relayed)
+}
 
-		// sub-header1 calculation
-		data = addSubHeader(data)
+// Read reads data from the connection buffer
+func (bc *bufConn) Read(b []byte) (int, error) {
+	return bc.r.Read(b)
+}
 
-		return data
+// ReadByte reads a single byte from the connection buffer
+func (bc *bufConn) ReadByte() (byte, error) {
+	return bc.r.ReadByte()
+}
+
+// RemoteAddr returns the client address relayed by proxy protocol header or the connection remote address
+func (bc *bufConn) RemoteAddr() net.Addr {
+	if bc.remote != nil {
+		return bc.remote
 	}
+	return bc.Conn.RemoteAddr()
+}
+
+// bufferConn returns the connection wrapped in a bufConn.
+// If the connection is already a bufConn it's returned as is (buffered data is not lost).
+func bufferConn(c net.Conn) *bufConn {
+	if bc, ok := c.(*bufConn); ok {
+		return bc
+	}
+	return &bufConn{Conn: c, r: bufio.NewReader(c)}
+}
+
+// readProxyHeader reads the proxy protocol header sent by an upstream proxy.
+// The relayed client address becomes the remote address of the connection.
+func readProxyHeader(bc *bufConn) *errco.MshLog {
+	// set deadline to avoid hanging when upstream proxy is not sending the header
+	bc.SetDeadline(time.Now().Add(1 * time.Second))
+
+	header, logMsh := proxyproto.ReadHeader(bc.r)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	if header.SrcAddr != nil {
+		bc.remote = header.SrcAddr
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "proxy protocol v%d header: connection from %s relayed by %s", header.Version, bc.RemoteAddr(), bc.Conn.RemoteAddr())
+
+	return nil
+}
 
+// buildMessage takes the minecraft server config, the request type, the client protocol and message to write to the client.
+// clientProtocol is the protocol version sent by the client in the handshake (0 if unknown).
+func buildMessage(c *config.Configuration, reqType int, clientProtocol int32, message string) []byte {
 	switch reqType {
 
 	// send text to be shown in the loadscreen
+	// (message can be a JSON text component or a text with legacy formatting codes)
 	case errco.CLIENT_REQ_JOIN:
-		messageStruct := &model.DataTxt{}
-		messageStruct.Text = message
-
-		dataTxtJSON, err := json.Marshal(messageStruct)
-		if err != nil {
-			// don't return error, just log a warning
-			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_JSON_MARSHAL, err.Error())
-			return nil
-		}
-
-		return mountHeader(dataTxtJSON)
+		// login disconnect packet: [ length | packet id | json chat string ]
+		return protocol.NewPacket(protocol.ID_LOGIN_DISCONNECT, protocol.AppendString(nil, chat.Parse(message).JSON())).Bytes()
 
 	// send server info
+	// (message can be a JSON text component or a text with legacy formatting codes: "&" is accepted in place of "§")
 	case errco.CLIENT_REQ_INFO:
 
-		// "&" [\x26] is converted to "§" [\xc2\xa7]
-		// this step is not strictly necessary if in msh-config is used the character "§"
-		message = strings.ReplaceAll(message, "&", "§")
-
 		// replace "\\n" with "\n" in case the new line was set as msh parameter
 		message = strings.ReplaceAll(message, "\\n", "\n")
 
 		messageStruct := &model.DataInfo{}
-		messageStruct.Description.Text = message
-		messageStruct.Players.Max = 0
+		messageStruct.Description = chat.Parse(message)
+		maxPlayers, sample := playersInfo(c)
+		messageStruct.Players.Max = maxPlayers
 		messageStruct.Players.Online = 0
-		messageStruct.Version.Name = config.ConfigRuntime.Server.Version
-		messageStruct.Version.Protocol = config.ConfigRuntime.Server.Protocol
-		messageStruct.Favicon = "data:image/png;base64," + config.ServerIcon
+		for _, name := range sample {
+			messageStruct.Players.Sample = append(messageStruct.Players.Sample, struct {
+				Name string `json:"name"`
+				ID   string `json:"id"`
+			}{name, sampleUUID})
+		}
+		messageStruct.Version.Name, messageStruct.Version.Protocol = statusVersion(c, clientProtocol)
+		messageStruct.Favicon = "data:image/png;base64," + c.ServerIcon
 
 		dataInfJSON, err := json.Marshal(messageStruct)
 		if err != nil {
@@ -88,141 +126,204 @@ func buildMessage(reqType int, message string) []byte {
 			return nil
 		}
 
-		return mountHeader(dataInfJSON)
+		// status response packet: [ length | packet id | json response string ]
+		return protocol.NewPacket(protocol.ID_STATUS_RESPONSE, protocol.AppendString(nil, string(dataInfJSON))).Bytes()
 
 	default:
 		return nil
 	}
 }
 
-// getReqType returns the request packet, type (INFO or JOIN).
-// Not player name as it's too difficult to extract.
-func getReqType(clientConn net.Conn) ([]byte, int, *errco.MshLog) {
-	var dataReqFull []byte
+// statusVersion returns the version name and protocol to report to a client while ms is not online.
+//
+// The client protocol is reported if protocol echo is enabled or if it's in the accepted protocol ranges,
+// otherwise ms version and protocol are reported.
+func statusVersion(c *config.Configuration, clientProtocol int32) (string, int) {
+	accepted := c.Msh.ProtocolEcho
+	for _, r := range c.Msh.AcceptedProtocols {
+		if min, max, ok := protocol.ParseRange(r); ok && min <= clientProtocol && clientProtocol <= max {
+			accepted = true
+			break
+		}
+	}
 
-	data, logMsh := getClientPacket(clientConn)
-	if logMsh != nil {
-		return nil, errco.CLIENT_REQ_UNKN, logMsh.AddTrace()
+	if accepted && clientProtocol > 0 {
+		return utility.FirstNon("", protocol.VersionName(clientProtocol), c.Server.Version), int(clientProtocol)
 	}
 
-	dataReqFull = data
+	return c.Server.Version, c.Server.Protocol
+}
+
+// playersInfo returns the max players of the minecraft server and the players sample to show while ms is not online.
+// Max players are read from server.properties (minecraft default if not available).
+func playersInfo(c *config.Configuration) (int, []string) {
+	max, logMsh := c.ParsePropertiesInt("max-players")
+	if logMsh != nil {
+		max = defaultMaxPlayers
+	}
 
-	// generate flags
-	MshPortByt := big.NewInt(int64(config.MshPort)).Bytes() // calculates listen port in BigEndian bytes
-	reqFlagInfo := append(MshPortByt, byte(1))              // flag contained in INFO request packet -> [99 211 1]
-	reqFlagJoin := append(MshPortByt, byte(2))              // flag contained in JOIN request packet -> [99 211 2]
+	sample := []string{}
+	for _, line := range c.Msh.PlayersSample {
+		if line != "{recent}" {
+			sample = append(sample, line)
+			continue
+		}
 
-	// extract request type key byte
-	reqTypeKeyByte := byte(0)
-	if len(dataReqFull) > int(dataReqFull[0]) {
-		reqTypeKeyByte = dataReqFull[int(dataReqFull[0])]
+		// replace placeholder with recently seen players
+		for _, seen := range traffic.LastSeen(c.Name, c.Msh.PlayersSampleRecent) {
+			if seen.Online {
+				sample = append(sample, seen.Player+" – online")
+			} else {
+				sample = append(sample, seen.Player+" – "+ago(time.Since(seen.Time)))
+			}
+		}
 	}
 
+	return max, sample
+}
+
+// ago returns a short description of how long ago something happened
+func ago(d time.Duration) string {
 	switch {
-	case reqTypeKeyByte == byte(1) || bytes.Contains(dataReqFull, reqFlagInfo):
-		// client is requesting server info
-		// example: [ 16 0 244 5 9 49 50 55 46 48 46 48 46 49 99 211 1 1 0 ]
-		//  ______________ case 1 _____________      ____________ case 2 ___________
-		// [ 16 ... x x x (MshPortBytes) 1 1 0 ] or [ 16 ... x x x (MshPortBytes) 1 ]
-		// [              ^-reqFlagInfo--^     ]    [              ^-reqFlagInfo--^ ]
-		// [    ^-----------16 bytes-----^     ]    [    ^-----------16 bytes-----^ ]
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d/time.Hour))
+	default:
+		return fmt.Sprintf("%dd ago", int(d/(24*time.Hour)))
+	}
+}
 
-		return dataReqFull, errco.CLIENT_REQ_INFO, nil
+// getReqType reads the client handshake and returns the decoded client request.
+//
+// If the client is trying to join, the login start packet is read and decoded too.
+func getReqType(clientConn net.Conn) (*clientReq, *errco.MshLog) {
+	req := &clientReq{reqType: errco.CLIENT_REQ_UNKN}
+
+	// all packets must be read from the same buffered connection
+	bc := bufferConn(clientConn)
+	clientConn = bc
+
+	// legacy (pre-1.7) server list pings start with 0xFE
+	// (modern handshakes start with the packet length)
+	bc.SetDeadline(time.Now().Add(1 * time.Second))
+	if b, err := bc.r.Peek(1); err == nil && b[0] == 0xFE {
+		return getLegacyReq(bc)
+	}
 
-	case reqTypeKeyByte == byte(2) || bytes.Contains(dataReqFull, reqFlagJoin):
-		// client is trying to join the server
-		// example: [ 16 0 244 5 9 49 50 55 46 48 46 48 46 49 99 211 2 ]
-		//  _______________________ case 1 ______________________      ________________________ case 2 ________________________
-		// [ 16 ... x x x (MshPortBytes) 2 x ... x (player name) ] or [ 16 ... x x x (MshPortBytes) 2 ][ x ... x (player name) ]
-		// [              ^-reqFlagJoin--^                       ]    [              ^-reqFlagJoin--^ ][                       ]
-		// [    ^-----------16 bytes-----^                       ]    [    ^-----------16 bytes-----^ ][                       ]
-
-		// after ms 1.19.3 not always there is a EOF after case 1/2
-		// it's important to calculate if msh should read an other packet
-		// bugfix #197
-		switch {
-		case len(dataReqFull) < int(dataReqFull[0])+1:
-			// case unexpected: should not be possible
-			return nil, errco.CLIENT_REQ_UNKN, errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_ANALYSIS, "unexpected data lenght")
-
-		case len(dataReqFull) == int(dataReqFull[0])+1:
-			// case 1: msh still has a packet to read
-			data, logMsh = getClientPacket(clientConn)
-			if logMsh != nil {
-				return nil, errco.CLIENT_REQ_UNKN, logMsh.AddTrace() // return request unknown as the request failed
-			}
-			dataReqFull = append(dataReqFull, data...)
+	// read and decode handshake packet
+	handshakePacket, logMsh := getClientPacket(clientConn)
+	if logMsh != nil {
+		return req, logMsh.AddTrace()
+	}
+	req.handshake, logMsh = protocol.DecodeHandshake(handshakePacket)
+	if logMsh != nil {
+		return req, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CLIENT_REQ, "client request unknown (%s)", fmt.Sprintf(logMsh.Mex, logMsh.Arg...))
+	}
+	req.raw = handshakePacket.Bytes()
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "client handshake: protocol %d, address %s:%d, next state %d", req.handshake.ProtocolVersion, req.handshake.ServerAddress, req.handshake.ServerPort, req.handshake.NextState)
 
-		case len(dataReqFull) > int(dataReqFull[0])+1:
-			// case 2 (probably): no need to read more data from client
+	switch req.handshake.NextState {
+	case protocol.STATE_STATUS:
+		// client is requesting server info
+		// (status request and ping packets are read when answering the client)
+		req.reqType = errco.CLIENT_REQ_INFO
+
+	case protocol.STATE_LOGIN, protocol.STATE_TRANSFER:
+		// client is trying to join the server
+		loginStartPacket, logMsh := getClientPacket(clientConn)
+		if logMsh != nil {
+			return req, logMsh.AddTrace()
+		}
+		req.loginStart, logMsh = protocol.DecodeLoginStart(loginStartPacket, req.handshake.ProtocolVersion)
+		if logMsh != nil {
+			return req, logMsh.AddTrace()
 		}
+		req.raw = append(req.raw, loginStartPacket.Bytes()...)
+		req.reqType = errco.CLIENT_REQ_JOIN
 
-		return dataReqFull, errco.CLIENT_REQ_JOIN, nil
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "client login start: name %s, uuid %s", req.loginStart.Name, req.loginStart.UUID)
+	}
 
-	default:
-		return nil, errco.CLIENT_REQ_UNKN, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CLIENT_REQ, "client request unknown (received: %v)", dataReqFull)
+	return req, nil
+}
+
+// answerInfo answers a client INFO request with the server info message and performs msh PING response.
+// Legacy server list pings are answered with the legacy kick packet (no PING follows).
+// clientConn connection should not be closed here (need to be closed in caller function).
+func answerInfo(clientConn net.Conn, c *config.Configuration, req *clientReq, message string) *errco.MshLog {
+	var mes []byte
+	if req.legacy != legacyNone {
+		mes = buildLegacyMessage(c, req, message)
+	} else {
+		mes = buildMessage(c, errco.CLIENT_REQ_INFO, req.handshake.ProtocolVersion, message)
+	}
+	clientConn.Write(mes)
+	errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+
+	if req.legacy != legacyNone {
+		return nil
+	}
+
+	// msh PING response
+	logMsh := getPing(clientConn)
+	if logMsh != nil {
+		return logMsh.AddTrace()
 	}
+
+	return nil
 }
 
 // getPing performs msh PING response to the client PING request
 // (must be performed after msh INFO response)
 func getPing(clientConn net.Conn) *errco.MshLog {
+	// all packets must be read from the same buffered connection
+	clientConn = bufferConn(clientConn)
+
 	// read the first packet
-	pingData, logMsh := getClientPacket(clientConn)
+	pingPacket, logMsh := getClientPacket(clientConn)
 	if logMsh != nil {
 		return logMsh.AddTrace()
 	}
 
-	switch {
-	case bytes.HasPrefix(pingData, []byte{9, 1, 0, 0, 0, 0, 0}):
-		// this is a normal ping
-		// packet is [9 1 0 0 0 0 0 89 73 114]
-		// using [9 1 0 0 0 0 0] as prefix is a conservative check
-		// in case other "normal" pings are discovered it's possible to use a shorter/different prefix check
-
-	case bytes.Equal(pingData, []byte{1, 0}):
-		// packet is [1 0]
-		// read the second packet
-		pingData, logMsh = getClientPacket(clientConn)
+	// the status request packet precedes the ping packet
+	if protocol.IsStatusRequest(pingPacket) {
+		pingPacket, logMsh = getClientPacket(clientConn)
 		if logMsh != nil {
 			return logMsh.AddTrace()
 		}
+	}
 
-	// bufix #202: don't use `bytes.Equal(pingData[:2], []byte{1, 0})`
-	// (if pingData == [1] then pingData[:2] == [1 0])
-	// this results in pingData[2:] -> slice bounds out of range [2:1]
-	case bytes.HasPrefix(pingData, []byte{1, 0}):
-		// packet is [1 0 9 1 0 0 0 0 0 89 73 114]
-		// remove first 2 bytes: [1 0 9 1 0 0 0 0 0 89 73 114] -> [9 1 0 0 0 0 0 89 73 114]
-		pingData = pingData[2:]
-
-	default:
-		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_PING_PACKET_UNKNOWN, "received unknown ping packet: %v", pingData)
+	ping, logMsh := protocol.DecodePing(pingPacket)
+	if logMsh != nil {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_PING_PACKET_UNKNOWN, "received unknown ping packet: %v (%s)", pingPacket.Bytes(), fmt.Sprintf(logMsh.Mex, logMsh.Arg...))
 	}
 
 	// answer ping
-	clientConn.Write(pingData)
+	mes := ping.Pong().Bytes()
+	clientConn.Write(mes)
 
-	errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, pingData)
+	errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
 
 	return nil
 }
 
-// getClientPacket reads the client socket and returns only the bytes containing data
+// getClientPacket reads a packet from the client socket.
 // clientConn connection should not be closed here (need to be closed in caller function).
-func getClientPacket(clientConn net.Conn) ([]byte, *errco.MshLog) {
-	buf := make([]byte, 1024)
-
+func getClientPacket(clientConn net.Conn) (*protocol.Packet, *errco.MshLog) {
 	// set deadline to avoid hanging when client is not sending a packet that msh expects
 	clientConn.SetDeadline(time.Now().Add(1 * time.Second))
 
-	// read first packet
-	dataLen, err := clientConn.Read(buf)
-	if err != nil {
-		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CLIENT_SOCKET_READ, err.Error())
+	// read packet (packets split across reads are handled by the buffered connection)
+	packet, logMsh := protocol.ReadPacketMax(bufferConn(clientConn), protocol.MaxClientPacketLen)
+	if logMsh != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CLIENT_SOCKET_READ, logMsh.Mex, logMsh.Arg...)
 	}
 
-	errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%sclient --> msh%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, buf[:dataLen])
+	errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%sclient --> msh%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, packet.Bytes())
 
-	return buf[:dataLen], nil
+	return packet, nil
 }
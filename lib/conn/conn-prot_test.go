@@ -2,13 +2,19 @@ package conn
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"msh/lib/config"
+	"msh/lib/conn/protocol"
 	"msh/lib/errco"
+	"msh/lib/model"
+	"msh/lib/traffic"
 )
 
 type test struct {
@@ -19,9 +25,6 @@ type test struct {
 }
 
 func Test_getReqType(t *testing.T) {
-	// set port which was used to get hardcoded test bytes
-	config.MshPort = 25555
-
 	tests := []test{
 		{
 			"client info request (1.18.2 local)",
@@ -98,15 +101,42 @@ func Test_getReqType(t *testing.T) {
 			0,
 			errco.CLIENT_REQ_JOIN,
 		},
+		{
+			"client info request split across reads (1.19.3 local)",
+			[][]byte{
+				{16, 0, 249, 5, 9, 49, 50},
+				{55, 46, 48, 46, 48, 46, 49, 99, 211, 1},
+			},
+			100 * time.Millisecond,
+			errco.CLIENT_REQ_INFO,
+		},
+		{
+			"client join request split across reads (1.19.3 local)",
+			[][]byte{
+				{33, 0, 249, 5, 26, 107, 117, 98, 101, 114, 110, 101, 116, 101, 115, 46, 100, 111, 99, 107, 101, 114, 46, 105, 110, 116, 101, 114, 110, 97, 108, 99, 211, 2, 28, 0, 9},
+				{103, 101, 107, 105, 103, 101, 107, 57, 57, 1, 196, 93, 252, 169, 146, 189, 69, 1, 169, 208, 156, 201, 205, 197, 2, 113},
+			},
+			100 * time.Millisecond,
+			errco.CLIENT_REQ_JOIN,
+		},
+		{
+			"client info request with server address containing join flag (1.19.3 SRV)",
+			[][]byte{
+				{19, 0, 249, 5, 12, 109, 99, 46, 101, 120, 97, 99, 211, 2, 46, 105, 116, 99, 221, 1},
+			},
+			0,
+			errco.CLIENT_REQ_INFO,
+		},
 	}
 
 	// open a listener and read request type for each new connection
-	go func() {
-		listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", "127.0.0.1", 25555))
-		if err != nil {
-			t.Errorf("%s\n", err.Error())
-		}
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", "25555"))
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	defer listener.Close()
 
+	go func() {
 		for _, test := range tests {
 			clientConn, err := listener.Accept()
 			if err != nil {
@@ -114,12 +144,12 @@ func Test_getReqType(t *testing.T) {
 				continue
 			}
 
-			_, reqType, logMsh := getReqType(clientConn)
+			req, logMsh := getReqType(clientConn)
 			if logMsh != nil {
 				t.Errorf(logMsh.Mex, logMsh.Arg...)
 			}
 
-			if reqType != test.expect.(int) {
+			if req.reqType != test.expect.(int) {
 				t.Errorf("\treceived request is different from expected\n")
 			}
 		}
@@ -127,7 +157,7 @@ func Test_getReqType(t *testing.T) {
 
 	for _, test := range tests {
 		fmt.Printf("testing \"%s\"\n", test.title)
-		serverSocket, err := net.Dial("tcp", fmt.Sprintf("%s:%d", "127.0.0.1", 25555))
+		serverSocket, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", "25555"))
 		if err != nil {
 			t.Errorf("%s\n", err.Error())
 		}
@@ -143,9 +173,6 @@ func Test_getReqType(t *testing.T) {
 }
 
 func Test_getPing(t *testing.T) {
-	// set port which was used to get hardcoded test bytes
-	config.MshPort = 25555
-
 	tests := []test{
 		// positive cases
 		{
@@ -222,17 +249,18 @@ func Test_getPing(t *testing.T) {
 	}
 
 	// emulate msh ping response
-	go func() {
-		listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", "127.0.0.1", 25555))
-		if err != nil {
-			t.Errorf("%s\n", err.Error())
-		}
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", "25555"))
+	if err != nil {
+		t.Fatalf("%s\n", err.Error())
+	}
+	defer listener.Close()
 
+	go func() {
 		for {
 			clientConn, err := listener.Accept()
 			if err != nil {
-				t.Errorf("%s\n", err.Error())
-				continue
+				// listener closed at the end of the test
+				return
 			}
 
 			logMsh := getPing(clientConn)
@@ -244,7 +272,7 @@ func Test_getPing(t *testing.T) {
 
 	for _, test := range tests {
 		fmt.Printf("\ntesting \"%s\": %v\n", test.title, test.packets)
-		serverSocket, err := net.Dial("tcp", fmt.Sprintf("%s:%d", "127.0.0.1", 25555))
+		serverSocket, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", "25555"))
 		if err != nil {
 			t.Errorf("%s\n", err.Error())
 		}
@@ -276,3 +304,90 @@ func Test_getPing(t *testing.T) {
 		serverSocket.Close()
 	}
 }
+
+func Test_readProxyHeader(t *testing.T) {
+	clientConn, upstreamConn := net.Pipe()
+	defer clientConn.Close()
+	defer upstreamConn.Close()
+
+	// upstream proxy sends the header followed by the client handshake
+	go upstreamConn.Write(append([]byte("PROXY TCP4 192.168.1.2 10.0.0.1 56324 25565\r\n"), 16, 0, 249, 5, 9, 49, 50, 55, 46, 48, 46, 48, 46, 49, 99, 211, 1))
+
+	bc := bufferConn(clientConn)
+	if logMsh := readProxyHeader(bc); logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+
+	if addr := bc.RemoteAddr().String(); addr != "192.168.1.2:56324" {
+		t.Errorf("remote address is %s (expected 192.168.1.2:56324)", addr)
+	}
+
+	// the client handshake must still be readable
+	req, logMsh := getReqType(bc)
+	if logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	if req.reqType != errco.CLIENT_REQ_INFO {
+		t.Errorf("request type is %d (expected %d)", req.reqType, errco.CLIENT_REQ_INFO)
+	}
+}
+
+func Test_buildMessageInfo(t *testing.T) {
+	c := &config.Configuration{}
+	c.Name = "msh-test-players"
+	c.Server.Folder = t.TempDir()
+	c.Msh.PlayersSample = []string{"§7last seen:", "{recent}"}
+	c.Msh.PlayersSampleRecent = 5
+
+	if err := os.WriteFile(filepath.Join(c.Server.Folder, "server.properties"), []byte("motd=test\nmax-players=42\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	traffic.Open(c.Name, "192.168.1.2:56324", "alice").Close()
+
+	packet, logMsh := protocol.ReadPacket(bytes.NewReader(buildMessage(c, errco.CLIENT_REQ_INFO, 760, "hibernating")))
+	if logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	data, logMsh := protocol.ReadString(bytes.NewReader(packet.Data))
+	if logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+
+	info := &model.DataInfo{}
+	if err := json.Unmarshal([]byte(data), info); err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Players.Max != 42 || info.Players.Online != 0 {
+		t.Errorf("players are %d/%d (expected 0/42)", info.Players.Online, info.Players.Max)
+	}
+	if len(info.Players.Sample) != 2 || info.Players.Sample[0].Name != "§7last seen:" || info.Players.Sample[1].Name != "alice – just now" {
+		t.Errorf("unexpected players sample: %+v", info.Players.Sample)
+	}
+}
+
+func Test_statusVersion(t *testing.T) {
+	c := &config.Configuration{}
+	c.Server.Version, c.Server.Protocol = "1.19.2", 760
+
+	// ms version is reported by default
+	if name, prot := statusVersion(c, 767); name != "1.19.2" || prot != 760 {
+		t.Errorf("reported version %s (%d), expected 1.19.2 (760)", name, prot)
+	}
+
+	// client protocol is reported if in accepted ranges
+	c.Msh.AcceptedProtocols = []string{"1.8-1.20.4", "767"}
+	if name, prot := statusVersion(c, 767); name != "1.21.1" || prot != 767 {
+		t.Errorf("reported version %s (%d), expected 1.21.1 (767)", name, prot)
+	}
+	if name, prot := statusVersion(c, 766); name != "1.19.2" || prot != 760 {
+		t.Errorf("reported version %s (%d) for protocol not accepted, expected 1.19.2 (760)", name, prot)
+	}
+
+	// client protocol is always reported with protocol echo
+	c.Msh.ProtocolEcho = true
+	if name, prot := statusVersion(c, 766); name != "1.20.6" || prot != 766 {
+		t.Errorf("reported version %s (%d), expected 1.20.6 (766)", name, prot)
+	}
+}
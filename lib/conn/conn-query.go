@@ -2,19 +2,24 @@ package conn
 
 import (
 	"bytes"
+	"container/list"
+	crand "crypto/rand"
 	"encoding/binary"
 	"fmt"
+	"math"
 	"math/big"
 	"math/rand"
 	"net"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"msh/lib/chat"
 	"msh/lib/config"
 	"msh/lib/errco"
 	"msh/lib/progmgr"
 	"msh/lib/servctrl"
-	"msh/lib/servstats"
 	"msh/lib/utility"
 )
 
@@ -22,32 +27,102 @@ import (
 // - wiki.vg/Query
 // - github.com/dreamscached/minequery/v2
 
-// clib is a group of query challenges
-var clib *challengeLibrary = &challengeLibrary{}
+const (
+	challengeTTL      time.Duration = 30 * time.Second // lifetime of a query challenge
+	maxChallenges     int           = 4096             // max number of query challenges and of client addresses rate limited (the oldest is evicted when exceeded)
+	maxQueryRate      int           = 60               // max number of query requests per minute from a client address
+	maxQueryHandlers  int           = 64               // max number of query requests handled at the same time
+	queryRateWindow   time.Duration = time.Minute      // window of the query requests rate limit
+	challengeMinValue int32         = 1_000_000        // min value of a query challenge
+)
+
+// clib is the library of query challenges issued to clients
+var clib *challengeLibrary = newChallengeLibrary(challengeTTL, maxChallenges, maxQueryRate)
+
+func init() {
+	go clib.sweeper()
+}
 
-// challenge represents a query challenge uint32 value and its expiration timer
+// challenge represents a query challenge value and its expiration time
 type challenge struct {
-	time.Timer
 	val uint32
+	exp time.Time
+	el  *list.Element // element of the client address in the challenges queue
+}
+
+// queryHits represents the requests of a client address
+type queryHits struct {
+	times []time.Time   // requests of the last queryRateWindow (max rate+1)
+	el    *list.Element // element of the client address in the requests queue
 }
 
-// challengeLibrary represents a group of query challenges
+// challengeLibrary represents a group of query challenges, each bound to the client address it was issued to.
+// Challenges and requests are queued by client address from the oldest,
+// so that expired entries and the oldest entry (when the library is full) are removed without scanning the library.
 type challengeLibrary struct {
-	list []challenge
+	m          *sync.Mutex
+	rng        *rand.Rand            // challenge generator (seeded from crypto/rand)
+	ttl        time.Duration         // lifetime of a challenge
+	max        int                   // max number of challenges and of client addresses in hits
+	rate       int                   // max number of requests per queryRateWindow from a client address (<= 0 disables the check)
+	chall      map[string]*challenge // challenges by client address (host:port)
+	challQueue *list.List            // client addresses of chall from the oldest challenge (challenges expire in the same order)
+	hits       map[string]*queryHits // requests by client address (host)
+	hitsQueue  *list.List            // client addresses of hits from the least recent request
 }
 
-// HandlerQuery handles query stats requests.
+// queryInfo contains the values of the last query stats response of a minecraft server
+// (served to clients while the minecraft server is not warm)
+type queryInfo struct {
+	gameType   string
+	plugins    string
+	mapName    string
+	maxPlayers string
+}
+
+var (
+	queryCacheM *sync.Mutex           = &sync.Mutex{}
+	queryCache  map[string]*queryInfo = map[string]*queryInfo{} // last query stats values by minecraft server name
+)
+
+// newChallengeLibrary returns an empty challenge library
+func newChallengeLibrary(ttl time.Duration, max, rate int) *challengeLibrary {
+	var seed int64
+	if err := binary.Read(crand.Reader, binary.BigEndian, &seed); err != nil {
+		// crypto/rand should never fail: fall back to a time based seed
+		errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_QUERY_CHALLENGE, "error while seeding query challenge generator: %s", err.Error())
+		seed = time.Now().UnixNano()
+	}
+
+	return &challengeLibrary{
+		m:          &sync.Mutex{},
+		rng:        rand.New(rand.NewSource(seed)),
+		ttl:        ttl,
+		max:        max,
+		rate:       rate,
+		chall:      map[string]*challenge{},
+		challQueue: list.New(),
+		hits:       map[string]*queryHits{},
+		hitsQueue:  list.New(),
+	}
+}
+
+// HandlerQuery handles query stats requests for the specified minecraft server.
 //
-// Accepts requests on config.MshHost, config.MshPortQuery
-func HandlerQuery() {
-	connCli, err := net.ListenPacket("udp", fmt.Sprintf("%s:%d", config.MshHost, config.MshPortQuery))
+// Accepts requests on config.MshHost, ms.Config.Msh.MshPortQuery
+// (queries don't specify the hostname used by the client: servers sharing a query port are answered by the first one)
+// [goroutine]
+func HandlerQuery(ms *servctrl.Server) {
+	connCli, err := net.ListenPacket("udp", net.JoinHostPort(config.MshHost, strconv.Itoa(ms.Config.Msh.MshPortQuery)))
 	if err != nil {
 		errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CLIENT_LISTEN, err.Error())
 		return
 	}
 
 	// infinite cycle to handle new clients queries
-	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "%-40s %10s:%5d ...", "listening for new clients queries on", config.MshHost, config.MshPortQuery)
+	// (requests are handled concurrently, requests exceeding maxQueryHandlers are dropped)
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "%-40s %10s:%5d ...", "listening for new clients queries on", config.MshHost, ms.Config.Msh.MshPortQuery)
+	handlers := make(chan struct{}, maxQueryHandlers)
 	for {
 		// handshake / stats request read
 		var buf []byte = make([]byte, 1024)
@@ -57,16 +132,32 @@ func HandlerQuery() {
 			continue
 		}
 
-		// if minecraft server is not warm, handle request
-		logMsh := handleRequest(connCli, addrCli, buf[:n])
-		if logMsh != nil {
-			logMsh.Log(true)
+		select {
+		case handlers <- struct{}{}:
+		default:
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_QUERY_RATE, "too many query requests being handled: request from %s dropped", addrCli.String())
+			continue
 		}
+
+		go func() {
+			defer func() { <-handlers }()
+
+			logMsh := handleRequest(ms, connCli, addrCli, buf[:n])
+			if logMsh != nil {
+				logMsh.Log(true)
+			}
+		}()
 	}
 }
 
 // handleRequest handles handshake / stats request from client performing handshake / stats response.
-func handleRequest(connCli net.PacketConn, addr net.Addr, reqClient []byte) *errco.MshLog {
+func handleRequest(ms *servctrl.Server, connCli net.PacketConn, addr net.Addr, reqClient []byte) *errco.MshLog {
+	// check that the client address does not exceed the query requests rate
+	logMsh := clib.admit(addr)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
 	switch len(reqClient) {
 
 	case 7: // handshake request from client
@@ -75,9 +166,9 @@ func handleRequest(connCli net.PacketConn, addr net.Addr, reqClient []byte) *err
 		sessionID := reqClient[3:7]
 
 		// handshake response composition
-		rsp := bytes.NewBuffer([]byte{9})                       // type: handshake
-		rsp.Write(sessionID)                                    // session id
-		rsp.WriteString(fmt.Sprintf("%d", clib.gen()) + "\x00") // challenge (int32 written as string, null terminated)
+		rsp := bytes.NewBuffer([]byte{9})                           // type: handshake
+		rsp.Write(sessionID)                                        // session id
+		rsp.WriteString(fmt.Sprintf("%d", clib.gen(addr)) + "\x00") // challenge (int32 written as string, null terminated)
 
 		// handshake response send
 		errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "send handshake rsp:\t%v", rsp.Bytes())
@@ -94,25 +185,25 @@ func handleRequest(connCli net.PacketConn, addr net.Addr, reqClient []byte) *err
 		sessionID := reqClient[3:7]
 		challenge := reqClient[7:11]
 
-		// check that received challenge is known and not expired
-		if !clib.inLibrary(binary.BigEndian.Uint32(challenge)) {
-			return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_QUERY_CHALLENGE, "challenge failed")
+		// check that received challenge was issued to the client address and is not expired
+		if !clib.inLibrary(addr, binary.BigEndian.Uint32(challenge)) {
+			return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_QUERY_CHALLENGE, "challenge failed (%s)", addr.String())
 		}
 
 		// if ms is not warm emulate response
-		logMsh := servctrl.CheckMSWarm()
+		logMsh = ms.CheckMSWarm()
 		if logMsh != nil {
 			switch len(reqClient) {
 			case 11: // base stats response
-				statsRespBase(connCli, addr, sessionID)
+				statsRespBase(ms, connCli, addr, sessionID)
 			case 15: // full stats response
-				statsRespFull(connCli, addr, sessionID)
+				statsRespFull(ms, connCli, addr, sessionID)
 			}
 			return nil
 		}
 
 		// if ms is warm get response and send it to client
-		stats, logMsh := statsGet(reqClient)
+		stats, logMsh := statsGet(ms, reqClient)
 		if logMsh != nil {
 			return logMsh.AddTrace()
 		}
@@ -132,9 +223,9 @@ func handleRequest(connCli net.PacketConn, addr net.Addr, reqClient []byte) *err
 
 // statsGet connects to ms and performs a stats base/full request.
 // Returns the stats data already adapted for the client response.
-func statsGet(reqClient []byte) ([]byte, *errco.MshLog) {
+func statsGet(ms *servctrl.Server, reqClient []byte) ([]byte, *errco.MshLog) {
 	// Dial the server using a UDP connection
-	conn, err := net.Dial("udp", fmt.Sprintf("%s:%d", config.ServHost, config.ServPortQuery))
+	conn, err := net.Dial("udp", net.JoinHostPort(ms.Config.ServHost, strconv.Itoa(ms.Config.ServPortQuery)))
 	if err != nil {
 		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_DIAL, err.Error())
 	}
@@ -142,12 +233,20 @@ func statsGet(reqClient []byte) ([]byte, *errco.MshLog) {
 
 	conn.SetDeadline(time.Now().Add(time.Second))
 
+	// session id of the requests to ms
+	// (only the lower 4 bits of each byte are used by minecraft servers)
+	sessionID := make([]byte, 4)
+	crand.Read(sessionID)
+	for i := range sessionID {
+		sessionID[i] &= 0x0f
+	}
+
 	// ---------- ms query handshake ----------- //
 
 	// request handshake
 	data := bytes.NewBuffer([]byte{254, 253}) // magic
 	data.WriteByte(9)                         // handshake code
-	data.Write([]byte{1, 2, 3, 4})            // session id
+	data.Write(sessionID)                     // session id
 	_, err = conn.Write(data.Bytes())
 	if err != nil {
 		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONN_WRITE, err.Error())
@@ -161,6 +260,9 @@ func statsGet(reqClient []byte) ([]byte, *errco.MshLog) {
 		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONN_READ, err.Error())
 	}
 	errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, " ├ recv handshake rsp (<- ms):\t%v", buf[:n])
+	if n < 6 || buf[0] != 9 || !bytes.Equal(buf[1:5], sessionID) {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_QUERY_BAD_REQUEST, "unexpected handshake response from minecraft server")
+	}
 
 	// calculate challenge
 	chall := bytes.NewBuffer(nil)
@@ -175,7 +277,7 @@ func statsGet(reqClient []byte) ([]byte, *errco.MshLog) {
 	// request base / full stats
 	data = bytes.NewBuffer([]byte{254, 253}) // magic
 	data.WriteByte(0)                        // stats code
-	data.Write([]byte{1, 2, 3, 4})           // session id
+	data.Write(sessionID)                    // session id
 	data.Write(chall.Bytes())                // challenge
 	if len(reqClient) == 15 {
 		data.Write([]byte{0, 0, 0, 0}) // full request
@@ -192,6 +294,12 @@ func statsGet(reqClient []byte) ([]byte, *errco.MshLog) {
 		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONN_READ, err.Error())
 	}
 	errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, " └ recv stats rsp (<- ms):\t%v", buf[:n])
+	if n < 5 || buf[0] != 0 || !bytes.Equal(buf[1:5], sessionID) {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_QUERY_BAD_REQUEST, "unexpected stats response from minecraft server")
+	}
+
+	// store stats values to serve them while ms is not warm
+	cacheStats(ms.Config.Name, len(reqClient) == 15, buf[5:n])
 
 	// adapt server stats response to client session id
 	data = bytes.NewBuffer(reqClient[2:7]) // stats code (0) + session id (from client request)
@@ -201,29 +309,20 @@ func statsGet(reqClient []byte) ([]byte, *errco.MshLog) {
 }
 
 // statsRespBase writes a base stats response to client
-func statsRespBase(connCli net.PacketConn, addr net.Addr, sessionID []byte) {
-	levelName, _ := config.ConfigRuntime.ParsePropertiesString("level-name")
-	mshPortSmallEndian := utility.Reverse(big.NewInt(int64(config.MshPort)).Bytes())
-	var motd string
-	switch {
-	case servstats.Stats.Status == errco.SERVER_STATUS_OFFLINE || servstats.Stats.Suspended:
-		motd = config.ConfigRuntime.Msh.InfoHibernation
-	case servstats.Stats.Status == errco.SERVER_STATUS_STARTING:
-		motd = config.ConfigRuntime.Msh.InfoStarting
-	case servstats.Stats.Status == errco.SERVER_STATUS_ONLINE:
-		// server can't be online if this function was called
-	case servstats.Stats.Status == errco.SERVER_STATUS_STOPPING:
-		motd = "minecraft server is stopping..."
-	}
+// (using the values of the last stats response of ms, if any)
+func statsRespBase(ms *servctrl.Server, connCli net.PacketConn, addr net.Addr, sessionID []byte) {
+	info := cachedStats(ms)
+	mshPortSmallEndian := utility.Reverse(big.NewInt(int64(ms.Config.Msh.MshPort)).Bytes())
+	motd := queryMotd(ms)
 
 	buf := bytes.NewBuffer(nil)
 	buf.WriteByte(0)                                                 // type
 	buf.Write(sessionID)                                             // session ID
 	buf.WriteString(fmt.Sprintf("%s\x00", motd))                     // MOTD
-	buf.WriteString("SMP\x00")                                       // gametype hardcoded (default)
-	buf.WriteString(fmt.Sprintf("%s\x00", levelName))                // map
+	buf.WriteString(fmt.Sprintf("%s\x00", info.gameType))            // gametype
+	buf.WriteString(fmt.Sprintf("%s\x00", info.mapName))             // map
 	buf.WriteString("0\x00")                                         // numplayers hardcoded
-	buf.WriteString("0\x00")                                         // maxplayers hardcoded
+	buf.WriteString(fmt.Sprintf("%s\x00", info.maxPlayers))          // maxplayers
 	buf.Write(append(mshPortSmallEndian, byte(0)))                   // hostport
 	buf.WriteString(fmt.Sprintf("%s\x00", utility.GetOutboundIP4())) // hostip
 
@@ -234,21 +333,33 @@ func statsRespBase(connCli net.PacketConn, addr net.Addr, sessionID []byte) {
 	}
 }
 
-// statsRespFull writes a full stats response to client
-func statsRespFull(connCli net.PacketConn, addr net.Addr, sessionID []byte) {
-	levelName, _ := config.ConfigRuntime.ParsePropertiesString("level-name")
+// queryMotd returns the motd of a stats response depending on ms status.
+// The message (json text component or text with formatting codes) is converted to a single line with "§" formatting codes.
+func queryMotd(ms *servctrl.Server) string {
 	var motd string
 	switch {
-	case servstats.Stats.Status == errco.SERVER_STATUS_OFFLINE || servstats.Stats.Suspended:
-		motd = config.ConfigRuntime.Msh.InfoHibernation
-	case servstats.Stats.Status == errco.SERVER_STATUS_STARTING:
-		motd = config.ConfigRuntime.Msh.InfoStarting
-	case servstats.Stats.Status == errco.SERVER_STATUS_ONLINE:
+	case ms.Stats.Status.Load() == errco.SERVER_STATUS_OFFLINE || ms.Stats.Suspended.Load():
+		motd = render(ms, nil, ms.Config.Msh.InfoHibernation)
+	case ms.Stats.Status.Load() == errco.SERVER_STATUS_STARTING:
+		motd = render(ms, nil, ms.Config.Msh.InfoStarting)
+	case ms.Stats.Status.Load() == errco.SERVER_STATUS_ONLINE:
 		// server can't be online if this function was called
-	case servstats.Stats.Status == errco.SERVER_STATUS_STOPPING:
-		motd = "minecraft server is stopping..."
+	case ms.Stats.Status.Load() == errco.SERVER_STATUS_STOPPING:
+		motd = message(ms, nil, config.MSG_STOPPING)
 	}
 
+	// stats response fields are null terminated
+	motd = chat.Parse(strings.ReplaceAll(motd, "\\n", "\n")).Legacy()
+	return singleLine(strings.ReplaceAll(motd, "\x00", ""))
+}
+
+// statsRespFull writes a full stats response to client
+// (using the values of the last stats response of ms, if any)
+func statsRespFull(ms *servctrl.Server, connCli net.PacketConn, addr net.Addr, sessionID []byte) {
+	info := cachedStats(ms)
+	_, sample := playersInfo(ms.Config)
+	motd := queryMotd(ms)
+
 	buf := bytes.NewBuffer(nil)
 	buf.WriteByte(0)                        // type
 	buf.Write(sessionID)                    // session ID
@@ -256,20 +367,23 @@ func statsRespFull(connCli net.PacketConn, addr net.Addr, sessionID []byte) {
 
 	// K, V section
 	buf.WriteString(fmt.Sprintf("hostname\x00%s\x00", motd))
-	buf.WriteString(fmt.Sprintf("gametype\x00%s\x00", "SMP"))      // hardcoded (default)
+	buf.WriteString(fmt.Sprintf("gametype\x00%s\x00", info.gameType))
 	buf.WriteString(fmt.Sprintf("game_id\x00%s\x00", "MINECRAFT")) // hardcoded (default)
-	buf.WriteString(fmt.Sprintf("version\x00%s\x00", config.ConfigRuntime.Server.Version))
-	buf.WriteString(fmt.Sprintf("plugins\x00msh/%s: msh %s\x00", config.ConfigRuntime.Server.Version, progmgr.MshVersion)) // example: "plugins\x00{ServerVersion}: {Name} {Version}; {Name} {Version}\x00"
-	buf.WriteString(fmt.Sprintf("map\x00%s\x00", levelName))
+	buf.WriteString(fmt.Sprintf("version\x00%s\x00", ms.Config.Server.Version))
+	buf.WriteString(fmt.Sprintf("plugins\x00%s\x00", info.plugins)) // example: "plugins\x00{ServerVersion}: {Name} {Version}; {Name} {Version}\x00"
+	buf.WriteString(fmt.Sprintf("map\x00%s\x00", info.mapName))
 	buf.WriteString("numplayers\x000\x00") // hardcoded
-	buf.WriteString("maxplayers\x000\x00") // hardcoded
-	buf.WriteString(fmt.Sprintf("hostport\x00%d\x00", config.MshPort))
+	buf.WriteString(fmt.Sprintf("maxplayers\x00%s\x00", info.maxPlayers))
+	buf.WriteString(fmt.Sprintf("hostport\x00%d\x00", ms.Config.Msh.MshPort))
 	buf.WriteString(fmt.Sprintf("hostip\x00%s\x00", utility.GetOutboundIP4()))
 	buf.WriteByte(0) // termination of section (?)
 
 	// Players
 	buf.WriteString("\x01player_\x00\x00") // padding (default)
-	buf.WriteString("\x00")                // example: "aaa\x00bbb\x00\x00"
+	for _, name := range sample {
+		buf.WriteString(name + "\x00") // example: "aaa\x00bbb\x00\x00"
+	}
+	buf.WriteString("\x00")
 
 	errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "send stats full rsp:\t%v", buf.Bytes())
 	_, err := connCli.WriteTo(buf.Bytes(), addr)
@@ -278,39 +392,178 @@ func statsRespFull(connCli net.PacketConn, addr net.Addr, sessionID []byte) {
 	}
 }
 
-// Gen generates a int32 challenge and adds it to the challenge library
-func (cl *challengeLibrary) gen() uint32 {
-	rand.Seed(time.Now().UnixNano())
-	cval := uint32(rand.Int31n(9_999_999-1_000_000+1) + 1_000_000)
+// cacheStats stores the values of a base / full stats response of the minecraft server
+func cacheStats(server string, full bool, stats []byte) {
+	fields := strings.Split(string(stats), "\x00")
 
-	c := challenge{
-		Timer: *time.NewTimer(time.Hour),
-		val:   cval,
+	values := map[string]string{}
+	if full {
+		// "splitnum\x00\x80\x00" padding, then key/value pairs terminated by an empty key
+		if len(fields) < 2 || fields[0] != "splitnum" {
+			return
+		}
+		for i := 2; i+1 < len(fields) && fields[i] != ""; i += 2 {
+			values[fields[i]] = fields[i+1]
+		}
+	} else {
+		// motd, gametype, map, numplayers, maxplayers, hostport + hostip
+		if len(fields) < 5 {
+			return
+		}
+		values["gametype"], values["map"], values["maxplayers"] = fields[1], fields[2], fields[4]
 	}
 
-	cl.list = append(cl.list, c)
+	queryCacheM.Lock()
+	defer queryCacheM.Unlock()
 
-	return cval
+	info, ok := queryCache[server]
+	if !ok {
+		info = &queryInfo{}
+		queryCache[server] = info
+	}
+	for key, field := range map[string]*string{"gametype": &info.gameType, "plugins": &info.plugins, "map": &info.mapName, "maxplayers": &info.maxPlayers} {
+		if v, ok := values[key]; ok {
+			*field = v
+		}
+	}
 }
 
-// InLibrary searches library for non-expired test value
-func (cl *challengeLibrary) inLibrary(t uint32) bool {
-	// remove expired challenges
-	// (reverse list loop to remove elements while iterating on them)
-	for i := len(cl.list) - 1; i >= 0; i-- {
-		select {
-		case <-cl.list[i].C:
-			cl.list = append(cl.list[:i], cl.list[i+1:]...)
-		default:
+// cachedStats returns the values of the last stats response of the minecraft server.
+// Values never received from ms are taken from ms config.
+func cachedStats(ms *servctrl.Server) queryInfo {
+	queryCacheM.Lock()
+	info := queryInfo{}
+	if cached, ok := queryCache[ms.Config.Name]; ok {
+		info = *cached
+	}
+	queryCacheM.Unlock()
+
+	if info.gameType == "" {
+		info.gameType = "SMP" // default
+	}
+	if info.plugins == "" {
+		info.plugins = fmt.Sprintf("msh/%s: msh %s", ms.Config.Server.Version, progmgr.MshVersion)
+	}
+	if info.mapName == "" {
+		info.mapName, _ = ms.Config.ParsePropertiesString("level-name")
+	}
+	if info.maxPlayers == "" {
+		maxPlayers, _ := playersInfo(ms.Config)
+		info.maxPlayers = strconv.Itoa(maxPlayers)
+	}
+
+	return info
+}
+
+// gen generates a challenge for the client address and adds it to the challenge library
+// (the previous challenge of the client address is replaced)
+func (cl *challengeLibrary) gen(addr net.Addr) uint32 {
+	cl.m.Lock()
+	defer cl.m.Unlock()
+
+	now := time.Now()
+	cval := uint32(challengeMinValue + cl.rng.Int31n(math.MaxInt32-challengeMinValue))
+
+	// the previous challenge is replaced and becomes the most recent one
+	if c, ok := cl.chall[addr.String()]; ok {
+		c.val, c.exp = cval, now.Add(cl.ttl)
+		cl.challQueue.MoveToBack(c.el)
+		return cval
+	}
+
+	// keep the library bounded: remove expired challenges and, if still full, the oldest one
+	if len(cl.chall) >= cl.max {
+		cl.sweep(now)
+		if len(cl.chall) >= cl.max {
+			delete(cl.chall, cl.challQueue.Remove(cl.challQueue.Front()).(string))
 		}
 	}
 
-	// search for non-expired test value
-	for i := 0; i < len(cl.list); i++ {
-		if t == cl.list[i].val {
-			return true
+	cl.chall[addr.String()] = &challenge{val: cval, exp: now.Add(cl.ttl), el: cl.challQueue.PushBack(addr.String())}
+
+	return cval
+}
+
+// inLibrary returns true if the challenge value was issued to the client address and is not expired
+func (cl *challengeLibrary) inLibrary(addr net.Addr, t uint32) bool {
+	cl.m.Lock()
+	defer cl.m.Unlock()
+
+	c, ok := cl.chall[addr.String()]
+
+	return ok && c.val == t && time.Now().Before(c.exp)
+}
+
+// admit registers a query request from the client address.
+// Returns an error if the client address exceeds the query requests rate.
+func (cl *challengeLibrary) admit(addr net.Addr) *errco.MshLog {
+	if cl.rate <= 0 {
+		return nil
+	}
+
+	host := addr.String()
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	cl.m.Lock()
+	defer cl.m.Unlock()
+
+	now := time.Now()
+
+	h, ok := cl.hits[host]
+	if ok {
+		cl.hitsQueue.MoveToBack(h.el)
+	} else {
+		// keep the library bounded: remove client addresses without recent requests and, if still full, the least recent one
+		if len(cl.hits) >= cl.max {
+			cl.sweep(now)
+			if len(cl.hits) >= cl.max {
+				delete(cl.hits, cl.hitsQueue.Remove(cl.hitsQueue.Front()).(string))
+			}
 		}
+		h = &queryHits{el: cl.hitsQueue.PushBack(host)}
+		cl.hits[host] = h
+	}
+
+	// only the last rate+1 requests are needed to check the rate
+	h.times = append(prune(h.times, now.Add(-queryRateWindow)), now)
+	if len(h.times) > cl.rate+1 {
+		h.times = h.times[len(h.times)-cl.rate-1:]
+	}
+	if len(h.times) > cl.rate {
+		return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_QUERY_RATE, "client %s exceeded %d query requests per minute", host, cl.rate)
 	}
 
-	return false
+	return nil
+}
+
+// sweeper removes expired challenges and requests every challenge lifetime.
+// [goroutine]
+func (cl *challengeLibrary) sweeper() {
+	ticker := time.NewTicker(cl.ttl)
+	for {
+		<-ticker.C
+
+		cl.m.Lock()
+		cl.sweep(time.Now())
+		cl.m.Unlock()
+	}
+}
+
+// sweep removes expired challenges and client addresses without requests in the last queryRateWindow
+// (queues are visited from the oldest entry until the first entry that is not expired).
+// cl.m must be locked by the caller.
+func (cl *challengeLibrary) sweep(now time.Time) {
+	for e := cl.challQueue.Front(); e != nil && !now.Before(cl.chall[e.Value.(string)].exp); e = cl.challQueue.Front() {
+		delete(cl.chall, cl.challQueue.Remove(e).(string))
+	}
+
+	from := now.Add(-queryRateWindow)
+	for e := cl.hitsQueue.Front(); e != nil; e = cl.hitsQueue.Front() {
+		if times := cl.hits[e.Value.(string)].times; len(times) > 0 && times[len(times)-1].After(from) {
+			break
+		}
+		delete(cl.hits, cl.hitsQueue.Remove(e).(string))
+	}
 }
@@ -1,26 +1,34 @@
 package conn
 
 import (
+	"bytes"
 	"fmt"
+	"net"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/dreamscached/minequery/v2"
 
 	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/servctrl"
 )
 
 func Test_QueryFull(t *testing.T) {
-	config.MshHost, config.MshPortQuery = "127.0.0.1", 25555
+	ms := servctrl.Servers[0]
+	config.MshHost, ms.Config.Msh.MshPortQuery = "127.0.0.1", 25555
 
-	go HandlerQuery()
+	go HandlerQuery(ms)
+	time.Sleep(100 * time.Millisecond) // wait for query handler to listen
 
 	minequery.WithUseStrict(true)
 
 	for i := 0; i < 3; i++ {
 		fmt.Println("--------------------")
 
-		res, err := minequery.QueryFull(config.MshHost, config.MshPortQuery)
+		res, err := minequery.QueryFull(config.MshHost, ms.Config.Msh.MshPortQuery)
 		if err != nil {
 			t.Fatalf(err.Error())
 		}
@@ -32,16 +40,18 @@ func Test_QueryFull(t *testing.T) {
 }
 
 func Test_QueryBasic(t *testing.T) {
-	config.MshHost, config.MshPortQuery = "127.0.0.1", 25555
+	ms := servctrl.Servers[0]
+	config.MshHost, ms.Config.Msh.MshPortQuery = "127.0.0.1", 25555
 
-	go HandlerQuery()
+	go HandlerQuery(ms)
+	time.Sleep(100 * time.Millisecond) // wait for query handler to listen
 
 	minequery.WithUseStrict(true)
 
 	for i := 0; i < 3; i++ {
 		fmt.Println("--------------------")
 
-		res, err := minequery.QueryBasic(config.MshHost, config.MshPortQuery)
+		res, err := minequery.QueryBasic(config.MshHost, ms.Config.Msh.MshPortQuery)
 		if err != nil {
 			t.Fatalf(err.Error())
 		}
@@ -51,3 +61,194 @@ func Test_QueryBasic(t *testing.T) {
 		time.Sleep(time.Second)
 	}
 }
+
+func Test_challengeLibrary(t *testing.T) {
+	cl := newChallengeLibrary(100*time.Millisecond, 3, 5)
+	a := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 2), Port: 50000}
+	b := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 3), Port: 50000}
+
+	// challenges are bound to the client address
+	ca := cl.gen(a)
+	if !cl.inLibrary(a, ca) {
+		t.Errorf("challenge %d not valid for the address it was issued to", ca)
+	}
+	if cl.inLibrary(b, ca) {
+		t.Errorf("challenge %d issued to %s valid for %s", ca, a, b)
+	}
+
+	// a new handshake replaces the previous challenge of the client address
+	if ca2 := cl.gen(a); ca2 != ca && cl.inLibrary(a, ca) {
+		t.Errorf("replaced challenge %d still valid", ca)
+	}
+
+	// challenges expire
+	cb := cl.gen(b)
+	time.Sleep(150 * time.Millisecond)
+	if cl.inLibrary(b, cb) {
+		t.Errorf("expired challenge %d still valid", cb)
+	}
+
+	// the library is bounded (the oldest challenge is evicted)
+	for port := 1; port <= 10; port++ {
+		cl.gen(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: port})
+	}
+	if len(cl.chall) != 3 {
+		t.Errorf("library contains %d challenges (max 3)", len(cl.chall))
+	}
+	if _, ok := cl.chall["10.0.0.1:10"]; !ok {
+		t.Errorf("most recent challenge evicted")
+	}
+
+	// a replaced challenge becomes the most recent one
+	cl.gen(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 8})
+	cl.gen(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 11})
+	if _, ok := cl.chall["10.0.0.1:8"]; !ok {
+		t.Errorf("replaced challenge evicted")
+	}
+	if _, ok := cl.chall["10.0.0.1:9"]; ok {
+		t.Errorf("oldest challenge not evicted")
+	}
+	if len(cl.chall) != cl.challQueue.Len() {
+		t.Errorf("library contains %d challenges and %d queued client addresses", len(cl.chall), cl.challQueue.Len())
+	}
+
+	// requests rate is limited by client address (port excluded)
+	for port := 1; port <= 5; port++ {
+		if logMsh := cl.admit(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: port}); logMsh != nil {
+			t.Errorf("request %d rejected: %s", port, logMsh.Mex)
+		}
+	}
+	if logMsh := cl.admit(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 6}); logMsh == nil {
+		t.Errorf("request exceeding the rate admitted")
+	}
+	if logMsh := cl.admit(a); logMsh != nil {
+		t.Errorf("request from other address rejected: %s", logMsh.Mex)
+	}
+
+	// requests stored for a client address are bounded by the rate
+	for port := 7; port <= 20; port++ {
+		cl.admit(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: port})
+	}
+	if n := len(cl.hits["10.0.0.2"].times); n != 6 {
+		t.Errorf("%d requests stored for a client address (max 6)", n)
+	}
+
+	// client addresses are bounded (the least recent one is evicted)
+	for host := 1; host <= 10; host++ {
+		cl.admit(&net.UDPAddr{IP: net.IPv4(10, 0, 2, byte(host)), Port: 50000})
+	}
+	if len(cl.hits) != 3 || cl.hitsQueue.Len() != 3 {
+		t.Errorf("library contains requests of %d client addresses (%d queued, max 3)", len(cl.hits), cl.hitsQueue.Len())
+	}
+	if _, ok := cl.hits["10.0.2.10"]; !ok {
+		t.Errorf("most recent client address evicted")
+	}
+
+	// expired challenges and requests are swept
+	cl.m.Lock()
+	cl.sweep(time.Now().Add(queryRateWindow))
+	if len(cl.chall) != 0 || len(cl.hits) != 0 || cl.challQueue.Len() != 0 || cl.hitsQueue.Len() != 0 {
+		t.Errorf("%d challenges and requests of %d client addresses not swept", len(cl.chall), len(cl.hits))
+	}
+	cl.m.Unlock()
+
+	// concurrent use of the library
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			addr := &net.UDPAddr{IP: net.IPv4(10, 0, 1, byte(i)), Port: 50000}
+			cl.admit(addr)
+			cl.inLibrary(addr, cl.gen(addr))
+		}(i)
+	}
+	wg.Wait()
+}
+
+func Test_statsCache(t *testing.T) {
+	// fake minecraft server query listener
+	connMs, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connMs.Close()
+
+	go func() {
+		buf := make([]byte, 1024)
+
+		// handshake
+		n, addr, err := connMs.ReadFrom(buf)
+		if err != nil || n != 7 {
+			return
+		}
+		sessionID := append([]byte{}, buf[3:7]...)
+		connMs.WriteTo(append(append([]byte{9}, sessionID...), "9513307\x00"...), addr)
+
+		// full stats (answered with the session id of the request)
+		n, addr, err = connMs.ReadFrom(buf)
+		if err != nil || n != 15 || !bytes.Equal(buf[3:7], sessionID) {
+			return
+		}
+		stats := "splitnum\x00\x80\x00hostname\x00A Minecraft Server\x00gametype\x00SMP\x00game_id\x00MINECRAFT\x00version\x001.21.1\x00plugins\x00Paper on 1.21.1: EssentialsX 2.20.1\x00map\x00survival\x00numplayers\x002\x00maxplayers\x0042\x00hostport\x0025565\x00hostip\x00127.0.0.1\x00\x00\x01player_\x00\x00Steve\x00Alex\x00\x00"
+		connMs.WriteTo(append(append([]byte{0}, sessionID...), stats...), addr)
+	}()
+
+	c := &config.Configuration{}
+	c.Name = "test-query"
+	c.Server.Folder = t.TempDir()
+	c.Server.Version = "1.21.1"
+	c.ServHost, c.ServPortQuery = "127.0.0.1", connMs.LocalAddr().(*net.UDPAddr).Port
+	c.Msh.InfoHibernation = "hibernating"
+	ms := servctrl.NewServer(c)
+
+	// proxied full stats request
+	reqClient := []byte{254, 253, 0, 1, 2, 3, 4, 0, 0, 0, 0, 0, 0, 0, 0}
+	stats, logMsh := statsGet(ms, reqClient)
+	if logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	if !bytes.Equal(stats[:5], []byte{0, 1, 2, 3, 4}) || !strings.Contains(string(stats), "Paper on 1.21.1") {
+		t.Errorf("unexpected stats response: %q", stats)
+	}
+
+	// emulated full stats response uses cached values and msh description
+	connCli, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connCli.Close()
+
+	ms.Stats.Status.Store(errco.SERVER_STATUS_OFFLINE)
+	statsRespFull(ms, connMs, connCli.LocalAddr(), []byte{5, 6, 7, 8})
+
+	buf := make([]byte, 1024)
+	connCli.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := connCli.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kv := range []string{"hostname\x00hibernating\x00", "gametype\x00SMP\x00", "plugins\x00Paper on 1.21.1: EssentialsX 2.20.1\x00", "map\x00survival\x00", "maxplayers\x0042\x00", "numplayers\x000\x00"} {
+		if !strings.Contains(string(buf[:n]), kv) {
+			t.Errorf("emulated stats response %q does not contain %q", buf[:n], kv)
+		}
+	}
+}
+
+func Test_queryMotd(t *testing.T) {
+	c := &config.Configuration{}
+	c.Server.Folder = t.TempDir()
+	ms := servctrl.NewServer(c)
+
+	tests := map[string]string{
+		`{"text":"sleeping","color":"gold"}`: "§6sleeping",
+		`&6sleeping\n&7join to start`:       "§6sleeping §7join to start",
+		"plain motd":                         "plain motd",
+	}
+	for info, expect := range tests {
+		c.Msh.InfoHibernation = info
+		if motd := queryMotd(ms); motd != expect {
+			t.Errorf("query motd of %q: %q (expected %q)", info, motd, expect)
+		}
+	}
+}
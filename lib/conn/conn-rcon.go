@@ -0,0 +1,220 @@
+package conn
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/conn/protocol"
+	"msh/lib/errco"
+	"msh/lib/servctrl"
+	"msh/lib/utility"
+)
+
+const (
+	rconIdleTimeout time.Duration = 5 * time.Minute // rcon connections are closed after this time without requests
+	rconWarmTimeout time.Duration = 3 * time.Minute // max time waited for ms to be online before forwarding a command
+)
+
+// rconMshCommands are the msh commands accepted by the msh rcon ("msh [server name] <command>")
+var rconMshCommands []string = []string{"start", "freeze", "status"}
+
+// HandlerRcon handles rcon connections for the specified minecraft server.
+//
+// Accepts connections on config.MshHost, ms.Config.Msh.MshPortRcon
+// (msh commands can target other servers by name, other commands are forwarded to ms)
+// [goroutine]
+func HandlerRcon(ms *servctrl.Server) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(config.MshHost, strconv.Itoa(ms.Config.Msh.MshPortRcon)))
+	if err != nil {
+		errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CLIENT_LISTEN, err.Error())
+		return
+	}
+
+	// infinite cycle to handle new rcon clients
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "%-40s %10s:%5d ...", "listening for new rcon connections on", config.MshHost, ms.Config.Msh.MshPortRcon)
+	for {
+		rconConn, err := listener.Accept()
+		if err != nil {
+			errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CLIENT_ACCEPT, err.Error())
+			continue
+		}
+
+		// refuse client addresses that are banned or exceed the connection rate
+		host, _, _ := net.SplitHostPort(rconConn.RemoteAddr().String())
+		logMsh := lim.admitAddress(ms.Config, host)
+		if logMsh != nil {
+			logMsh.Log(true)
+			rconConn.Close()
+			continue
+		}
+
+		go handleRcon(ms, rconConn)
+	}
+}
+
+// handleRcon serves the requests of an rcon client until it disconnects.
+// Commands are accepted only after authentication with ms.Config.Msh.RconPassword
+// (failed authentications are counted by client address and exceeding them bans the client address).
+// [goroutine]
+func handleRcon(ms *servctrl.Server, rconConn net.Conn) {
+	defer rconConn.Close()
+
+	authenticated := false
+	for {
+		rconConn.SetReadDeadline(time.Now().Add(rconIdleTimeout))
+		req, logMsh := protocol.ReadRconPacket(rconConn)
+		if logMsh != nil {
+			return
+		}
+
+		switch req.Type {
+		case protocol.RCON_AUTH:
+			if subtle.ConstantTimeCompare([]byte(req.Body), []byte(ms.Config.Msh.RconPassword)) != 1 {
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_RCON_CLIENT, "rcon authentication failed (%s)", rconConn.RemoteAddr().String())
+
+				// repeated authentication failures ban the client address
+				host, _, _ := net.SplitHostPort(rconConn.RemoteAddr().String())
+				if logMsh := lim.failRconAuth(ms.Config, host); logMsh != nil {
+					logMsh.Log(true)
+				}
+
+				rconConn.Write((&protocol.RconPacket{ID: -1, Type: protocol.RCON_AUTH_RESPONSE}).Bytes())
+				return
+			}
+			authenticated = true
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "rcon client authenticated (%s)", rconConn.RemoteAddr().String())
+
+			// only the auth response is sent (as in minecraft servers, clients read a single packet)
+			rconConn.Write((&protocol.RconPacket{ID: req.ID, Type: protocol.RCON_AUTH_RESPONSE}).Bytes())
+
+		case protocol.RCON_COMMAND:
+			if !authenticated {
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_RCON_CLIENT, "rcon command before authentication (%s)", rconConn.RemoteAddr().String())
+				rconConn.Write((&protocol.RconPacket{ID: -1, Type: protocol.RCON_AUTH_RESPONSE}).Bytes())
+				return
+			}
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_2, errco.ERROR_NIL, "rcon command: %s%s%s\t(%s)", errco.COLOR_CYAN, req.Body, errco.COLOR_RESET, rconConn.RemoteAddr().String())
+
+			// responses longer than a packet are fragmented
+			out := rconCommand(ms, req.Body)
+			rsp := []byte{}
+			for len(out) > protocol.RCON_MAX_RESPONSE {
+				rsp = append(rsp, (&protocol.RconPacket{ID: req.ID, Type: protocol.RCON_RESPONSE, Body: out[:protocol.RCON_MAX_RESPONSE]}).Bytes()...)
+				out = out[protocol.RCON_MAX_RESPONSE:]
+			}
+			rsp = append(rsp, (&protocol.RconPacket{ID: req.ID, Type: protocol.RCON_RESPONSE, Body: out}).Bytes()...)
+			rconConn.Write(rsp)
+
+		default:
+			// mirror empty response
+			// (sent by clients after a command to detect the end of a fragmented response)
+			rconConn.Write((&protocol.RconPacket{ID: req.ID, Type: protocol.RCON_RESPONSE}).Bytes())
+		}
+	}
+}
+
+// rconCommand executes an rcon command and returns its output.
+//
+// msh commands ("msh [server name] start|freeze|status") are executed by msh
+// (other servers can be targeted only if they share the msh rcon port and password of ms),
+// other commands are forwarded to ms (ms is warmed first if RconWarm is enabled).
+func rconCommand(ms *servctrl.Server, command string) string {
+	args := strings.Fields(command)
+
+	// msh commands
+	if len(args) >= 2 && args[0] == "msh" {
+		target, args := ms, args[1:]
+		if len(args) > 1 && !utility.SliceContain(args[0], rconMshCommands) {
+			var logMsh *errco.MshLog
+			target, logMsh = servctrl.ServerByName(args[0])
+			if logMsh != nil {
+				return fmt.Sprintf(logMsh.Mex, logMsh.Arg...)
+			}
+			if !rconShared(ms, target) {
+				return fmt.Sprintf("minecraft server %s can't be controlled by this msh rcon (msh rcon is disabled or has another port or password)", target.Config.Name)
+			}
+			args = args[1:]
+		}
+
+		switch args[0] {
+		case "start":
+			logMsh := target.WarmMS()
+			if logMsh != nil {
+				return fmt.Sprintf(logMsh.Mex, logMsh.Arg...)
+			}
+			return fmt.Sprintf("minecraft server %s warmed (ready in %s)", target.Config.Name, eta(target))
+		case "freeze":
+			logMsh := target.FreezeMS(true)
+			if logMsh != nil {
+				return fmt.Sprintf(logMsh.Mex, logMsh.Arg...)
+			}
+			return fmt.Sprintf("minecraft server %s frozen", target.Config.Name)
+		case "status":
+			return strings.Join(target.StatusReport(), "\n")
+		default:
+			return "unknown msh command (" + strings.Join(rconMshCommands, " - ") + ")"
+		}
+	}
+
+	// commands forwarded to ms
+	if ms.CheckMSWarm() != nil {
+		if !ms.Config.Msh.RconWarm {
+			return message(ms, nil, config.MSG_RCON_HIBERNATING)
+		}
+
+		logMsh := waitWarm(ms)
+		if logMsh != nil {
+			return fmt.Sprintf(logMsh.Mex, logMsh.Arg...)
+		}
+	}
+
+	out, logMsh := ms.Execute(command)
+	if logMsh != nil {
+		return fmt.Sprintf(logMsh.Mex, logMsh.Arg...)
+	}
+
+	return out
+}
+
+// rconShared returns true if the msh rcon of target is enabled with the same port and password of the msh rcon of ms
+func rconShared(ms, target *servctrl.Server) bool {
+	if target == ms {
+		return true
+	}
+	return target.Config.Msh.MshPortRcon != 0 &&
+		target.Config.Msh.MshPortRcon == ms.Config.Msh.MshPortRcon &&
+		subtle.ConstantTimeCompare([]byte(target.Config.Msh.RconPassword), []byte(ms.Config.Msh.RconPassword)) == 1
+}
+
+// waitWarm warms ms and waits until it's online (max rconWarmTimeout).
+// Returns an error if ms can't be warmed, if it stops or if it's not online within rconWarmTimeout.
+func waitWarm(ms *servctrl.Server) *errco.MshLog {
+	logMsh := ms.WarmMS()
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	// (ms status is set to starting asynchronously after the warm)
+	maxWait, started := time.Now().Add(rconWarmTimeout), false
+	for {
+		started = started || ms.Stats.Status.Load() != errco.SERVER_STATUS_OFFLINE
+
+		switch {
+		case ms.CheckMSWarm() == nil:
+			return nil
+		case ms.Stats.MajorError != nil:
+			return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_RCON_CLIENT, "minecraft server has encountered major problems")
+		case started && ms.Stats.Status.Load() == errco.SERVER_STATUS_OFFLINE, ms.Stats.Status.Load() == errco.SERVER_STATUS_STOPPING:
+			return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_RCON_CLIENT, "minecraft server is not starting")
+		case time.Now().After(maxWait):
+			return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_RCON_CLIENT, "minecraft server not online after %s", rconWarmTimeout)
+		}
+
+		time.Sleep(holdTick)
+	}
+}
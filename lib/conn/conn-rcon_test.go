@@ -0,0 +1,106 @@
+package conn
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"msh/lib/config"
+	"msh/lib/conn/protocol"
+	"msh/lib/servctrl"
+)
+
+func Test_handleRcon(t *testing.T) {
+	c := &config.Configuration{}
+	c.Name = "test-rcon"
+	c.Server.Folder = t.TempDir()
+	c.Msh.RconPassword = "secret"
+	ms := servctrl.NewServer(c)
+
+	defer func(l *limits) { lim = l }(lim)
+	lim = newLimits()
+
+	// request sends an rcon packet and returns the next response
+	request := func(conn net.Conn, req *protocol.RconPacket) *protocol.RconPacket {
+		t.Helper()
+		go conn.Write(req.Bytes())
+		rsp, logMsh := protocol.ReadRconPacket(conn)
+		if logMsh != nil {
+			t.Fatalf(logMsh.Mex, logMsh.Arg...)
+		}
+		return rsp
+	}
+
+	// commands before authentication and wrong passwords are refused
+	for _, req := range []*protocol.RconPacket{{ID: 1, Type: protocol.RCON_COMMAND, Body: "msh start"}, {ID: 1, Type: protocol.RCON_AUTH, Body: "wrong"}} {
+		client, server := net.Pipe()
+		go handleRcon(ms, server)
+		if rsp := request(client, req); rsp.ID != -1 || rsp.Type != protocol.RCON_AUTH_RESPONSE {
+			t.Errorf("unexpected response to %+v: %+v", req, rsp)
+		}
+		client.Close()
+	}
+
+	// the failed authentication is counted for the client address (pipe connections have an empty address)
+	lim.m.Lock()
+	if fails := len(lim.authHits[""]); fails != 1 {
+		t.Errorf("%d failed authentications counted (expected 1)", fails)
+	}
+	lim.m.Unlock()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go handleRcon(ms, server)
+
+	// authentication (only the auth response is sent)
+	if rsp := request(client, &protocol.RconPacket{ID: 7, Type: protocol.RCON_AUTH, Body: "secret"}); rsp.ID != 7 || rsp.Type != protocol.RCON_AUTH_RESPONSE {
+		t.Fatalf("unexpected auth response: %+v", rsp)
+	}
+
+	tests := []struct {
+		command string
+		expect  string
+	}{
+		{"msh status", "test-rcon: status offline"},
+		{"msh restart", "unknown msh command (start - freeze - status)"},
+		{"msh unknown-server status", "server unknown-server not found"},
+		{"list", "server is hibernating: command not executed"},
+	}
+	for i, test := range tests {
+		rsp := request(client, &protocol.RconPacket{ID: int32(10 + i), Type: protocol.RCON_COMMAND, Body: test.command})
+		if rsp.ID != int32(10+i) || !strings.Contains(rsp.Body, test.expect) {
+			t.Errorf("unexpected response to %q: %+v", test.command, rsp)
+		}
+	}
+
+	// empty responses are mirrored
+	if rsp := request(client, &protocol.RconPacket{ID: 99, Type: protocol.RCON_RESPONSE}); rsp.ID != 99 || rsp.Body != "" {
+		t.Errorf("unexpected mirror response: %+v", rsp)
+	}
+}
+
+func Test_rconShared(t *testing.T) {
+	server := func(name string, port int, password string) *servctrl.Server {
+		c := &config.Configuration{}
+		c.Name, c.Server.Folder = name, t.TempDir()
+		c.Msh.MshPortRcon, c.Msh.RconPassword = port, password
+		return servctrl.NewServer(c)
+	}
+	ms := server("test-rcon", 25576, "secret")
+
+	tests := []struct {
+		target *servctrl.Server
+		expect bool
+	}{
+		{ms, true},
+		{server("shared", 25576, "secret"), true},
+		{server("other-port", 25577, "secret"), false},
+		{server("other-password", 25576, "other"), false},
+		{server("disabled", 0, ""), false},
+	}
+	for _, test := range tests {
+		if shared := rconShared(ms, test.target); shared != test.expect {
+			t.Errorf("msh rcon of %s shared: %t (expected %t)", test.target.Config.Name, shared, test.expect)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package conn
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"msh/lib/chat"
+	"msh/lib/errco"
+	"msh/lib/servctrl"
+	"msh/lib/traffic"
+)
+
+// message returns the client-facing message with the specified name (see config.MSG_*)
+// rendered with the current values of ms and client placeholders.
+// req can be nil if the message is not related to a client request.
+func message(ms *servctrl.Server, req *clientReq, name string) string {
+	return render(ms, req, ms.Config.Message(name))
+}
+
+// render returns the message template with placeholders replaced by the current values of ms and client
+func render(ms *servctrl.Server, req *clientReq, tpl string) string {
+	return chat.Render(tpl, placeholderValues(ms, req))
+}
+
+// placeholderValues returns the values of message template placeholders
+func placeholderValues(ms *servctrl.Server, req *clientReq) map[string]string {
+	values := map[string]string{
+		"player":         "",
+		"progress":       ms.Stats.LoadProgress,
+		"eta":            eta(ms),
+		"last_online":    "never",
+		"uptime":         "0s",
+		"version":        ms.Config.Server.Version,
+		"hibernated_for": "0s",
+		"error":          "",
+	}
+
+	if req != nil && req.loginStart != nil {
+		values["player"] = req.loginStart.Name
+	}
+
+	if seen := traffic.LastSeen(ms.Config.Name, 1); len(seen) > 0 {
+		if seen[0].Online {
+			values["last_online"] = "now"
+		} else {
+			values["last_online"] = ago(time.Since(seen[0].Time))
+		}
+	}
+
+	switch {
+	case ms.Stats.Status.Load() == errco.SERVER_STATUS_OFFLINE, ms.Stats.Suspended.Load():
+		values["hibernated_for"] = duration(time.Since(ms.Stats.HibernateTime))
+	case ms.Stats.Status.Load() == errco.SERVER_STATUS_ONLINE:
+		values["uptime"] = duration(time.Since(ms.Stats.OnlineTime))
+	}
+
+	if ms.Stats.MajorError != nil {
+		values["error"] = fmt.Sprintf(ms.Stats.MajorError.Mex, ms.Stats.MajorError.Arg...)
+	}
+
+	return values
+}
+
+// eta returns the estimated time remaining until ms is online.
+// The time remaining is estimated from the durations of previous starts (see servstats.EstimateStart)
+// or, while ms is starting and no estimate is available, from the load progress.
+func eta(ms *servctrl.Server) string {
+	if d, ok := ms.StartETA(); ok {
+		return duration(d)
+	}
+
+	if ms.Stats.Status.Load() != errco.SERVER_STATUS_STARTING {
+		return "unknown"
+	}
+
+	progress, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(ms.Stats.LoadProgress), "%"), 64)
+	if err != nil || progress <= 0 || progress >= 100 {
+		return "unknown"
+	}
+
+	elapsed := time.Since(ms.Stats.WarmUpTime)
+	return duration(time.Duration(float64(elapsed) * (100 - progress) / progress))
+}
+
+// duration returns a short description of a duration ("45s", "3m 20s", "2h 5m", "3d 4h")
+func duration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d/time.Second))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm %ds", int(d/time.Minute), int(d%time.Minute/time.Second))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh %dm", int(d/time.Hour), int(d%time.Hour/time.Minute))
+	default:
+		return fmt.Sprintf("%dd %dh", int(d/(24*time.Hour)), int(d%(24*time.Hour)/time.Hour))
+	}
+}
@@ -0,0 +1,49 @@
+package conn
+
+import (
+	"testing"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/conn/protocol"
+	"msh/lib/errco"
+	"msh/lib/servctrl"
+)
+
+func Test_message(t *testing.T) {
+	c := &config.Configuration{}
+	c.Name = "test-template"
+	c.Server.Folder = t.TempDir()
+	c.Server.Version = "1.21.1"
+	c.Msh.Messages = map[string]string{config.MSG_STARTING: "{player} joined {version}: {progress}, ready in {eta}"}
+	ms := servctrl.NewServer(c)
+	req := &clientReq{loginStart: &protocol.LoginStart{Name: "Steve"}}
+
+	// starting server: eta is estimated from load progress
+	ms.Stats.Status.Store(errco.SERVER_STATUS_STARTING)
+	ms.Stats.WarmUpTime = time.Now().Add(-30 * time.Second)
+	ms.Stats.LoadProgress = "75%"
+	if mes := message(ms, req, config.MSG_STARTING); mes != "Steve joined 1.21.1: 75%, ready in 10s" {
+		t.Errorf("unexpected starting message: %q", mes)
+	}
+
+	// hibernating server
+	ms.Stats.Status.Store(errco.SERVER_STATUS_OFFLINE)
+	ms.Stats.HibernateTime = time.Now().Add(-(2*time.Hour + 5*time.Minute))
+	if mes := render(ms, nil, "{player}hibernating for {hibernated_for}, eta {eta}, last online {last_online}"); mes != "hibernating for 2h 5m, eta unknown, last online never" {
+		t.Errorf("unexpected hibernation message: %q", mes)
+	}
+
+	// online server
+	ms.Stats.Status.Store(errco.SERVER_STATUS_ONLINE)
+	ms.Stats.OnlineTime = time.Now().Add(-(3*24*time.Hour + 4*time.Hour))
+	if mes := render(ms, nil, "up {uptime}, hibernated for {hibernated_for}"); mes != "up 3d 4h, hibernated for 0s" {
+		t.Errorf("unexpected online message: %q", mes)
+	}
+
+	// major error
+	ms.Stats.MajorError = errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_MINECRAFT_SERVER, "eula not accepted (%s)", "eula.txt")
+	if mes := message(ms, req, config.MSG_MAJOR_ERROR); mes != "eula not accepted (eula.txt)" {
+		t.Errorf("unexpected major error message: %q", mes)
+	}
+}
@@ -1,40 +1,85 @@
 package conn
 
 import (
-	"fmt"
+	"errors"
 	"net"
-	"strings"
+	"os"
+	"strconv"
 	"time"
 
 	"msh/lib/config"
+	"msh/lib/conn/proxyproto"
 	"msh/lib/errco"
 	"msh/lib/servctrl"
-	"msh/lib/servstats"
 )
 
+// holdTick is the period of ms status checks while holding a client connection
+const holdTick time.Duration = 250 * time.Millisecond
+
 func init() {
 	go printDataUsage()
 }
 
-// HandlerClientConn handles a client that is connecting.
+// HandlerClientConn handles a client that is connecting to msh on the specified msh port.
 // Can handle a client that is requesting server INFO or server JOIN.
+// The client is routed to the minecraft server selected by msh port and handshake hostname.
 // If there is a ms major error, it is reported to client then func returns.
+//
+// The client must have been admitted with Admit: its connection slot is released when the client disconnects.
 // [goroutine]
-func HandlerClientConn(clientConn net.Conn) {
-	// handling of ipv6 addresses
-	li := strings.LastIndex(clientConn.RemoteAddr().String(), ":")
-	clientAddress := clientConn.RemoteAddr().String()[:li]
+func HandlerClientConn(clientConn net.Conn, mshPort int) {
+	defer lim.release()
+
+	// buffer client connection reads so that packets can be decoded
+	bc := bufferConn(clientConn)
+	clientConn = bc
+
+	// read the proxy protocol header sent by the upstream proxy
+	// (servers sharing a msh port use the setting of the first one)
+	if servers := servctrl.ServersByPort(mshPort); len(servers) > 0 && servers[0].Config.Msh.AcceptProxyProtocol {
+		logMsh := readProxyHeader(bc)
+		if logMsh != nil {
+			logMsh.Log(true)
+			clientConn.Close()
+			return
+		}
+	}
+
+	// client address without port (ipv6 addresses without brackets, as stored by limits)
+	clientAddress, _, _ := net.SplitHostPort(clientConn.RemoteAddr().String())
 
 	// get request type from client
-	reqPacket, reqType, logMsh := getReqType(clientConn)
+	req, logMsh := getReqType(clientConn)
 	if logMsh != nil {
 		logMsh.Log(true)
+		clientConn.Close()
+		return
+	}
+	reqType := req.reqType
+
+	// route the client to the minecraft server selected by the handshake hostname
+	ms := servctrl.ServerByHost(mshPort, req.handshake.Host())
+	if ms == nil {
+		errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_UNKNOWN, "no minecraft server for client %s on msh port %d", clientAddress, mshPort)
+		clientConn.Close()
+		return
+	}
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "client %s reached msh with hostname %s: routing to minecraft server %s", clientAddress, req.handshake.Host(), ms.Config.Name)
+
+	// check that the client address is not exceeding the connection rate of ms
+	// (and that it's not banned, as clients relayed by a proxy are identified only by the proxy protocol header)
+	// if the client was rejected warn the client and return
+	logMshLim := lim.admitAddress(ms.Config, clientAddress)
+	if logMshLim != nil {
+		logMshLim.Log(true)
+		reject(clientConn, ms, req, logMshLim)
+		clientConn.Close()
 		return
 	}
 
 	// if there is a major error warn the client and return
-	if servstats.Stats.MajorError != nil {
-		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_MINECRAFT_SERVER, "a client connected to msh (%s:%d to %s:%d) but minecraft server has encountered major problems", clientAddress, config.MshPort, config.ServHost, config.ServPort)
+	if ms.Stats.MajorError != nil {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_MINECRAFT_SERVER, "a client connected to msh (%s:%d to %s:%d) but minecraft server has encountered major problems", clientAddress, mshPort, ms.Config.ServHost, ms.Config.ServPort)
 
 		// close the client connection before returning
 		defer func() {
@@ -42,28 +87,29 @@ func HandlerClientConn(clientConn net.Conn) {
 			clientConn.Close()
 		}()
 
-		// msh INFO/JOIN response (warn client with error description)
-		mes := buildMessage(reqType, fmt.Sprintf(servstats.Stats.MajorError.Mex, servstats.Stats.MajorError.Arg...))
-		clientConn.Write(mes)
-		errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
-
-		// msh PING response if it was a client INFO request
+		// msh INFO response (and PING response)
 		if reqType == errco.CLIENT_REQ_INFO {
-			logMsh = getPing(clientConn)
+			logMsh = answerInfo(clientConn, ms.Config, req, message(ms, req, config.MSG_MAJOR_ERROR))
 			if logMsh != nil {
 				logMsh.Log(true)
 			}
+			return
 		}
 
+		// msh JOIN response (warn client with error description)
+		mes := buildMessage(ms.Config, reqType, req.handshake.ProtocolVersion, message(ms, req, config.MSG_MAJOR_ERROR))
+		clientConn.Write(mes)
+		errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
+
 		return
 	}
 
 	// handle the request depending on request type
 	switch reqType {
 	case errco.CLIENT_REQ_INFO:
-		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "a client requested server info from %s:%d to %s:%d", clientAddress, config.MshPort, config.ServHost, config.ServPort)
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "a client requested server info from %s:%d to %s:%d", clientAddress, mshPort, ms.Config.ServHost, ms.Config.ServPort)
 
-		if servstats.Stats.Status != errco.SERVER_STATUS_ONLINE || servstats.Stats.Suspended {
+		if ms.Stats.Status.Load() != errco.SERVER_STATUS_ONLINE || ms.Stats.Suspended.Load() {
 			// ms not online or suspended
 
 			defer func() {
@@ -72,23 +118,21 @@ func HandlerClientConn(clientConn net.Conn) {
 				clientConn.Close()
 			}()
 
-			// msh INFO response
-			var mes []byte
-			switch servstats.Stats.Status {
+			// msh INFO message depending on ms status
+			var mes string
+			switch ms.Stats.Status.Load() {
 			case errco.SERVER_STATUS_OFFLINE:
-				mes = buildMessage(reqType, config.ConfigRuntime.Msh.InfoHibernation)
+				mes = render(ms, req, ms.Config.Msh.InfoHibernation)
 			case errco.SERVER_STATUS_STARTING:
-				mes = buildMessage(reqType, config.ConfigRuntime.Msh.InfoStarting)
+				mes = render(ms, req, ms.Config.Msh.InfoStarting)
 			case errco.SERVER_STATUS_ONLINE: // ms suspended
-				mes = buildMessage(reqType, config.ConfigRuntime.Msh.InfoHibernation)
+				mes = render(ms, req, ms.Config.Msh.InfoHibernation)
 			case errco.SERVER_STATUS_STOPPING:
-				mes = buildMessage(reqType, "server is stopping...\nrefresh the page")
+				mes = message(ms, req, config.MSG_STOPPING)
 			}
-			clientConn.Write(mes)
-			errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
 
-			// msh PING response
-			logMsh := getPing(clientConn)
+			// msh INFO response (and PING response)
+			logMsh := answerInfo(clientConn, ms.Config, req, mes)
 			if logMsh != nil {
 				logMsh.Log(true)
 				return
@@ -98,13 +142,13 @@ func HandlerClientConn(clientConn net.Conn) {
 			// ms online and not suspended
 
 			// open proxy between client and server
-			openProxy(clientConn, reqPacket, errco.CLIENT_REQ_INFO)
+			openProxy(ms, clientConn, req)
 		}
 
 	case errco.CLIENT_REQ_JOIN:
-		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "a client tried to join from %s:%d to %s:%d", clientAddress, config.MshPort, config.ServHost, config.ServPort)
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "player %s tried to join from %s:%d to %s:%d", req.loginStart.Name, clientAddress, mshPort, ms.Config.ServHost, ms.Config.ServPort)
 
-		if servstats.Stats.Status != errco.SERVER_STATUS_ONLINE {
+		if ms.Stats.Status.Load() != errco.SERVER_STATUS_ONLINE {
 			// ms not online (un/suspended)
 
 			defer func() {
@@ -113,33 +157,65 @@ func HandlerClientConn(clientConn net.Conn) {
 				clientConn.Close()
 			}()
 
-			// check if the request packet contains element of whitelist or the address is in whitelist
-			logMsh := config.ConfigRuntime.IsWhitelist(reqPacket, clientAddress)
+			// check if the player (name or uuid) or the client address are in whitelist
+			logMsh := ms.Config.IsWhitelist(req.loginStart.Name, req.loginStart.UUID, clientAddress)
 			if logMsh != nil {
 				logMsh.Log(true)
 
 				// msh JOIN response (warn client with text in the loadscreen)
-				mes := buildMessage(reqType, "You don't have permission to warm this server")
+				mes := buildMessage(ms.Config, reqType, req.handshake.ProtocolVersion, message(ms, req, config.MSG_NOT_WHITELISTED))
 				clientConn.Write(mes)
 				errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
 
 				return
 			}
 
+			// check that the client address is not exceeding the warm attempts rate
+			// (only joins that start ms are warm attempts: rejoining while ms is starting or stopping is not counted)
+			if ms.Stats.Status.Load() == errco.SERVER_STATUS_OFFLINE {
+				logMsh = lim.admitWarm(ms.Config, clientAddress)
+				if logMsh != nil {
+					logMsh.Log(true)
+					reject(clientConn, ms, req, logMsh)
+					return
+				}
+			}
+
 			// issue warm
-			logMsh = servctrl.WarmMS()
+			logMsh = ms.WarmMS()
 			if logMsh != nil {
 				// msh JOIN response (warn client with text in the loadscreen)
 				logMsh.Log(true)
-				mes := buildMessage(reqType, "An error occurred while warming the server: check the msh log")
+				mes := buildMessage(ms.Config, reqType, req.handshake.ProtocolVersion, message(ms, req, config.MSG_WARM_ERROR))
 				clientConn.Write(mes)
 				errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
 
 				return
 			}
 
+			// hold the player in limbo until ms is online
+			// (clients that can't be transferred are answered with text in the loadscreen)
+			if canLimbo(ms, req) {
+				logMsh = limbo(ms, clientConn, req)
+				if logMsh != nil {
+					logMsh.Log(true)
+				}
+				return
+			}
+
+			// hold the client connection until ms is online and then open proxy
+			// (if ms is not online in time the client is answered with text in the loadscreen)
+			if ms.Config.Msh.HoldMaxWait > 0 {
+				logMsh = holdJoin(ms, clientConn)
+				if logMsh == nil {
+					openProxy(ms, clientConn, req)
+					return
+				}
+				logMsh.Log(true)
+			}
+
 			// msh JOIN response (answer client with text in the loadscreen)
-			mes := buildMessage(reqType, "Server start command issued. Please wait... "+servstats.Stats.LoadProgress)
+			mes := buildMessage(ms.Config, reqType, req.handshake.ProtocolVersion, message(ms, req, config.MSG_STARTING))
 			clientConn.Write(mes)
 			errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
 
@@ -147,11 +223,11 @@ func HandlerClientConn(clientConn net.Conn) {
 			// ms online (un/suspended)
 
 			// issue warm
-			logMsh = servctrl.WarmMS()
+			logMsh = ms.WarmMS()
 			if logMsh != nil {
 				// msh JOIN response (warn client with text in the loadscreen)
 				logMsh.Log(true)
-				mes := buildMessage(reqType, "An error occurred while warming the server: check the msh log")
+				mes := buildMessage(ms.Config, reqType, req.handshake.ProtocolVersion, message(ms, req, config.MSG_WARM_ERROR))
 				clientConn.Write(mes)
 				errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
 
@@ -159,11 +235,11 @@ func HandlerClientConn(clientConn net.Conn) {
 			}
 
 			// open proxy between client and server
-			openProxy(clientConn, reqPacket, errco.CLIENT_REQ_JOIN)
+			openProxy(ms, clientConn, req)
 		}
 
 	default:
-		mes := buildMessage(reqType, "Client request unknown")
+		mes := buildMessage(ms.Config, reqType, req.handshake.ProtocolVersion, message(ms, req, config.MSG_REQ_UNKNOWN))
 		clientConn.Write(mes)
 		errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
 	}
@@ -171,101 +247,74 @@ func HandlerClientConn(clientConn net.Conn) {
 
 // openProxy opens a proxy connections between mincraft server and mincraft client.
 //
-// It sends the request packet for ms to interpret.
+// It sends the request packets for ms to interpret.
 //
 // The req parameter indicates what request type (INFO os JOIN) the proxy will be used for.
-func openProxy(clientConn net.Conn, serverInitPacket []byte, req int) {
+//
+// Returns when the proxy is closed.
+func openProxy(ms *servctrl.Server, clientConn net.Conn, req *clientReq) {
 	// open a connection to ms and connect it with the client
-	serverSocket, err := net.Dial("tcp", fmt.Sprintf("%s:%d", config.ServHost, config.ServPort))
+	serverSocket, err := net.Dial("tcp", net.JoinHostPort(ms.Config.ServHost, strconv.Itoa(ms.Config.ServPort)))
 	if err != nil {
 		errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_DIAL, err.Error())
 
 		// msh JOIN response (warn client with text in the loadscreen)
-		mes := buildMessage(errco.CLIENT_REQ_JOIN, "can't connect to server... check if minecraft server is running and set the correct ServPort")
+		mes := buildMessage(ms.Config, errco.CLIENT_REQ_JOIN, req.handshake.ProtocolVersion, message(ms, req, config.MSG_DIAL_ERROR))
 		clientConn.Write(mes)
 		errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> client%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
 
 		return
 	}
 
-	// sends the request packet
-	serverSocket.Write(serverInitPacket)
+	// sends the proxy protocol header so that ms knows the client address
+	if ms.Config.Msh.SendProxyProtocol {
+		serverSocket.Write(proxyproto.NewHeader(clientConn.RemoteAddr(), clientConn.LocalAddr()).Bytes())
+	}
+
+	// players transferred from limbo join ms as if they connected directly
+	if rewriteTransfer(req) {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "player %s transferred from limbo: handshake next state set to login", req.loginStart.Name)
+	}
 
-	// launch proxy client -> server
-	go forwardTCP(clientConn, serverSocket, false, req)
+	// sends the request packets
+	serverSocket.Write(req.raw)
 
-	// launch proxy server -> client
-	go forwardTCP(serverSocket, clientConn, true, req)
+	// forward data between client and server
+	// (the client connection slot is held until the proxy is closed)
+	proxy(ms, clientConn, serverSocket, req)
 }
 
-// forwardTCP takes a source and a destination net.Conn and forwards them.
+// holdJoin holds the connection of a joining client until ms is online and not suspended.
+// The client request packets are not consumed: they are relayed to ms by openProxy.
 //
-// isServerToClient used to know the forwardTCP direction
-//
-// req is used to decide if connection should be counted in servstats.Stats.ConnCount
-//
-// [goroutine]
-func forwardTCP(source, destination net.Conn, isServerToClient bool, req int) {
-	var data []byte = make([]byte, 1024)
-	var direction string
-
-	if isServerToClient {
-		direction = "server --> client"
-	} else {
-		direction = "client --> server"
-	}
-
-	// if client has requested ms join, change connection count
-	if isServerToClient && req == errco.CLIENT_REQ_JOIN { // isServerToClient used to count in only one of the 2 forwardTCP()
-		servstats.Stats.ConnCount++
-		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "A CLIENT CONNECTED TO THE SERVER! (join req) - %d active connections", servstats.Stats.ConnCount)
-
-		defer func() {
-			servstats.Stats.ConnCount--
-			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "A CLIENT DISCONNECTED FROM THE SERVER! (join req) - %d active connections", servstats.Stats.ConnCount)
+// Returns an error if ms is not online within HoldMaxWait, if ms stops or if the client disconnects.
+// clientConn connection should not be closed here (need to be closed in caller function).
+func holdJoin(ms *servctrl.Server, clientConn net.Conn) *errco.MshLog {
+	bc := bufferConn(clientConn)
+	maxWait := time.Now().Add(time.Duration(ms.Config.Msh.HoldMaxWait) * time.Second)
 
-			servctrl.FreezeMSSchedule()
-		}()
-	}
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "holding client connection until %s is online (max %ds)", ms.Config.Name, ms.Config.Msh.HoldMaxWait)
 
 	for {
-		// update read and write timeout
-		source.SetReadDeadline(time.Now().Add(10 * time.Second))
-		destination.SetWriteDeadline(time.Now().Add(10 * time.Second))
-
-		// read data from source
-		dataLen, err := source.Read(data)
-		if err != nil {
-			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CONN_EOF, "closing %15s --> %15s | %s (cause: %s)", strings.Split(source.RemoteAddr().String(), ":")[0], strings.Split(destination.RemoteAddr().String(), ":")[0], direction, err.Error())
-
-			// close the source/destination connections
-			_ = destination.Close()
-			_ = source.Close()
-			return
+		switch {
+		case ms.Stats.MajorError != nil:
+			return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_HOLD, "minecraft server has encountered major problems while holding client connection")
+		case ms.Stats.Status.Load() == errco.SERVER_STATUS_ONLINE && !ms.Stats.Suspended.Load():
+			return nil
+		case ms.Stats.Status.Load() == errco.SERVER_STATUS_OFFLINE, ms.Stats.Status.Load() == errco.SERVER_STATUS_STOPPING:
+			return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_HOLD, "minecraft server is not starting while holding client connection")
+		case time.Now().After(maxWait):
+			return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_HOLD, "minecraft server not online after %ds of holding client connection", ms.Config.Msh.HoldMaxWait)
 		}
 
-		// write data to destination
-		_, err = destination.Write(data[:dataLen])
-		if err != nil {
-			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_CONN_WRITE, "closing %15s --> %15s | %s (cause: %s)", strings.Split(source.RemoteAddr().String(), ":")[0], strings.Split(destination.RemoteAddr().String(), ":")[0], direction, err.Error())
-
-			// close the source/destination connections
-			_ = destination.Close()
-			_ = source.Close()
-			return
-		}
-
-		// calculate bytes/s to client/server
-		if config.ConfigRuntime.Msh.ShowInternetUsage && errco.DebugLvl >= errco.LVL_3 {
-			errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%s%s%s: %v", errco.COLOR_PURPLE, direction, errco.COLOR_RESET, data[:dataLen])
-
-			servstats.Stats.M.Lock()
-			if isServerToClient {
-				servstats.Stats.BytesToClients += float64(dataLen)
-			} else {
-				servstats.Stats.BytesToServer += float64(dataLen)
-			}
-			servstats.Stats.M.Unlock()
+		// wait for a hold tick while checking that the client is still connected
+		// (data sent by the client stays buffered and is relayed to ms)
+		bc.SetReadDeadline(time.Now().Add(holdTick))
+		if _, err := bc.r.Peek(1); err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+			return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_HOLD, "client disconnected while holding connection (%s)", err.Error())
+		} else if err == nil {
+			// avoid spinning on buffered data
+			time.Sleep(holdTick)
 		}
 	}
 }
@@ -282,16 +331,15 @@ func printDataUsage() {
 	for {
 		<-ticker.C
 
-		if !config.ConfigRuntime.Msh.ShowInternetUsage {
-			continue
-		}
+		for _, ms := range servctrl.Servers {
+			if !ms.Config.Msh.ShowInternetUsage {
+				continue
+			}
 
-		if servstats.Stats.BytesToClients != 0 || servstats.Stats.BytesToServer != 0 {
-			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "data/s: %8.3f KB/s to clients | %8.3f KB/s to server", servstats.Stats.BytesToClients/1024, servstats.Stats.BytesToServer/1024)
-			servstats.Stats.M.Lock()
-			servstats.Stats.BytesToClients = 0
-			servstats.Stats.BytesToServer = 0
-			servstats.Stats.M.Unlock()
+			bytesToClients, bytesToServer := ms.Stats.BytesToClients.Swap(0), ms.Stats.BytesToServer.Swap(0)
+			if bytesToClients != 0 || bytesToServer != 0 {
+				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "data/s: %8.3f KB/s to clients | %8.3f KB/s to server (%s)", float64(bytesToClients)/1024, float64(bytesToServer)/1024, ms.Config.Name)
+			}
 		}
 	}
 }
@@ -0,0 +1,57 @@
+package conn
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/servctrl"
+)
+
+func Test_holdJoin(t *testing.T) {
+	c := &config.Configuration{}
+	c.Server.Folder = t.TempDir()
+	c.Msh.HoldMaxWait = 1
+	ms := servctrl.NewServer(c)
+
+	// ms online in time: buffered client data is not consumed
+	ms.Stats.Status.Store(errco.SERVER_STATUS_STARTING)
+	pipe, clientConn := net.Pipe()
+	defer clientConn.Close()
+	mshConn := bufferConn(pipe)
+	go func() {
+		clientConn.Write([]byte{0x42})
+		time.Sleep(3 * holdTick)
+		ms.Stats.Status.Store(errco.SERVER_STATUS_ONLINE)
+	}()
+	if logMsh := holdJoin(ms, mshConn); logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	if b, err := mshConn.ReadByte(); err != nil || b != 0x42 {
+		t.Errorf("buffered client data lost (%v, %v)", b, err)
+	}
+
+	// ms not online within HoldMaxWait
+	ms.Stats.Status.Store(errco.SERVER_STATUS_STARTING)
+	start := time.Now()
+	logMsh := holdJoin(ms, mshConn)
+	if logMsh == nil || time.Since(start) < time.Second {
+		t.Errorf("client connection held while max wait exceeded (%v)", time.Since(start))
+	}
+
+	// ms stopped
+	ms.Stats.Status.Store(errco.SERVER_STATUS_OFFLINE)
+	if logMsh := holdJoin(ms, mshConn); logMsh == nil {
+		t.Errorf("client connection held while ms is offline")
+	}
+
+	// client disconnected
+	ms.Stats.Status.Store(errco.SERVER_STATUS_STARTING)
+	clientConn.Close()
+	start = time.Now()
+	if logMsh := holdJoin(ms, mshConn); logMsh == nil || time.Since(start) > 2*holdTick {
+		t.Errorf("client connection held after client disconnected (%v)", time.Since(start))
+	}
+}
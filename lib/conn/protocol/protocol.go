@@ -0,0 +1,490 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"strings"
+
+	"msh/lib/errco"
+)
+
+// reference:
+// - wiki.vg/Protocol
+// - wiki.vg/Server_List_Ping
+// - wiki.vg/Protocol_version_numbers
+
+const (
+	// handshake next states
+
+	STATE_STATUS   int32 = 1 // client is requesting server info
+	STATE_LOGIN    int32 = 2 // client is trying to join the server
+	STATE_TRANSFER int32 = 3 // client is joining after a transfer packet (1.20.5+)
+
+	// packet ids (serverbound)
+
+	ID_HANDSHAKE      int32 = 0x00 // handshaking state
+	ID_STATUS_REQUEST int32 = 0x00 // status state
+	ID_PING           int32 = 0x01 // status state
+	ID_LOGIN_START    int32 = 0x00 // login state
+	ID_LOGIN_ACK      int32 = 0x03 // login state (1.20.2+)
+	ID_CONFIG_ACK     int32 = 0x03 // configuration state (acknowledge finish configuration)
+	ID_CONFIG_PACKS   int32 = 0x07 // configuration state (known packs, 1.20.5+)
+
+	// packet ids (clientbound)
+
+	ID_STATUS_RESPONSE  int32 = 0x00 // status state
+	ID_PONG             int32 = 0x01 // status state
+	ID_LOGIN_DISCONNECT int32 = 0x00 // login state
+	ID_LOGIN_SUCCESS    int32 = 0x02 // login state
+
+	// packet ids (clientbound, 1.20.5+)
+	// (play state packet ids depend on the protocol version: see PlayIDs)
+
+	ID_CONFIG_DISCONNECT    int32 = 0x02 // configuration state
+	ID_CONFIG_FINISH        int32 = 0x03 // configuration state
+	ID_CONFIG_REGISTRY_DATA int32 = 0x07 // configuration state
+	ID_CONFIG_FEATURE_FLAGS int32 = 0x0C // configuration state
+	ID_CONFIG_PACKS_SELECT  int32 = 0x0E // configuration state (known packs)
+
+	// protocol versions that changed the login start packet format
+
+	PROTOCOL_1_19   int32 = 759 // login start: name, optional signature data
+	PROTOCOL_1_19_1 int32 = 760 // login start: name, optional signature data, optional uuid
+	PROTOCOL_1_19_3 int32 = 761 // login start: name, optional uuid
+	PROTOCOL_1_20_2 int32 = 764 // login start: name, uuid
+
+	// protocol versions that support transfer packets and known packs
+
+	PROTOCOL_1_20_5 int32 = 766
+	PROTOCOL_1_21   int32 = 767
+
+	// protocol versions that changed the play packets sent by msh
+
+	PROTOCOL_1_21_2 int32 = 768 // login success without strict error handling, login (play) with sea level, new synchronize player position
+	PROTOCOL_1_21_5 int32 = 770 // spawn experience orb packet removed
+	PROTOCOL_1_21_9 int32 = 773 // debug packets added
+
+	// maximum packet length allowed by the protocol (3 bytes VarInt)
+	maxPacketLen int32 = 2097151
+
+	// MaxClientPacketLen is the maximum length of the packets that a client sends before joining
+	// (handshake, status request, ping and login start: forwarding data of upstream proxies included)
+	MaxClientPacketLen int32 = 8192
+)
+
+// Packet represents an uncompressed minecraft packet
+type Packet struct {
+	ID   int32  // packet id
+	Data []byte // packet data (packet id excluded)
+}
+
+// Handshake represents the first packet sent by a client
+type Handshake struct {
+	ProtocolVersion int32  // protocol version of the client
+	ServerAddress   string // address used by the client to connect
+	ServerPort      uint16 // port used by the client to connect
+	NextState       int32  // STATE_STATUS, STATE_LOGIN or STATE_TRANSFER
+}
+
+// Ping represents the ping packet sent by a client in status state
+type Ping struct {
+	Payload int64 // payload that must be sent back by the pong packet
+}
+
+// LoginStart represents the login start packet sent by a client in login state
+type LoginStart struct {
+	Name string // player name
+	UUID string // player uuid (dashed format, empty if not sent by client)
+}
+
+// PlayIDs are the ids of the clientbound play state packets sent by msh (1.20.5+)
+type PlayIDs struct {
+	Disconnect int32
+	GameEvent  int32
+	KeepAlive  int32
+	Login      int32
+	Position   int32 // synchronize player position
+	SystemChat int32
+	Transfer   int32
+}
+
+// playIDs lists the play state packet ids by the first protocol version that uses them (most recent first)
+var playIDs = []struct {
+	protocol int32
+	ids      PlayIDs
+}{
+	{PROTOCOL_1_21_9, PlayIDs{Disconnect: 0x20, GameEvent: 0x26, KeepAlive: 0x2B, Login: 0x30, Position: 0x46, SystemChat: 0x77, Transfer: 0x7F}},
+	{PROTOCOL_1_21_5, PlayIDs{Disconnect: 0x1C, GameEvent: 0x22, KeepAlive: 0x26, Login: 0x2B, Position: 0x41, SystemChat: 0x72, Transfer: 0x7A}},
+	{PROTOCOL_1_21_2, PlayIDs{Disconnect: 0x1D, GameEvent: 0x23, KeepAlive: 0x27, Login: 0x2C, Position: 0x42, SystemChat: 0x73, Transfer: 0x7A}},
+	{PROTOCOL_1_20_5, PlayIDs{Disconnect: 0x1D, GameEvent: 0x22, KeepAlive: 0x26, Login: 0x2B, Position: 0x40, SystemChat: 0x6C, Transfer: 0x73}},
+}
+
+// PlayPacketIDs returns the play state packet ids of the protocol version.
+// Protocols more recent than the last known one use the most recent packet ids.
+func PlayPacketIDs(protocolVersion int32) PlayIDs {
+	for _, p := range playIDs {
+		if protocolVersion >= p.protocol {
+			return p.ids
+		}
+	}
+	return playIDs[len(playIDs)-1].ids
+}
+
+// NewPacket returns a new packet with the specified id and data
+func NewPacket(id int32, data []byte) *Packet {
+	return &Packet{ID: id, Data: data}
+}
+
+// ReadPacket reads a length-prefixed packet from r.
+//
+// When r is not a io.ByteReader the packet length is read one byte at a time.
+func ReadPacket(r io.Reader) (*Packet, *errco.MshLog) {
+	return ReadPacketMax(r, maxPacketLen)
+}
+
+// ReadPacketMax reads a length-prefixed packet of at most maxLen bytes from r.
+//
+// The packet body is read into a buffer that grows as data arrives:
+// the length declared by the sender does not allocate memory before the body is received.
+func ReadPacketMax(r io.Reader, maxLen int32) (*Packet, *errco.MshLog) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = &byteReader{r}
+	}
+
+	length, logMsh := ReadVarInt(br)
+	if logMsh != nil {
+		return nil, logMsh.AddTrace()
+	}
+	if length <= 0 || length > maxLen {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PACKET_DECODE, "invalid packet length (%d, max %d)", length, maxLen)
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, 512))
+	_, err := io.CopyN(buf, r, int64(length))
+	if err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONN_READ, err.Error())
+	}
+	body := buf.Bytes()
+
+	bodyReader := bytes.NewReader(body)
+	id, logMsh := ReadVarInt(bodyReader)
+	if logMsh != nil {
+		return nil, logMsh.AddTrace()
+	}
+
+	return &Packet{ID: id, Data: body[len(body)-bodyReader.Len():]}, nil
+}
+
+// Bytes returns the packet encoded as length-prefixed bytes
+func (p *Packet) Bytes() []byte {
+	body := AppendVarInt(nil, p.ID)
+	body = append(body, p.Data...)
+
+	return append(AppendVarInt(nil, int32(len(body))), body...)
+}
+
+// DecodeHandshake decodes a handshake packet
+func DecodeHandshake(p *Packet) (*Handshake, *errco.MshLog) {
+	if p.ID != ID_HANDSHAKE {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PACKET_DECODE, "packet is not a handshake (id: %d)", p.ID)
+	}
+
+	var logMsh *errco.MshLog
+	h := &Handshake{}
+	r := bytes.NewReader(p.Data)
+
+	if h.ProtocolVersion, logMsh = ReadVarInt(r); logMsh != nil {
+		return nil, logMsh.AddTrace()
+	}
+	if h.ServerAddress, logMsh = ReadString(r); logMsh != nil {
+		return nil, logMsh.AddTrace()
+	}
+	if h.ServerPort, logMsh = ReadUint16(r); logMsh != nil {
+		return nil, logMsh.AddTrace()
+	}
+	if h.NextState, logMsh = ReadVarInt(r); logMsh != nil {
+		return nil, logMsh.AddTrace()
+	}
+
+	switch h.NextState {
+	case STATE_STATUS, STATE_LOGIN, STATE_TRANSFER:
+	default:
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PACKET_DECODE, "handshake next state unknown (%d)", h.NextState)
+	}
+
+	return h, nil
+}
+
+// Packet returns the handshake encoded as packet
+func (h *Handshake) Packet() *Packet {
+	data := AppendVarInt(nil, h.ProtocolVersion)
+	data = AppendString(data, h.ServerAddress)
+	data = binary.BigEndian.AppendUint16(data, h.ServerPort)
+	data = AppendVarInt(data, h.NextState)
+
+	return NewPacket(ID_HANDSHAKE, data)
+}
+
+// Host returns the hostname that the client used to reach msh.
+//
+// Data appended to the server address by modded clients or proxies (Forge "\x00FML\x00", BungeeCord forwarding)
+// and the trailing dot of fully qualified domain names are removed.
+func (h *Handshake) Host() string {
+	host, _, _ := strings.Cut(h.ServerAddress, "\x00")
+	host = strings.TrimSuffix(host, ".")
+
+	return strings.ToLower(host)
+}
+
+// DecodePing decodes a ping packet
+func DecodePing(p *Packet) (*Ping, *errco.MshLog) {
+	if p.ID != ID_PING {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PACKET_DECODE, "packet is not a ping (id: %d)", p.ID)
+	}
+
+	payload, logMsh := ReadInt64(bytes.NewReader(p.Data))
+	if logMsh != nil {
+		return nil, logMsh.AddTrace()
+	}
+
+	return &Ping{Payload: payload}, nil
+}
+
+// Pong returns the pong packet that answers the ping
+func (ping *Ping) Pong() *Packet {
+	return NewPacket(ID_PONG, binary.BigEndian.AppendUint64(nil, uint64(ping.Payload)))
+}
+
+// IsStatusRequest returns true if the packet is a status request
+func IsStatusRequest(p *Packet) bool {
+	return p.ID == ID_STATUS_REQUEST && len(p.Data) == 0
+}
+
+// DecodeLoginStart decodes a login start packet.
+// The packet format depends on the protocol version declared in the handshake.
+func DecodeLoginStart(p *Packet, protocolVersion int32) (*LoginStart, *errco.MshLog) {
+	if p.ID != ID_LOGIN_START {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PACKET_DECODE, "packet is not a login start (id: %d)", p.ID)
+	}
+
+	var logMsh *errco.MshLog
+	l := &LoginStart{}
+	r := bytes.NewReader(p.Data)
+
+	if l.Name, logMsh = ReadString(r); logMsh != nil {
+		return nil, logMsh.AddTrace()
+	}
+
+	// signature data (1.19 - 1.19.2)
+	if protocolVersion == PROTOCOL_1_19 || protocolVersion == PROTOCOL_1_19_1 {
+		hasSigData, logMsh := ReadBool(r)
+		if logMsh != nil {
+			return nil, logMsh.AddTrace()
+		}
+		if hasSigData {
+			// timestamp, public key, signature
+			if _, logMsh = ReadInt64(r); logMsh != nil {
+				return nil, logMsh.AddTrace()
+			}
+			if _, logMsh = ReadByteArray(r); logMsh != nil {
+				return nil, logMsh.AddTrace()
+			}
+			if _, logMsh = ReadByteArray(r); logMsh != nil {
+				return nil, logMsh.AddTrace()
+			}
+		}
+	}
+
+	// player uuid
+	switch {
+	case protocolVersion >= PROTOCOL_1_20_2:
+		if l.UUID, logMsh = ReadUUID(r); logMsh != nil {
+			return nil, logMsh.AddTrace()
+		}
+	case protocolVersion >= PROTOCOL_1_19_1:
+		hasUUID, logMsh := ReadBool(r)
+		if logMsh != nil {
+			return nil, logMsh.AddTrace()
+		}
+		if hasUUID {
+			if l.UUID, logMsh = ReadUUID(r); logMsh != nil {
+				return nil, logMsh.AddTrace()
+			}
+		}
+	}
+
+	return l, nil
+}
+
+// ------------------- data types ------------------ //
+
+// ReadVarInt reads a VarInt
+func ReadVarInt(r io.ByteReader) (int32, *errco.MshLog) {
+	v, logMsh := readVar(r, 5)
+	if logMsh != nil {
+		return 0, logMsh.AddTrace()
+	}
+	return int32(uint32(v)), nil
+}
+
+// ReadVarLong reads a VarLong
+func ReadVarLong(r io.ByteReader) (int64, *errco.MshLog) {
+	v, logMsh := readVar(r, 10)
+	if logMsh != nil {
+		return 0, logMsh.AddTrace()
+	}
+	return int64(v), nil
+}
+
+// AppendVarInt appends v encoded as VarInt to b
+func AppendVarInt(b []byte, v int32) []byte {
+	return appendVar(b, uint64(uint32(v)))
+}
+
+// AppendVarLong appends v encoded as VarLong to b
+func AppendVarLong(b []byte, v int64) []byte {
+	return appendVar(b, uint64(v))
+}
+
+// ReadString reads a VarInt length-prefixed UTF-8 string
+func ReadString(r *bytes.Reader) (string, *errco.MshLog) {
+	data, logMsh := ReadByteArray(r)
+	if logMsh != nil {
+		return "", logMsh.AddTrace()
+	}
+	return string(data), nil
+}
+
+// AppendString appends s encoded as VarInt length-prefixed string to b
+func AppendString(b []byte, s string) []byte {
+	b = AppendVarInt(b, int32(len(s)))
+	return append(b, s...)
+}
+
+// ReadByteArray reads a VarInt length-prefixed byte array
+func ReadByteArray(r *bytes.Reader) ([]byte, *errco.MshLog) {
+	length, logMsh := ReadVarInt(r)
+	if logMsh != nil {
+		return nil, logMsh.AddTrace()
+	}
+	if length < 0 || int(length) > r.Len() {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PACKET_DECODE, "invalid array length (%d, remaining %d bytes)", length, r.Len())
+	}
+
+	data := make([]byte, length)
+	_, _ = r.Read(data)
+
+	return data, nil
+}
+
+// ReadUint16 reads a big endian unsigned short
+func ReadUint16(r *bytes.Reader) (uint16, *errco.MshLog) {
+	var v uint16
+	if err := binary.Read(r, binary.BigEndian, &v); err != nil {
+		return 0, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PACKET_DECODE, "could not read unsigned short: %s", err.Error())
+	}
+	return v, nil
+}
+
+// ReadInt64 reads a big endian long
+func ReadInt64(r *bytes.Reader) (int64, *errco.MshLog) {
+	var v int64
+	if err := binary.Read(r, binary.BigEndian, &v); err != nil {
+		return 0, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PACKET_DECODE, "could not read long: %s", err.Error())
+	}
+	return v, nil
+}
+
+// ReadBool reads a boolean
+func ReadBool(r *bytes.Reader) (bool, *errco.MshLog) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return false, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PACKET_DECODE, "could not read boolean: %s", err.Error())
+	}
+	return b != 0, nil
+}
+
+// ReadUUID reads a 128 bit uuid and returns it in dashed format
+func ReadUUID(r *bytes.Reader) (string, *errco.MshLog) {
+	var u [16]byte
+	if _, err := io.ReadFull(r, u[:]); err != nil {
+		return "", errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PACKET_DECODE, "could not read uuid: %s", err.Error())
+	}
+	return FormatUUID(u), nil
+}
+
+// AppendUUID appends the uuid (dashed or undashed format) encoded as 128 bit integer to b.
+// An invalid uuid is encoded as nil uuid.
+func AppendUUID(b []byte, uuid string) []byte {
+	u, err := hex.DecodeString(strings.ReplaceAll(uuid, "-", ""))
+	if err != nil || len(u) != 16 {
+		u = make([]byte, 16)
+	}
+	return append(b, u...)
+}
+
+// AppendNBTString appends s encoded as network NBT string tag to b
+// (used by text components since 1.20.3: formatting codes are kept)
+func AppendNBTString(b []byte, s string) []byte {
+	b = append(b, 0x08) // TAG_String
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// AppendBool appends v encoded as boolean to b
+func AppendBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 1)
+	}
+	return append(b, 0)
+}
+
+// FormatUUID returns the uuid in dashed format (xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx)
+func FormatUUID(u [16]byte) string {
+	h := hex.EncodeToString(u[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// readVar reads a variable length integer of at most maxBytes bytes
+func readVar(r io.ByteReader, maxBytes int) (uint64, *errco.MshLog) {
+	var v uint64
+	for i := 0; i < maxBytes; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONN_READ, err.Error())
+		}
+
+		v |= uint64(b&0x7f) << (7 * i)
+
+		// most significant bit not set: last byte
+		if b&0x80 == 0 {
+			return v, nil
+		}
+	}
+
+	return 0, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PACKET_DECODE, "variable length integer is too big")
+}
+
+// appendVar appends v encoded as variable length integer to b
+func appendVar(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// byteReader reads one byte at a time from a io.Reader
+type byteReader struct {
+	io.Reader
+}
+
+// ReadByte reads a single byte
+func (br *byteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	_, err := io.ReadFull(br.Reader, b[:])
+	return b[0], err
+}
@@ -0,0 +1,201 @@
+package protocol
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+)
+
+func Test_VarInt(t *testing.T) {
+	type test struct {
+		val int32
+		enc []byte
+	}
+
+	// examples from wiki.vg/Protocol#VarInt_and_VarLong
+	var tests []test = []test{
+		{0, []byte{0x00}},
+		{1, []byte{0x01}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{255, []byte{0xff, 0x01}},
+		{25565, []byte{0xdd, 0xc7, 0x01}},
+		{2097151, []byte{0xff, 0xff, 0x7f}},
+		{2147483647, []byte{0xff, 0xff, 0xff, 0xff, 0x07}},
+		{-1, []byte{0xff, 0xff, 0xff, 0xff, 0x0f}},
+		{-2147483648, []byte{0x80, 0x80, 0x80, 0x80, 0x08}},
+	}
+
+	for _, tt := range tests {
+		if enc := AppendVarInt(nil, tt.val); !bytes.Equal(enc, tt.enc) {
+			t.Errorf("%d encoded as %v (expected %v)", tt.val, enc, tt.enc)
+		}
+
+		val, logMsh := ReadVarInt(bytes.NewReader(tt.enc))
+		if logMsh != nil {
+			t.Errorf(logMsh.Mex, logMsh.Arg...)
+		} else if val != tt.val {
+			t.Errorf("%v decoded as %d (expected %d)", tt.enc, val, tt.val)
+		}
+	}
+
+	// VarInt longer than 5 bytes
+	if _, logMsh := ReadVarInt(bytes.NewReader([]byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x01})); logMsh == nil {
+		t.Errorf("VarInt longer than 5 bytes was decoded")
+	}
+}
+
+func Test_VarLong(t *testing.T) {
+	for _, val := range []int64{0, 1, 127, 128, 9223372036854775807, -1, -9223372036854775808} {
+		dec, logMsh := ReadVarLong(bytes.NewReader(AppendVarLong(nil, val)))
+		if logMsh != nil {
+			t.Errorf(logMsh.Mex, logMsh.Arg...)
+		} else if dec != val {
+			t.Errorf("%d decoded as %d", val, dec)
+		}
+	}
+}
+
+func Test_Handshake(t *testing.T) {
+	h := &Handshake{ProtocolVersion: 761, ServerAddress: "play.example.com", ServerPort: 25565, NextState: STATE_LOGIN}
+
+	p, logMsh := ReadPacket(bytes.NewReader(h.Packet().Bytes()))
+	if logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+
+	dec, logMsh := DecodeHandshake(p)
+	if logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+
+	if *dec != *h {
+		t.Errorf("handshake decoded as %+v (expected %+v)", dec, h)
+	}
+
+	// handshake captured from 1.19.3 client
+	p, logMsh = ReadPacket(bytes.NewReader([]byte{16, 0, 249, 5, 9, 49, 50, 55, 46, 48, 46, 48, 46, 49, 99, 211, 1}))
+	if logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	dec, logMsh = DecodeHandshake(p)
+	if logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	if *dec != (Handshake{761, "127.0.0.1", 25555, STATE_STATUS}) {
+		t.Errorf("unexpected handshake decoded: %+v", dec)
+	}
+
+	// truncated handshake
+	if _, logMsh := DecodeHandshake(NewPacket(ID_HANDSHAKE, []byte{249, 5, 9, 49, 50})); logMsh == nil {
+		t.Errorf("truncated handshake was decoded")
+	}
+}
+
+func Test_HandshakeHost(t *testing.T) {
+	tests := map[string]string{
+		"play.example.com":                 "play.example.com",
+		"Play.Example.com.":                "play.example.com",
+		"mods.example.com\x00FML2\x00":     "mods.example.com",
+		"127.0.0.1\x00192.168.1.2\x00uuid": "127.0.0.1",
+	}
+
+	for addr, expect := range tests {
+		h := &Handshake{ServerAddress: addr}
+		if host := h.Host(); host != expect {
+			t.Errorf("%q host is %q (expected %q)", addr, host, expect)
+		}
+	}
+}
+
+func Test_DecodeLoginStart(t *testing.T) {
+	type test struct {
+		title    string
+		data     []byte
+		protocol int32
+		expect   LoginStart
+	}
+
+	var tests []test = []test{
+		{
+			"1.18.2 (name)",
+			[]byte{9, 103, 101, 107, 105, 103, 101, 107, 57, 57},
+			758,
+			LoginStart{Name: "gekigek99"},
+		},
+		{
+			"1.19 (name, no signature data)",
+			[]byte{9, 103, 101, 107, 105, 103, 101, 107, 57, 57, 0},
+			759,
+			LoginStart{Name: "gekigek99"},
+		},
+		{
+			"1.19.2 (name, signature data, uuid)",
+			[]byte{9, 103, 101, 107, 105, 103, 101, 107, 57, 57, 1, 0, 0, 0, 0, 0, 0, 0, 1, 2, 7, 7, 1, 9, 1, 196, 93, 252, 169, 146, 189, 69, 1, 169, 208, 156, 201, 205, 197, 2, 113},
+			760,
+			LoginStart{Name: "gekigek99", UUID: "c45dfca9-92bd-4501-a9d0-9cc9cdc50271"},
+		},
+		{
+			"1.19.3 (name, uuid)",
+			[]byte{9, 103, 101, 107, 105, 103, 101, 107, 57, 57, 1, 196, 93, 252, 169, 146, 189, 69, 1, 169, 208, 156, 201, 205, 197, 2, 113},
+			761,
+			LoginStart{Name: "gekigek99", UUID: "c45dfca9-92bd-4501-a9d0-9cc9cdc50271"},
+		},
+		{
+			"1.20.2 (name, uuid not optional)",
+			[]byte{9, 103, 101, 107, 105, 103, 101, 107, 57, 57, 196, 93, 252, 169, 146, 189, 69, 1, 169, 208, 156, 201, 205, 197, 2, 113},
+			764,
+			LoginStart{Name: "gekigek99", UUID: "c45dfca9-92bd-4501-a9d0-9cc9cdc50271"},
+		},
+	}
+
+	for _, tt := range tests {
+		l, logMsh := DecodeLoginStart(NewPacket(ID_LOGIN_START, tt.data), tt.protocol)
+		if logMsh != nil {
+			t.Errorf("%s: "+logMsh.Mex, append([]interface{}{tt.title}, logMsh.Arg...)...)
+			continue
+		}
+
+		if *l != tt.expect {
+			t.Errorf("%s: login start decoded as %+v (expected %+v)", tt.title, l, tt.expect)
+		}
+	}
+}
+
+func Test_ReadPacketMax(t *testing.T) {
+	h := (&Handshake{ProtocolVersion: 761, ServerAddress: "play.example.com", ServerPort: 25565, NextState: STATE_LOGIN}).Packet().Bytes()
+
+	if _, logMsh := ReadPacketMax(bytes.NewReader(h), MaxClientPacketLen); logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	if _, logMsh := ReadPacketMax(bytes.NewReader(h), 8); logMsh == nil {
+		t.Errorf("packet longer than max length was read")
+	}
+
+	// a declared length of 2 MiB followed by a few bytes must not allocate 2 MiB
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, logMsh := ReadPacket(bytes.NewReader([]byte{0xff, 0xff, 0x7f, 0, 1, 2})); logMsh == nil {
+		t.Errorf("truncated packet was read")
+	}
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 64*1024 {
+		t.Errorf("truncated packet allocated %d bytes", alloc)
+	}
+}
+
+func Test_Ping(t *testing.T) {
+	p, logMsh := ReadPacket(bytes.NewReader([]byte{9, 1, 0, 0, 0, 0, 0, 89, 73, 114}))
+	if logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+
+	ping, logMsh := DecodePing(p)
+	if logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+
+	if pong := ping.Pong().Bytes(); !bytes.Equal(pong, []byte{9, 1, 0, 0, 0, 0, 0, 89, 73, 114}) {
+		t.Errorf("unexpected pong: %v", pong)
+	}
+}
@@ -0,0 +1,68 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"msh/lib/errco"
+)
+
+// reference:
+// - developer.valvesoftware.com/wiki/Source_RCON_Protocol
+// - wiki.vg/RCON
+
+const (
+	// rcon packet types
+
+	RCON_RESPONSE      int32 = 0 // SERVERDATA_RESPONSE_VALUE
+	RCON_COMMAND       int32 = 2 // SERVERDATA_EXECCOMMAND (serverbound)
+	RCON_AUTH_RESPONSE int32 = 2 // SERVERDATA_AUTH_RESPONSE (clientbound)
+	RCON_AUTH          int32 = 3 // SERVERDATA_AUTH
+
+	RCON_MAX_COMMAND  int = 1446 // max length of a command body accepted by minecraft servers
+	RCON_MAX_RESPONSE int = 4096 // max length of a response body sent in a single packet by minecraft servers
+
+	rconMaxPacketLen int32 = 4 + 4 + 4096 + 2 // max length of an rcon packet (after the length field)
+)
+
+// RconPacket represents an rcon packet
+type RconPacket struct {
+	ID   int32 // request id (-1 in auth response if authentication failed)
+	Type int32
+	Body string
+}
+
+// ReadRconPacket reads an rcon packet from r
+func ReadRconPacket(r io.Reader) (*RconPacket, *errco.MshLog) {
+	var length int32
+	err := binary.Read(r, binary.LittleEndian, &length)
+	if err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONN_READ, err.Error())
+	}
+	if length < 10 || length > rconMaxPacketLen {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PACKET_DECODE, "invalid rcon packet length (%d)", length)
+	}
+
+	data := make([]byte, length)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CONN_READ, err.Error())
+	}
+
+	return &RconPacket{
+		ID:   int32(binary.LittleEndian.Uint32(data[0:4])),
+		Type: int32(binary.LittleEndian.Uint32(data[4:8])),
+		Body: string(bytes.TrimRight(data[8:], "\x00")),
+	}, nil
+}
+
+// Bytes returns the rcon packet encoded as length-prefixed bytes
+func (p *RconPacket) Bytes() []byte {
+	b := binary.LittleEndian.AppendUint32(nil, uint32(4+4+len(p.Body)+2))
+	b = binary.LittleEndian.AppendUint32(b, uint32(p.ID))
+	b = binary.LittleEndian.AppendUint32(b, uint32(p.Type))
+	b = append(b, p.Body...)
+
+	return append(b, 0, 0) // body and packet terminators
+}
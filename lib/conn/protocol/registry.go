@@ -0,0 +1,80 @@
+package protocol
+
+// reference:
+// - wiki.vg/Registry_Data
+// - wiki.vg/Protocol#Clientbound_Known_Packs
+
+// Registry is a registry synchronized with clients in configuration state
+type Registry struct {
+	ID      string   // registry identifier
+	Entries []string // entry identifiers (the first entry is the default one)
+}
+
+// damageTypes lists the damage types that clients require (1.20.5+)
+var damageTypes []string = []string{
+	"arrow", "bad_respawn_point", "cactus", "cramming", "dragon_breath", "drown", "dry_out", "explosion",
+	"fall", "falling_anvil", "falling_block", "falling_stalactite", "fireball", "fireworks", "fly_into_wall", "freeze",
+	"generic", "generic_kill", "hot_floor", "in_fire", "in_wall", "indirect_magic", "lava", "lightning_bolt",
+	"mace_smash", "magic", "mob_attack", "mob_attack_no_aggro", "mob_projectile", "on_fire", "out_of_world", "outside_border",
+	"player_attack", "player_explosion", "sonic_boom", "spit", "stalagmite", "starve", "sting", "sweet_berry_bush",
+	"thorns", "thrown", "trident", "unattributed_fireball", "wind_charge", "wither", "wither_skull",
+}
+
+// Registries returns the minimal registries that allow a client to join a void world (1.20.5+).
+//
+// Only entry identifiers are sent: clients load entries data from the vanilla data pack,
+// so they must declare the "minecraft:core" known pack.
+func Registries(protocolVersion int32) []Registry {
+	damage := append([]string{}, damageTypes...)
+	if protocolVersion >= PROTOCOL_1_21 {
+		damage = append(damage, "campfire")
+	}
+	if protocolVersion >= PROTOCOL_1_21_2 {
+		damage = append(damage, "ender_pearl")
+	}
+
+	registries := []Registry{
+		{"minecraft:dimension_type", []string{"overworld", "overworld_caves", "the_end", "the_nether"}},
+		{"minecraft:worldgen/biome", []string{"plains", "the_void"}},
+		{"minecraft:chat_type", []string{"chat", "emote_command", "msg_command_incoming", "msg_command_outgoing", "say_command", "team_msg_command_incoming", "team_msg_command_outgoing"}},
+		{"minecraft:trim_pattern", []string{"coast"}},
+		{"minecraft:trim_material", []string{"amethyst"}},
+		{"minecraft:wolf_variant", []string{"pale"}},
+		{"minecraft:banner_pattern", []string{"base"}},
+		{"minecraft:damage_type", damage},
+	}
+
+	if protocolVersion >= PROTOCOL_1_21 {
+		registries = append(registries,
+			Registry{"minecraft:painting_variant", []string{"kebab"}},
+			Registry{"minecraft:jukebox_song", []string{"13"}},
+			Registry{"minecraft:enchantment", []string{"protection"}},
+		)
+	}
+
+	// mob variants are data driven since 1.21.5
+	if protocolVersion >= PROTOCOL_1_21_5 {
+		registries = append(registries,
+			Registry{"minecraft:wolf_sound_variant", []string{"classic"}},
+			Registry{"minecraft:pig_variant", []string{"temperate"}},
+			Registry{"minecraft:frog_variant", []string{"temperate"}},
+			Registry{"minecraft:cat_variant", []string{"tabby"}},
+			Registry{"minecraft:cow_variant", []string{"temperate"}},
+			Registry{"minecraft:chicken_variant", []string{"temperate"}},
+		)
+	}
+
+	return registries
+}
+
+// Packet returns the registry data packet of the registry (entries data is not included)
+func (r Registry) Packet() *Packet {
+	data := AppendString(nil, r.ID)
+	data = AppendVarInt(data, int32(len(r.Entries)))
+	for _, e := range r.Entries {
+		data = AppendString(data, "minecraft:"+e)
+		data = AppendBool(data, false) // entry data is loaded from known pack
+	}
+
+	return NewPacket(ID_CONFIG_REGISTRY_DATA, data)
+}
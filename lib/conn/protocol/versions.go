@@ -0,0 +1,108 @@
+package protocol
+
+import (
+	"strconv"
+	"strings"
+)
+
+// reference:
+// - wiki.vg/Protocol_version_numbers
+
+// versions lists the release versions of minecraft java edition and their protocol number (oldest first)
+var versions = []struct {
+	name     string
+	protocol int32
+}{
+	{"1.7.2", 4}, {"1.7.4", 4}, {"1.7.5", 4},
+	{"1.7.6", 5}, {"1.7.7", 5}, {"1.7.8", 5}, {"1.7.9", 5}, {"1.7.10", 5},
+	{"1.8", 47}, {"1.8.1", 47}, {"1.8.2", 47}, {"1.8.3", 47}, {"1.8.4", 47}, {"1.8.5", 47}, {"1.8.6", 47}, {"1.8.7", 47}, {"1.8.8", 47}, {"1.8.9", 47},
+	{"1.9", 107}, {"1.9.1", 108}, {"1.9.2", 109}, {"1.9.3", 110}, {"1.9.4", 110},
+	{"1.10", 210}, {"1.10.1", 210}, {"1.10.2", 210},
+	{"1.11", 315}, {"1.11.1", 316}, {"1.11.2", 316},
+	{"1.12", 335}, {"1.12.1", 338}, {"1.12.2", 340},
+	{"1.13", 393}, {"1.13.1", 401}, {"1.13.2", 404},
+	{"1.14", 477}, {"1.14.1", 480}, {"1.14.2", 485}, {"1.14.3", 490}, {"1.14.4", 498},
+	{"1.15", 573}, {"1.15.1", 575}, {"1.15.2", 578},
+	{"1.16", 735}, {"1.16.1", 736}, {"1.16.2", 751}, {"1.16.3", 753}, {"1.16.4", 754}, {"1.16.5", 754},
+	{"1.17", 755}, {"1.17.1", 756},
+	{"1.18", 757}, {"1.18.1", 757}, {"1.18.2", 758},
+	{"1.19", 759}, {"1.19.1", 760}, {"1.19.2", 760}, {"1.19.3", 761}, {"1.19.4", 762},
+	{"1.20", 763}, {"1.20.1", 763}, {"1.20.2", 764}, {"1.20.3", 765}, {"1.20.4", 765}, {"1.20.5", 766}, {"1.20.6", 766},
+	{"1.21", 767}, {"1.21.1", 767}, {"1.21.2", 768}, {"1.21.3", 768}, {"1.21.4", 769}, {"1.21.5", 770}, {"1.21.6", 771}, {"1.21.7", 772}, {"1.21.8", 772},
+	{"1.21.9", 773}, {"1.21.10", 773},
+}
+
+// VersionName returns the most recent release version with the specified protocol number.
+// If the protocol is unknown, an empty string is returned.
+func VersionName(protocol int32) string {
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].protocol == protocol {
+			return versions[i].name
+		}
+	}
+	return ""
+}
+
+// VersionNames returns the release versions with the specified protocol number (oldest first)
+func VersionNames(protocol int32) []string {
+	names := []string{}
+	for _, v := range versions {
+		if v.protocol == protocol {
+			names = append(names, v.name)
+		}
+	}
+	return names
+}
+
+// VersionProtocol returns the protocol number of the specified release version
+func VersionProtocol(name string) (int32, bool) {
+	name = strings.TrimSpace(name)
+	for _, v := range versions {
+		if v.name == name {
+			return v.protocol, true
+		}
+	}
+	return -1, false
+}
+
+// ParseRange parses a protocol range.
+// A range is a single protocol or version ("760", "1.19.2") or two of them separated by a dash ("47-767", "1.8-1.21.1").
+func ParseRange(s string) (min, max int32, ok bool) {
+	bounds := strings.Split(s, "-")
+	if len(bounds) > 2 {
+		return 0, 0, false
+	}
+
+	min, ok = parseBound(bounds[0])
+	if !ok {
+		return 0, 0, false
+	}
+	max = min
+	if len(bounds) == 2 {
+		if max, ok = parseBound(bounds[1]); !ok {
+			return 0, 0, false
+		}
+	}
+
+	if min > max {
+		return 0, 0, false
+	}
+
+	return min, max, true
+}
+
+// parseBound parses a protocol number or a release version
+func parseBound(s string) (int32, bool) {
+	s = strings.TrimSpace(s)
+
+	if strings.Contains(s, ".") {
+		return VersionProtocol(s)
+	}
+
+	p, err := strconv.ParseInt(s, 10, 32)
+	if err != nil || p < 0 {
+		return -1, false
+	}
+
+	return int32(p), true
+}
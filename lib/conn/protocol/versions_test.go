@@ -0,0 +1,44 @@
+package protocol
+
+import (
+	"testing"
+)
+
+func Test_Versions(t *testing.T) {
+	if name := VersionName(760); name != "1.19.2" {
+		t.Errorf("protocol 760 is version %q (expected 1.19.2)", name)
+	}
+	if name := VersionName(1); name != "" {
+		t.Errorf("unknown protocol is version %q", name)
+	}
+	if p, ok := VersionProtocol("1.8.9"); !ok || p != 47 {
+		t.Errorf("version 1.8.9 is protocol %d (expected 47)", p)
+	}
+}
+
+func Test_ParseRange(t *testing.T) {
+	type test struct {
+		r      string
+		expMin int32
+		expMax int32
+		expOk  bool
+	}
+
+	var tests []test = []test{
+		{"760", 760, 760, true},
+		{"1.19.2", 760, 760, true},
+		{"47-767", 47, 767, true},
+		{"1.8 - 1.21.1", 47, 767, true},
+		{"767-47", 0, 0, false},
+		{"1.99", 0, 0, false},
+		{"1-2-3", 0, 0, false},
+		{"abc", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		min, max, ok := ParseRange(tt.r)
+		if min != tt.expMin || max != tt.expMax || ok != tt.expOk {
+			t.Errorf("range %q parsed as %d-%d (ok: %t), expected %d-%d (ok: %t)", tt.r, min, max, ok, tt.expMin, tt.expMax, tt.expOk)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"msh/lib/errco"
+)
+
+// reference:
+// - haproxy.org/download/2.8/doc/proxy-protocol.txt
+
+const (
+	CMD_LOCAL byte = 0x0 // connection established by the proxy itself (addresses must be ignored)
+	CMD_PROXY byte = 0x1 // connection established on behalf of another node (addresses are relayed)
+
+	famUnspec byte = 0x00 // unknown address family
+	famTCP4   byte = 0x11 // TCP over IPv4
+	famTCP6   byte = 0x21 // TCP over IPv6
+
+	maxV1Len int = 107 // max length of a v1 header (CRLF included)
+)
+
+var (
+	sigV1 []byte = []byte("PROXY ")                                                               // v1 header signature
+	sigV2 []byte = []byte{0x0d, 0x0a, 0x0d, 0x0a, 0x00, 0x0d, 0x0a, 0x51, 0x55, 0x49, 0x54, 0x0a} // v2 header signature
+)
+
+// Header is a PROXY protocol header
+type Header struct {
+	Version byte         // protocol version (1 or 2)
+	Command byte         // CMD_LOCAL / CMD_PROXY (v1 headers are always CMD_PROXY)
+	SrcAddr *net.TCPAddr // address of the client (nil if unknown)
+	DstAddr *net.TCPAddr // address the client connected to (nil if unknown)
+}
+
+// NewHeader returns a v2 PROXY header that relays the specified source and destination addresses.
+// If the addresses are not tcp addresses of the same family, the header does not relay them.
+func NewHeader(src, dst net.Addr) *Header {
+	h := &Header{Version: 2, Command: CMD_PROXY}
+
+	srcTCP, okSrc := src.(*net.TCPAddr)
+	dstTCP, okDst := dst.(*net.TCPAddr)
+	if okSrc && okDst && (srcTCP.IP.To4() == nil) == (dstTCP.IP.To4() == nil) {
+		h.SrcAddr, h.DstAddr = srcTCP, dstTCP
+	}
+
+	return h
+}
+
+// ReadHeader reads a v1 or v2 PROXY header from r.
+// Returns an error if r does not start with a PROXY header.
+func ReadHeader(r *bufio.Reader) (*Header, *errco.MshLog) {
+	// v1 signature is shorter than v2 signature: peek it first
+	sig, err := r.Peek(len(sigV1))
+	if err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROXY_PROTOCOL, "could not read proxy protocol header: %s", err.Error())
+	}
+
+	if bytes.Equal(sig, sigV1) {
+		return readV1(r)
+	}
+
+	sig, err = r.Peek(len(sigV2))
+	if err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROXY_PROTOCOL, "could not read proxy protocol header: %s", err.Error())
+	}
+
+	if bytes.Equal(sig, sigV2) {
+		return readV2(r)
+	}
+
+	return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROXY_PROTOCOL, "proxy protocol header missing")
+}
+
+// Bytes returns the header encoded according to its version
+func (h *Header) Bytes() []byte {
+	if h.Version == 1 {
+		return h.bytesV1()
+	}
+	return h.bytesV2()
+}
+
+// readV1 reads a v1 (human readable) header.
+//
+// format: "PROXY TCP4 <src ip> <dst ip> <src port> <dst port>\r\n" or "PROXY UNKNOWN ...\r\n"
+func readV1(r *bufio.Reader) (*Header, *errco.MshLog) {
+	var line []byte
+	for len(line) < maxV1Len {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROXY_PROTOCOL, "could not read proxy protocol v1 header: %s", err.Error())
+		}
+		line = append(line, b)
+
+		if bytes.HasSuffix(line, []byte("\r\n")) {
+			return parseV1(string(line[:len(line)-2]))
+		}
+	}
+
+	return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROXY_PROTOCOL, "proxy protocol v1 header too long")
+}
+
+// parseV1 parses a v1 header line (CRLF excluded)
+func parseV1(line string) (*Header, *errco.MshLog) {
+	h := &Header{Version: 1, Command: CMD_PROXY}
+
+	fields := strings.Split(line, " ")
+	if len(fields) < 2 {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROXY_PROTOCOL, "proxy protocol v1 header malformed: %q", line)
+	}
+
+	switch fields[1] {
+	case "UNKNOWN":
+		// addresses must be ignored
+		return h, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROXY_PROTOCOL, "proxy protocol v1 protocol unsupported: %s", fields[1])
+	}
+
+	if len(fields) != 6 {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROXY_PROTOCOL, "proxy protocol v1 header malformed: %q", line)
+	}
+
+	srcIP, dstIP := net.ParseIP(fields[2]), net.ParseIP(fields[3])
+	srcPort, errSrc := strconv.ParseUint(fields[4], 10, 16)
+	dstPort, errDst := strconv.ParseUint(fields[5], 10, 16)
+	if srcIP == nil || dstIP == nil || errSrc != nil || errDst != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROXY_PROTOCOL, "proxy protocol v1 addresses malformed: %q", line)
+	}
+	if (fields[1] == "TCP4") != (srcIP.To4() != nil && dstIP.To4() != nil) {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROXY_PROTOCOL, "proxy protocol v1 addresses do not match protocol: %q", line)
+	}
+
+	h.SrcAddr = &net.TCPAddr{IP: srcIP, Port: int(srcPort)}
+	h.DstAddr = &net.TCPAddr{IP: dstIP, Port: int(dstPort)}
+
+	return h, nil
+}
+
+// readV2 reads a v2 (binary) header.
+//
+// format: [ signature (12) | version+command (1) | family+protocol (1) | length (2) | addresses + TLVs (length) ]
+func readV2(r *bufio.Reader) (*Header, *errco.MshLog) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROXY_PROTOCOL, "could not read proxy protocol v2 header: %s", err.Error())
+	}
+
+	if fixed[12]>>4 != 2 {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROXY_PROTOCOL, "proxy protocol v2 version unsupported: %d", fixed[12]>>4)
+	}
+
+	h := &Header{Version: 2, Command: fixed[12] & 0x0f}
+	if h.Command != CMD_LOCAL && h.Command != CMD_PROXY {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROXY_PROTOCOL, "proxy protocol v2 command unsupported: %d", h.Command)
+	}
+
+	data := make([]byte, binary.BigEndian.Uint16(fixed[14:16]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROXY_PROTOCOL, "could not read proxy protocol v2 addresses: %s", err.Error())
+	}
+
+	// addresses of LOCAL connections must be ignored
+	if h.Command == CMD_LOCAL {
+		return h, nil
+	}
+
+	var ipLen int
+	switch fixed[13] {
+	case famTCP4:
+		ipLen = net.IPv4len
+	case famTCP6:
+		ipLen = net.IPv6len
+	default:
+		// unsupported address family: addresses are ignored (TLVs skipped)
+		return h, nil
+	}
+
+	if len(data) < 2*ipLen+4 {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PROXY_PROTOCOL, "proxy protocol v2 addresses truncated")
+	}
+
+	h.SrcAddr = &net.TCPAddr{
+		IP:   net.IP(data[:ipLen]),
+		Port: int(binary.BigEndian.Uint16(data[2*ipLen:])),
+	}
+	h.DstAddr = &net.TCPAddr{
+		IP:   net.IP(data[ipLen : 2*ipLen]),
+		Port: int(binary.BigEndian.Uint16(data[2*ipLen+2:])),
+	}
+
+	return h, nil
+}
+
+// bytesV1 encodes the header in v1 format
+func (h *Header) bytesV1() []byte {
+	if h.Command == CMD_LOCAL || h.SrcAddr == nil || h.DstAddr == nil {
+		return []byte("PROXY UNKNOWN\r\n")
+	}
+
+	proto := "TCP6"
+	if h.SrcAddr.IP.To4() != nil {
+		proto = "TCP4"
+	}
+
+	return []byte("PROXY " + proto + " " + h.SrcAddr.IP.String() + " " + h.DstAddr.IP.String() + " " + strconv.Itoa(h.SrcAddr.Port) + " " + strconv.Itoa(h.DstAddr.Port) + "\r\n")
+}
+
+// bytesV2 encodes the header in v2 format
+func (h *Header) bytesV2() []byte {
+	b := append([]byte{}, sigV2...)
+	b = append(b, 0x20|h.Command)
+
+	switch {
+	case h.Command == CMD_LOCAL || h.SrcAddr == nil || h.DstAddr == nil:
+		b = append(b, famUnspec)
+		b = binary.BigEndian.AppendUint16(b, 0)
+
+	case h.SrcAddr.IP.To4() != nil:
+		b = append(b, famTCP4)
+		b = binary.BigEndian.AppendUint16(b, 2*net.IPv4len+4)
+		b = append(b, h.SrcAddr.IP.To4()...)
+		b = append(b, h.DstAddr.IP.To4()...)
+		b = binary.BigEndian.AppendUint16(b, uint16(h.SrcAddr.Port))
+		b = binary.BigEndian.AppendUint16(b, uint16(h.DstAddr.Port))
+
+	default:
+		b = append(b, famTCP6)
+		b = binary.BigEndian.AppendUint16(b, 2*net.IPv6len+4)
+		b = append(b, h.SrcAddr.IP.To16()...)
+		b = append(b, h.DstAddr.IP.To16()...)
+		b = binary.BigEndian.AppendUint16(b, uint16(h.SrcAddr.Port))
+		b = binary.BigEndian.AppendUint16(b, uint16(h.DstAddr.Port))
+	}
+
+	return b
+}
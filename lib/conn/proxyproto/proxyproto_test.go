@@ -0,0 +1,146 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+)
+
+func Test_ReadHeader(t *testing.T) {
+	type test struct {
+		title  string
+		data   []byte
+		expErr bool
+		expSrc string
+		expDst string
+	}
+
+	var tests []test = []test{
+		{
+			"v1 tcp4",
+			[]byte("PROXY TCP4 192.168.1.2 10.0.0.1 56324 25565\r\n"),
+			false,
+			"192.168.1.2:56324",
+			"10.0.0.1:25565",
+		},
+		{
+			"v1 tcp6",
+			[]byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 25565\r\n"),
+			false,
+			"[2001:db8::1]:56324",
+			"[2001:db8::2]:25565",
+		},
+		{
+			"v1 unknown",
+			[]byte("PROXY UNKNOWN\r\n"),
+			false,
+			"",
+			"",
+		},
+		{
+			"v2 tcp4",
+			append(append([]byte{}, sigV2...), 0x21, 0x11, 0x00, 0x0c, 192, 168, 1, 2, 10, 0, 0, 1, 0xdc, 0x04, 0x63, 0xdd),
+			false,
+			"192.168.1.2:56324",
+			"10.0.0.1:25565",
+		},
+		{
+			"v2 tcp4 with tlv",
+			append(append([]byte{}, sigV2...), 0x21, 0x11, 0x00, 0x10, 192, 168, 1, 2, 10, 0, 0, 1, 0xdc, 0x04, 0x63, 0xdd, 0x04, 0x00, 0x01, 0x00),
+			false,
+			"192.168.1.2:56324",
+			"10.0.0.1:25565",
+		},
+		{
+			"v2 local",
+			append(append([]byte{}, sigV2...), 0x20, 0x00, 0x00, 0x00),
+			false,
+			"",
+			"",
+		},
+		{
+			"v1 address mismatch",
+			[]byte("PROXY TCP4 2001:db8::1 10.0.0.1 56324 25565\r\n"),
+			true,
+			"",
+			"",
+		},
+		{
+			"v1 too long",
+			append([]byte("PROXY TCP4 "), bytes.Repeat([]byte("1"), 120)...),
+			true,
+			"",
+			"",
+		},
+		{
+			"v2 truncated",
+			append(append([]byte{}, sigV2...), 0x21, 0x11, 0x00, 0x0c, 192, 168),
+			true,
+			"",
+			"",
+		},
+		{
+			"missing header (minecraft handshake)",
+			[]byte{16, 0, 249, 5, 9, 49, 50, 55, 46, 48, 46, 48, 46, 49, 99, 211, 1},
+			true,
+			"",
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		h, logMsh := ReadHeader(bufio.NewReader(bytes.NewReader(tt.data)))
+		switch {
+		case logMsh != nil && !tt.expErr:
+			t.Errorf("%s: unexpected error: "+logMsh.Mex, append([]interface{}{tt.title}, logMsh.Arg...)...)
+			continue
+		case logMsh == nil && tt.expErr:
+			t.Errorf("%s: error expected", tt.title)
+			continue
+		case logMsh != nil:
+			continue
+		}
+
+		var src, dst string
+		if h.SrcAddr != nil {
+			src, dst = h.SrcAddr.String(), h.DstAddr.String()
+		}
+		if src != tt.expSrc || dst != tt.expDst {
+			t.Errorf("%s: addresses decoded as %s -> %s (expected %s -> %s)", tt.title, src, dst, tt.expSrc, tt.expDst)
+		}
+	}
+}
+
+func Test_HeaderBytes(t *testing.T) {
+	for _, addr := range [][2]string{{"192.168.1.2:56324", "10.0.0.1:25565"}, {"[2001:db8::1]:56324", "[2001:db8::2]:25565"}} {
+		src, _ := net.ResolveTCPAddr("tcp", addr[0])
+		dst, _ := net.ResolveTCPAddr("tcp", addr[1])
+
+		for _, version := range []byte{1, 2} {
+			h := NewHeader(src, dst)
+			h.Version = version
+
+			// data following the header must not be consumed
+			r := bufio.NewReader(bytes.NewReader(append(h.Bytes(), 0xff)))
+
+			dec, logMsh := ReadHeader(r)
+			if logMsh != nil {
+				t.Errorf("v%d %s: "+logMsh.Mex, append([]interface{}{version, addr[0]}, logMsh.Arg...)...)
+				continue
+			}
+			if dec.SrcAddr.String() != addr[0] || dec.DstAddr.String() != addr[1] {
+				t.Errorf("v%d: addresses decoded as %s -> %s (expected %s -> %s)", version, dec.SrcAddr, dec.DstAddr, addr[0], addr[1])
+			}
+			if b, err := r.ReadByte(); err != nil || b != 0xff {
+				t.Errorf("v%d: data following the header was consumed", version)
+			}
+		}
+	}
+
+	// addresses of different families are not relayed
+	h := NewHeader(&net.TCPAddr{IP: net.ParseIP("192.168.1.2"), Port: 1}, &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 2})
+	if !bytes.Equal(h.Bytes(), append(append([]byte{}, sigV2...), 0x21, 0x00, 0x00, 0x00)) {
+		t.Errorf("unexpected header for mixed address families: %v", h.Bytes())
+	}
+}
@@ -13,6 +13,7 @@ package errco
 0x07xxxx: input package
 0x08xxxx: errco package
 0x09xxxx: servstats package
+0x0axxxx: traffic package
 */
 
 // -------------------- log -------------------- //
@@ -87,10 +88,16 @@ const (
 	ERROR_SERVER_OFFLINE_SUSPENDED LogCod = 0x00f20a // minecraft server is offline but not suspended
 	ERROR_SERVER_STOPPING          LogCod = 0x00f20b // minecraft server is stopping
 	ERROR_SERVER_UNRESPONDING      LogCod = 0x00f20c // minecraft server is not responding
+	ERROR_SERVER_UNKNOWN           LogCod = 0x00f20d // minecraft server is unknown
 	ERROR_PIPE_INPUT_WRITE         LogCod = 0x00f300 // terminal input writing error
 	ERROR_PIPE_LOAD                LogCod = 0x00f301 // terminal pipe load error
 	ERROR_CONVERSION               LogCod = 0x00f400 // variable conversion error
 	ERROR_WRONG_CONNECTION_COUNT   LogCod = 0x00f500 // connection count does not correspond to ms player count
+	ERROR_RCON                     LogCod = 0x00f600 // error while executing a command via rcon
+	ERROR_RCON_AUTH                LogCod = 0x00f601 // rcon authentication failed
+	ERROR_LIFECYCLE                LogCod = 0x00f700 // error while managing ms lifecycle
+	ERROR_LIFECYCLE_COMMAND        LogCod = 0x00f701 // lifecycle command failed
+	ERROR_LIFECYCLE_API            LogCod = 0x00f702 // lifecycle api request failed
 
 	// program manager package
 
@@ -109,13 +116,25 @@ const (
 	ERROR_CONN_READ           LogCod = 0x02f102 // error while reading from client connection
 	ERROR_CONN_WRITE          LogCod = 0x02f103 // error while writing to client connection
 	ERROR_CONN_EOF            LogCod = 0x02f104 // read EOF from client connection
+	ERROR_CONN_IDLE           LogCod = 0x02f105 // connection closed for inactivity
 	ERROR_SERVER_DIAL         LogCod = 0x02f200 // error while dialing ms server
 	ERROR_SERVER_REQUEST_INFO LogCod = 0x02f201 // error while msh server info request
 	ERROR_JSON_MARSHAL        LogCod = 0x02f300 // error while exporting struct to json bytes
 	ERROR_JSON_UNMARSHAL      LogCod = 0x02f301 // error while importing struct from json bytes
 	ERROR_QUERY_CHALLENGE     LogCod = 0x02f401 // error caused by query challenge
 	ERROR_QUERY_BAD_REQUEST   LogCod = 0x02f402 // error caused by query request
+	ERROR_QUERY_RATE          LogCod = 0x02f403 // query request dropped: query requests rate exceeded
 	ERROR_PING_PACKET_UNKNOWN LogCod = 0x02f500 // error ping packet received is unknown
+	ERROR_PACKET_DECODE       LogCod = 0x02f600 // error while decoding a minecraft packet
+	ERROR_PROXY_PROTOCOL      LogCod = 0x02f700 // error while reading/writing a proxy protocol header
+	ERROR_CONN_LIMIT          LogCod = 0x02f800 // client rejected: max concurrent connections reached
+	ERROR_CONN_RATE           LogCod = 0x02f801 // client rejected: connection rate exceeded by client address
+	ERROR_WARM_RATE           LogCod = 0x02f802 // client rejected: warm attempts rate exceeded by client address
+	ERROR_CONN_BANNED         LogCod = 0x02f803 // client rejected: client address is banned
+	ERROR_RCON_AUTH_RATE      LogCod = 0x02f804 // client rejected: failed msh rcon authentications rate exceeded by client address
+	ERROR_LIMBO               LogCod = 0x02f900 // error while holding a client in limbo
+	ERROR_HOLD                LogCod = 0x02f901 // error while holding a client connection until ms is online
+	ERROR_RCON_CLIENT         LogCod = 0x02fa00 // error while handling an msh rcon client
 
 	// config package
 
@@ -166,4 +185,10 @@ const (
 
 	// servstats package
 	ERROR_MINECRAFT_SERVER LogCod = 0x09f000 // major error while starting minecraft server (will be communicated to clients trying to join)
+	ERROR_STARTS_LOAD      LogCod = 0x09f100 // error while loading start durations from file
+	ERROR_STARTS_SAVE      LogCod = 0x09f101 // error while saving start durations to file
+
+	// traffic package
+	ERROR_TRAFFIC_LOAD LogCod = 0x0af000 // error while loading traffic totals from file
+	ERROR_TRAFFIC_SAVE LogCod = 0x0af001 // error while saving traffic totals to file
 )
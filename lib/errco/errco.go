@@ -6,6 +6,8 @@ import (
 	"runtime"
 	"strings"
 	"time"
+
+	"msh/lib/chat"
 )
 
 // DebugLvl specify the level of debugging
@@ -128,7 +130,7 @@ func (logMsh *MshLog) Log(tracing bool) *MshLog {
 	case TYPE_SER:
 		typ = fmt.Sprintf("%s%-6s%s", COLOR_GRAY, string(logMod.Typ), COLOR_RESET)
 		ori = "\x00"
-		mex = fmt.Sprintf("%s%s%s", COLOR_GRAY, StringGraphic(fmt.Sprintf(logMod.Mex, logMod.Arg...)), COLOR_RESET) // first transform string to graphic then add coloring (fixes non-graphic bytes written on ms stdout)
+		mex = fmt.Sprintf("%s%s%s", COLOR_GRAY, chat.LegacyToANSI(StringGraphic(fmt.Sprintf(logMod.Mex, logMod.Arg...)), COLOR_GRAY), COLOR_RESET) // first transform string to graphic then add coloring (fixes non-graphic bytes written on ms stdout, "§" formatting codes are rendered)
 		cod = "\x00"
 	case TYPE_BYT:
 		typ = fmt.Sprintf("%s%-6s%s", COLOR_PURPLE, string(logMod.Typ), COLOR_RESET)
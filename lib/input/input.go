@@ -8,11 +8,16 @@ import (
 	"msh/lib/errco"
 	"msh/lib/progmgr"
 	"msh/lib/servctrl"
-	"msh/lib/servstats"
+	"msh/lib/traffic"
+	"msh/lib/utility"
 
 	"github.com/chzyer/readline"
 )
 
+// mshCommands are the commands of msh target
+// (used to distinguish "msh <command> <args>" from "msh <name> <command>")
+var mshCommands []string = []string{"start", "freeze", "exit", "status", "traffic", "whitelist"}
+
 // GetInput is used to read input from user.
 // [goroutine]
 func GetInput() {
@@ -24,8 +29,26 @@ func GetInput() {
 					readline.PcItem("start"),
 					readline.PcItem("freeze"),
 					readline.PcItem("exit"),
+					readline.PcItem("status"),
+					readline.PcItem("traffic"),
+					readline.PcItem("whitelist",
+						readline.PcItem("test"),
+						readline.PcItem("reload"),
+					),
+					readline.PcItemDynamic(serverNames,
+						readline.PcItem("start"),
+						readline.PcItem("freeze"),
+						readline.PcItem("status"),
+						readline.PcItem("traffic"),
+						readline.PcItem("whitelist",
+							readline.PcItem("test"),
+							readline.PcItem("reload"),
+						),
+					),
+				),
+				readline.PcItem("mine",
+					readline.PcItemDynamic(serverNames),
 				),
-				readline.PcItem("mine"),
 			),
 			FuncFilterInputRune: func(r rune) (rune, bool) {
 				switch r {
@@ -71,33 +94,73 @@ func GetInput() {
 		case "msh":
 			// check that there is a command for the target
 			if len(lineSplit) < 2 {
-				errco.NewLogln(errco.TYPE_WAR, errco.LVL_0, errco.ERROR_COMMAND_INPUT, "specify msh command (start - freeze - exit)")
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_0, errco.ERROR_COMMAND_INPUT, "specify msh command (start - freeze - exit - status - traffic - whitelist)")
 				continue
 			}
 
-			switch lineSplit[1] {
+			// get target minecraft server: "msh <name> <command>" or "msh <command>" (default server)
+			ms, args, named := servctrl.Servers[0], lineSplit[1:], false
+			if len(args) > 1 && !utility.SliceContain(args[0], mshCommands) {
+				var logMsh *errco.MshLog
+				ms, logMsh = servctrl.ServerByName(args[0])
+				if logMsh != nil {
+					logMsh.Log(true)
+					continue
+				}
+				args, named = args[1:], true
+			}
+
+			switch args[0] {
 
 			case "start":
-				logMsh := servctrl.WarmMS()
+				logMsh := ms.WarmMS()
 				if logMsh != nil {
 					logMsh.Log(true)
 				}
 			case "freeze":
 				// stop minecraft server forcefully
-				logMsh := servctrl.FreezeMS(true)
+				logMsh := ms.FreezeMS(true)
 				if logMsh != nil {
 					logMsh.Log(true)
 				}
 			case "exit":
-				// stop minecraft server forcefully
-				logMsh := servctrl.FreezeMS(true)
-				if logMsh != nil {
-					logMsh.Log(true)
-				}
 				// terminate msh
+				// (msh manager stops all minecraft servers forcefully)
 				progmgr.AutoTerminate()
+			case "status":
+				// print minecraft server status and estimated time remaining until it's online
+				for _, line := range ms.StatusReport() {
+					errco.NewLogln(errco.TYPE_INF, errco.LVL_0, errco.ERROR_NIL, "%s", line)
+				}
+			case "traffic":
+				// print traffic of connections and daily totals
+				// (of all minecraft servers if the server is not specified)
+				server := ""
+				if named {
+					server = ms.Config.Name
+				}
+				for _, line := range traffic.Report(server, 7) {
+					errco.NewLogln(errco.TYPE_INF, errco.LVL_0, errco.ERROR_NIL, "%s", line)
+				}
+			case "whitelist":
+				switch {
+				case len(args) >= 4 && args[1] == "test":
+					// check which whitelist entry is matched by client address and player name (or uuid)
+					name, uuid := args[3], ""
+					if len(args) >= 5 {
+						uuid = args[4]
+					}
+					allowed, reason := ms.Config.CheckWhitelist(name, uuid, args[2])
+					errco.NewLogln(errco.TYPE_INF, errco.LVL_0, errco.ERROR_NIL, "whitelist test: player %s (%s) allowed to warm %s: %t (%s)", name, args[2], ms.Config.Name, allowed, reason)
+				case len(args) >= 2 && args[1] == "reload":
+					// compile whitelist entries again (resolve whitelist hostnames)
+					ms.Config.LoadWhitelist()
+					errco.NewLogln(errco.TYPE_INF, errco.LVL_0, errco.ERROR_NIL, "whitelist of %s reloaded", ms.Config.Name)
+				default:
+					errco.NewLogln(errco.TYPE_WAR, errco.LVL_0, errco.ERROR_COMMAND_INPUT, "specify whitelist command (test <ip> <name> [uuid] - reload)")
+				}
 			default:
-				errco.NewLogln(errco.TYPE_WAR, errco.LVL_0, errco.ERROR_COMMAND_UNKNOWN, "unknown command (start - freeze - exit)")
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_0, errco.ERROR_COMMAND_UNKNOWN, "unknown command (start - freeze - exit - status - traffic - whitelist)")
 			}
 
 		// taget minecraft server
@@ -108,21 +171,39 @@ func GetInput() {
 				continue
 			}
 
+			// get target minecraft server: "mine <name> <command>" or "mine <command>" (default server)
+			ms, args := servctrl.Servers[0], lineSplit[1:]
+			if len(args) > 1 {
+				if named, logMsh := servctrl.ServerByName(args[0]); logMsh == nil {
+					ms, args = named, args[1:]
+				}
+			}
+
 			// check if server is online
-			if servstats.Stats.Status != errco.SERVER_STATUS_ONLINE {
-				errco.NewLogln(errco.TYPE_ERR, errco.LVL_0, errco.ERROR_SERVER_NOT_ONLINE, "minecraft server is not online (try \"msh start\")")
+			if ms.Stats.Status.Load() != errco.SERVER_STATUS_ONLINE {
+				errco.NewLogln(errco.TYPE_ERR, errco.LVL_0, errco.ERROR_SERVER_NOT_ONLINE, "minecraft server %s is not online (try \"msh %s start\")", ms.Config.Name, ms.Config.Name)
 				continue
 			}
 
 			// pass the command to the minecraft server terminal
-			_, logMsh := servctrl.Execute(strings.Join(lineSplit[1:], " "))
+			_, logMsh := ms.Execute(strings.Join(args, " "))
 			if logMsh != nil {
 				logMsh.Log(true)
 			}
 
 		// wrong target
 		default:
-			errco.NewLogln(errco.TYPE_WAR, errco.LVL_0, errco.ERROR_COMMAND_INPUT, "specify the target application by adding \"msh\" or \"mine\" before the command.\nExample to get op: mine op <yourname>\nExample to freeze minecraft: msh freeze")
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_0, errco.ERROR_COMMAND_INPUT, "specify the target application by adding \"msh\" or \"mine\" before the command.\nExample to get op: mine op <yourname>\nExample to freeze minecraft: msh freeze\nExample to target a minecraft server: msh <servername> start / mine <servername> op <yourname>")
 		}
 	}
 }
+
+// serverNames returns the names of the minecraft servers managed by msh (used for autocompletion)
+func serverNames(string) []string {
+	names := []string{}
+	for _, ms := range servctrl.Servers {
+		names = append(names, ms.Config.Name)
+	}
+
+	return names
+}
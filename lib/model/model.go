@@ -1,8 +1,16 @@
 package model
 
+import (
+	"encoding/json"
+
+	"msh/lib/chat"
+)
+
 // struct adapted to config file
 type Configuration struct {
-	Server struct {
+	Name      string   `json:"Name,omitempty"`      // name of the minecraft server
+	Hostnames []string `json:"Hostnames,omitempty"` // hostnames that clients use to reach the minecraft server
+	Server    struct {
 		Folder   string `json:"Folder"`
 		FileName string `json:"FileName"`
 		Version  string `json:"Version"`
@@ -14,39 +22,78 @@ type Configuration struct {
 		StopServer          string `json:"StopServer"`
 		StopServerAllowKill int    `json:"StopServerAllowKill"`
 	} `json:"Commands"`
+	Lifecycle struct {
+		Mode    string `json:"Mode"`    // how msh manages ms: "process" (ms runs as msh child process), "commands" (ms is managed by the lifecycle commands), "docker" or "kubernetes"
+		Start   string `json:"Start"`   // command that starts ms
+		Stop    string `json:"Stop"`    // command that stops ms (if empty Commands.StopServer is executed on ms)
+		Suspend string `json:"Suspend"` // command that suspends ms (required by SuspendAllow)
+		Resume  string `json:"Resume"`  // command that resumes ms (required by SuspendAllow)
+		Status  string `json:"Status"`  // command that exits with 0 if ms is running (if empty status pings are used)
+		Host    string `json:"Host"`    // address of ms (if empty 127.0.0.1)
+		Port    int    `json:"Port"`    // port of ms (if 0 read from server.properties)
+
+		RconPort     int    `json:"RconPort"`     // rcon port of ms (if 0 read from server.properties)
+		RconPassword string `json:"RconPassword"` // rcon password of ms (if empty read from server.properties, if set rcon is used without checking enable-rcon)
+
+		Container    string `json:"Container"`    // name of the ms docker container (docker mode)
+		DockerSocket string `json:"DockerSocket"` // unix socket of the docker engine api (if empty /var/run/docker.sock)
+
+		Workload   string `json:"Workload"`   // kubernetes workload of ms: "statefulset/<name>" or "deployment/<name>" (kubernetes mode)
+		Namespace  string `json:"Namespace"`  // kubernetes namespace of the workload (if empty namespace of msh service account or kubeconfig context)
+		Kubeconfig string `json:"Kubeconfig"` // kubeconfig file in yaml or json format (if empty msh service account is used)
+	} `json:"Lifecycle"`
 	Msh struct {
-		Debug                         int      `json:"Debug"`
-		ID                            string   `json:"ID"`
-		MshPort                       int      `json:"MshPort"`
-		MshPortQuery                  int      `json:"MshPortQuery"`
-		EnableQuery                   bool     `json:"EnableQuery"`
-		TimeBeforeStoppingEmptyServer int64    `json:"TimeBeforeStoppingEmptyServer"`
-		SuspendAllow                  bool     `json:"SuspendAllow"`   // specify if msh should suspend java server process
-		SuspendRefresh                int      `json:"SuspendRefresh"` // specify if msh should refresh java server process suspension and every how many seconds
-		InfoHibernation               string   `json:"InfoHibernation"`
-		InfoStarting                  string   `json:"InfoStarting"`
-		NotifyUpdate                  bool     `json:"NotifyUpdate"`
-		NotifyMessage                 bool     `json:"NotifyMessage"`
-		Whitelist                     []string `json:"Whitelist"`
-		WhitelistImport               bool     `json:"WhitelistImport"`
-		ShowResourceUsage             bool     `json:"ShowResourceUsage"`
-		ShowInternetUsage             bool     `json:"ShowInternetUsage"`
+		Debug                         int               `json:"Debug"`
+		ID                            string            `json:"ID"`
+		MshPort                       int               `json:"MshPort"`
+		MshPortQuery                  int               `json:"MshPortQuery"`
+		EnableQuery                   bool              `json:"EnableQuery"`
+		TimeBeforeStoppingEmptyServer int64             `json:"TimeBeforeStoppingEmptyServer"`
+		SuspendAllow                  bool              `json:"SuspendAllow"`   // specify if msh should suspend java server process
+		SuspendRefresh                int               `json:"SuspendRefresh"` // specify if msh should refresh java server process suspension and every how many seconds
+		InfoHibernation               string            `json:"InfoHibernation"`
+		InfoStarting                  string            `json:"InfoStarting"`
+		NotifyUpdate                  bool              `json:"NotifyUpdate"`
+		NotifyMessage                 bool              `json:"NotifyMessage"`
+		Whitelist                     []string          `json:"Whitelist"`
+		WhitelistImport               bool              `json:"WhitelistImport"`
+		ShowResourceUsage             bool              `json:"ShowResourceUsage"`
+		ShowInternetUsage             bool              `json:"ShowInternetUsage"`
+		AcceptProxyProtocol           bool              `json:"AcceptProxyProtocol"` // specify if clients connect through a proxy that sends a PROXY protocol header (v1/v2)
+		SendProxyProtocol             bool              `json:"SendProxyProtocol"`   // specify if msh should send a PROXY protocol header (v2) to the minecraft server
+		ConnIdleTimeout               int               `json:"ConnIdleTimeout"`     // seconds without data after which a proxied connection is closed (0 to disable)
+		ConnKeepAlive                 int               `json:"ConnKeepAlive"`       // tcp keepalive period in seconds of proxied connections (0 system default, -1 to disable)
+		MaxConnections                int               `json:"MaxConnections"`      // max concurrent client connections (0 to disable)
+		MaxConnRatePerIP              int               `json:"MaxConnRatePerIP"`    // max connections per minute from the same client address (0 to disable)
+		MaxWarmPerIP                  int               `json:"MaxWarmPerIP"`        // max warm attempts per hour from the same client address (0 to disable)
+		BanDuration                   int               `json:"BanDuration"`         // seconds a client address exceeding the rates is banned (0 to disable)
+		PlayersSample                 []string          `json:"PlayersSample"`       // lines of the players list shown while hibernating ("{recent}" is replaced by recently seen players)
+		PlayersSampleRecent           int               `json:"PlayersSampleRecent"` // max recently seen players that replace "{recent}"
+		ProtocolEcho                  bool              `json:"ProtocolEcho"`        // specify if the client protocol is reported as server protocol while ms is not online
+		AcceptedProtocols             []string          `json:"AcceptedProtocols"`   // protocol ranges accepted by ms (client protocol is reported if in range)
+		MshPortBedrock                int               `json:"MshPortBedrock"`      // udp port on which msh accepts bedrock edition clients (0 to disable)
+		ServPortBedrock               int               `json:"ServPortBedrock"`     // udp port of ms bedrock edition listener (example: geyser)
+		EnableLimbo                   bool              `json:"EnableLimbo"`         // specify if joining players (1.20.5+) are held in a limbo while ms starts and then transferred to ms
+		LimboMaxWait                  int               `json:"LimboMaxWait"`        // max seconds a player is held in limbo before being disconnected (0 to disable)
+		HoldMaxWait                   int               `json:"HoldMaxWait"`         // max seconds a joining client connection is held open until ms is online (0 to disable)
+		MshPortRcon                   int               `json:"MshPortRcon"`         // tcp port on which msh accepts rcon connections (0 to disable)
+		RconPassword                  string            `json:"RconPassword"`        // password of msh rcon (required to enable msh rcon)
+		RconWarm                      bool              `json:"RconWarm"`            // specify if commands forwarded by msh rcon warm ms (if false they are refused while ms is hibernating)
+		Messages                      map[string]string `json:"Messages"`            // templates of client-facing messages that replace the default ones (message name -> template)
 	} `json:"Msh"`
-}
-
-// struct for message format txt
-type DataTxt struct {
-	Text string `json:"text"`
+	Servers []json.RawMessage `json:"Servers,omitempty"` // additional minecraft servers (parameters not specified are inherited)
 }
 
 // struct for message format info
 type DataInfo struct {
-	Description struct {
-		Text string `json:"text"`
-	} `json:"description"`
-	Players struct {
+	Description *chat.Component `json:"description"`
+	Players     struct {
 		Max    int `json:"max"`
 		Online int `json:"online"`
+		Sample []struct {
+			Name string `json:"name"`
+			ID   string `json:"id"`
+		} `json:"sample,omitempty"`
 	} `json:"players"`
 	Version struct {
 		Name     string `json:"name"`
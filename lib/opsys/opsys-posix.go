@@ -3,8 +3,10 @@
 package opsys
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/exec"
 	"syscall"
 
 	"msh/lib/errco"
@@ -19,6 +21,10 @@ func newProcGroupAttr() *syscall.SysProcAttr {
 	return newProcGroupAttr
 }
 
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
 func procTreeSuspend(ppid uint32) *errco.MshLog {
 	/*
 		check also https://github.com/shirou/gopsutil/blob/2f8da0a39487ceddf44cebe53a1b563b0b7173cc/process/process_posix.go#L141-L153
@@ -3,8 +3,10 @@
 package opsys
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/exec"
 	"syscall"
 	"unsafe"
 
@@ -44,6 +46,10 @@ func newProcGroupAttr() *syscall.SysProcAttr {
 	return newProcGroupAttr
 }
 
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "cmd", "/C", command)
+}
+
 func procTreeSuspend(ppid uint32) *errco.MshLog {
 	// suspendProc suspends a process by pid
 	suspendProc := func(pid uint32) *errco.MshLog {
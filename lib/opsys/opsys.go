@@ -1,6 +1,8 @@
 package opsys
 
 import (
+	"context"
+	"os/exec"
 	"runtime"
 	"syscall"
 
@@ -24,6 +26,11 @@ func NewProcGroupAttr() *syscall.SysProcAttr {
 	return newProcGroupAttr()
 }
 
+// ShellCommand returns the cmd to execute a command line with the system shell
+func ShellCommand(ctx context.Context, command string) *exec.Cmd {
+	return shellCommand(ctx, command)
+}
+
 // ProcTreeSuspend suspends a process tree by pid.
 // when succeeds returns: true, nil
 func ProcTreeSuspend(ppid uint32) (bool, *errco.MshLog) {
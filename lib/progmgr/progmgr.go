@@ -3,12 +3,13 @@ package progmgr
 import (
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"msh/lib/errco"
 	"msh/lib/servctrl"
-	"msh/lib/servstats"
+	"msh/lib/traffic"
 )
 
 /*
@@ -53,30 +54,47 @@ func MshMgr() {
 		sig := <-msh.sigExit
 		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "received signal: %s", sig.String())
 
-		// stop the minecraft server forcefully
-		logMsh := servctrl.FreezeMS(true)
-		if logMsh != nil {
-			logMsh.Log(true)
+		// stop the minecraft servers forcefully
+		// (force freeze waits for starting servers to be online: freeze them concurrently)
+		var wg sync.WaitGroup
+		for _, ms := range servctrl.Servers {
+			wg.Add(1)
+			go func(ms *servctrl.Server) {
+				defer wg.Done()
+				logMsh := ms.FreezeMS(true)
+				if logMsh != nil {
+					logMsh.Log(true)
+				}
+			}(ms)
 		}
+		wg.Wait()
 
 		// send last statistics before exiting
 		go sendApi2Req(updAddr, buildApi2Req(true))
 
-		// wait 1 second to let the server go into stopping mode
+		// wait 1 second to let the servers go into stopping mode
 		time.Sleep(1 * time.Second)
 
-		switch servstats.Stats.Status {
-		case errco.SERVER_STATUS_STOPPING:
-			// if server is correctly stopping, wait for minecraft server to exit
-			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "waiting for minecraft server terminal to exit (minecraft server is stopping)")
-			servctrl.ServTerm.Wg.Wait()
+		for _, ms := range servctrl.Servers {
+			switch ms.Stats.Status.Load() {
+			case errco.SERVER_STATUS_STOPPING:
+				// if server is correctly stopping, wait for minecraft server to exit
+				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "waiting for minecraft server terminal to exit (minecraft server %s is stopping)", ms.Config.Name)
+				ms.Term.Wg.Wait()
+
+			case errco.SERVER_STATUS_OFFLINE:
+				// if server is offline, then it's safe to continue
+				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "minecraft server terminal already exited (minecraft server %s is offline)", ms.Config.Name)
 
-		case errco.SERVER_STATUS_OFFLINE:
-			// if server is offline, then it's safe to continue
-			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "minecraft server terminal already exited (minecraft server is offline)")
+			default:
+				errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "stop command does not seem to be stopping minecraft server %s during forceful shutdown", ms.Config.Name)
+			}
+		}
 
-		default:
-			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "stop command does not seem to be stopping minecraft server during forceful shutdown")
+		// save traffic daily totals
+		logMsh := traffic.Save()
+		if logMsh != nil {
+			logMsh.Log(true)
 		}
 
 		// exit
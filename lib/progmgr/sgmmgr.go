@@ -11,7 +11,6 @@ import (
 	"msh/lib/config"
 	"msh/lib/errco"
 	"msh/lib/servctrl"
-	"msh/lib/servstats"
 
 	"github.com/shirou/gopsutil/mem"
 )
@@ -74,15 +73,19 @@ func sgmMgr() {
 			// increment segment duration counter
 			sgm.stats.dur += 1
 
-			// increment hibernation duration counter if ms is not warm/interactable
-			logMsh := servctrl.CheckMSWarm()
-			if logMsh != nil {
+			// increment hibernation duration counter if no ms is warm/interactable
+			// increment play seconds sum
+			hibernating := true
+			for _, ms := range servctrl.Servers {
+				if ms.CheckMSWarm() == nil {
+					hibernating = false
+				}
+				sgm.stats.playSec += ms.Stats.ConnCount
+			}
+			if hibernating {
 				sgm.stats.hibeDur += 1
 			}
 
-			// increment play seconds sum
-			sgm.stats.playSec += servstats.Stats.ConnCount
-
 			// update segment average cpu/memory usage
 			mshTreeCpu, mshTreeMem := getMshTreeStats()
 			sgm.stats.usageCpu = (sgm.stats.usageCpu*float64(sgm.stats.dur-1) + float64(mshTreeCpu)) / float64(sgm.stats.dur) // sgm.stats.seconds-1 because the average is relative to 1 sec ago
@@ -105,20 +108,22 @@ func sgmMgr() {
 		// send a notification in game chat for players to see.
 		// (should not send notification in console)
 		case <-sgm.push.tk.C:
-			if sgm.push.verCheck != "" && servstats.Stats.ConnCount > 0 {
-				logMsh := servctrl.TellRaw("manager", sgm.push.verCheck, "sgmMgr")
-				if logMsh != nil {
-					logMsh.Log(true)
-				}
-			}
-
-			if len(sgm.push.messages) != 0 && servstats.Stats.ConnCount > 0 {
-				for _, m := range sgm.push.messages {
-					logMsh := servctrl.TellRaw("message", m, "sgmMgr")
+			for _, ms := range servctrl.Servers {
+				if sgm.push.verCheck != "" && ms.Stats.ConnCount > 0 {
+					logMsh := ms.TellRaw("manager", sgm.push.verCheck, "sgmMgr")
 					if logMsh != nil {
 						logMsh.Log(true)
 					}
 				}
+
+				if len(sgm.push.messages) != 0 && ms.Stats.ConnCount > 0 {
+					for _, m := range sgm.push.messages {
+						logMsh := ms.TellRaw("message", m, "sgmMgr")
+						if logMsh != nil {
+							logMsh.Log(true)
+						}
+					}
+				}
 			}
 
 		// send request when segment ends
@@ -165,9 +170,11 @@ func sgmMgr() {
 				errco.NewLogln(errco.TYPE_WAR, errco.LVL_0, errco.ERROR_VERSION, verCheck)
 				sgm.push.verCheck = verCheck
 
-				// override ConfigRuntime variables to display deprecated error message in motd
-				config.ConfigRuntime.Msh.InfoHibernation = "                   §fserver status:\n                   §b§lHIBERNATING\n                   §b§cmsh version DEPRECATED"
-				config.ConfigRuntime.Msh.InfoStarting = "                   §fserver status:\n                    §6§lWARMING UP\n                   §b§cmsh version DEPRECATED"
+				// override runtime config variables to display deprecated error message in motd
+				for _, c := range config.ConfigServers {
+					c.Msh.InfoHibernation = "                   §fserver status:\n                   §b§lHIBERNATING\n                   §b§cmsh version DEPRECATED"
+					c.Msh.InfoStarting = "                   §fserver status:\n                    §6§lWARMING UP\n                   §b§cmsh version DEPRECATED"
+				}
 
 			case "upd": // local version to update
 				if config.ConfigRuntime.Msh.NotifyUpdate {
@@ -76,7 +76,8 @@ func buildApi2Req(preTerm bool) *model.Api2Req {
 		reqJson.Machine.Mem = int64(memInfo.Total)
 	}
 
-	reqJson.Server.Uptime = servctrl.WarmUpTime()
+	// server data refers to the default minecraft server
+	reqJson.Server.Uptime = servctrl.Servers[0].WarmUpTime()
 	reqJson.Server.V = config.ConfigRuntime.Server.Version
 	reqJson.Server.Prot = config.ConfigRuntime.Server.Protocol
 
@@ -3,13 +3,14 @@ package servctrl
 import (
 	"bufio"
 	"encoding/json"
+	"fmt"
 	"io"
 	"os/exec"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"msh/lib/config"
 	"msh/lib/errco"
 	"msh/lib/model"
 	"msh/lib/opsys"
@@ -17,12 +18,17 @@ import (
 	"msh/lib/utility"
 )
 
-// ServTerm is the variable that represent the running minecraft server
-var ServTerm *servTerminal = &servTerminal{IsActive: false}
+// statusNames are the descriptions of minecraft server status
+var statusNames map[int32]string = map[int32]string{
+	errco.SERVER_STATUS_OFFLINE:  "offline",
+	errco.SERVER_STATUS_STARTING: "starting",
+	errco.SERVER_STATUS_ONLINE:   "online",
+	errco.SERVER_STATUS_STOPPING: "stopping",
+}
 
 // servTerminal is the minecraft server terminal
 type servTerminal struct {
-	IsActive  bool
+	IsActive  atomic.Bool    // ms is running (started by msh terminal or by the lifecycle)
 	Wg        sync.WaitGroup // used to wait terminal StdoutPipe/StderrPipe
 	startTime time.Time      // time at which minecraft server terminal was started
 	cmd       *exec.Cmd
@@ -31,55 +37,75 @@ type servTerminal struct {
 	inPipe    io.WriteCloser
 }
 
-// lastOut is a channel used to communicate the last line got from the printer function
-var lastOut = make(chan string)
-
 // Execute executes a command on ms.
 //
-// Returns the output lines of ms terminal with a timeout of 200ms since last output line.
+// If rcon is enabled in server.properties, the command is executed via rcon and its exact output is returned.
+//
+// Otherwise returns the output lines of ms terminal with a timeout of 200ms since last output line.
 //
 // (Execute on command with no output doesn't cause hanging)
 //
 // (Execute on command with multiple lines returns them separated by \n, if print time between them was less than timeout)
 //
 // [non-blocking]
-func Execute(command string) (string, *errco.MshLog) {
+func (ms *Server) Execute(command string) (string, *errco.MshLog) {
 	// check if ms is warm and interactable
-	logMsh := CheckMSWarm()
+	logMsh := ms.CheckMSWarm()
 	if logMsh != nil {
 		return "", logMsh.AddTrace()
 	}
 
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_2, errco.ERROR_NIL, "ms command: %s%s%s\t(origin: %s%s%s)", errco.COLOR_CYAN, command, errco.COLOR_RESET, errco.COLOR_YELLOW, errco.Trace(2), errco.COLOR_RESET)
 
-	// write to server terminal (\n indicates the enter key)
-	_, err := ServTerm.inPipe.Write([]byte(command + "\n"))
-	if err != nil {
-		return "", errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_PIPE_INPUT_WRITE, err.Error())
+	out, _, logMsh := ms.execute(command)
+	if logMsh != nil {
+		return "", logMsh.AddTrace()
 	}
 
-	// read all lines from lastOut
+	return out, nil
+}
+
+// execute executes a command on ms via rcon or, if rcon is not available, via ms terminal.
+// rcon is true if the command was executed via rcon (out is the exact output of the command).
+func (ms *Server) execute(command string) (out string, rcon bool, logMsh *errco.MshLog) {
+	out, sent, logMsh := ms.rcon.exec(command)
+	if sent {
+		if logMsh != nil {
+			return "", true, logMsh.AddTrace()
+		}
+		return out, true, nil
+	} else if logMsh != nil {
+		// rcon is enabled but not reachable: use ms terminal
+		logMsh.Log(true)
+	}
+
+	logMsh = ms.termInput(command)
+	if logMsh != nil {
+		return "", false, logMsh.AddTrace()
+	}
+
+	// read all lines from ms.lastOut
 	// (watchdog used in case there are no more lines to read or output takes too long)
-	var out string = ""
+	out = ""
 a:
 	for {
 		select {
-		case lo := <-lastOut:
+		case lo := <-ms.lastOut:
 			out += lo + "\n"
 		case <-time.NewTimer(200 * time.Millisecond).C:
 			break a
 		}
 	}
 
-	// return the (possibly) full terminal output of Execute()
-	return out, nil
+	// return the (possibly) full terminal output of ms.execute()
+	return out, false, nil
 }
 
 // TellRaw executes a tellraw on ms
 // [non-blocking]
-func TellRaw(reason, text, origin string) *errco.MshLog {
+func (ms *Server) TellRaw(reason, text, origin string) *errco.MshLog {
 	// check if ms is warm and interactable
-	logMsh := CheckMSWarm()
+	logMsh := ms.CheckMSWarm()
 	if logMsh != nil {
 		return logMsh.AddTrace()
 	}
@@ -89,13 +115,38 @@ func TellRaw(reason, text, origin string) *errco.MshLog {
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_JSON_MARSHAL, err.Error())
 	}
 
-	gameMessage = append([]byte("tellraw @a "), gameMessage...)
-	gameMessage = append(gameMessage, []byte("\n")...)
+	command := "tellraw @a " + string(gameMessage)
 
-	errco.NewLogln(errco.TYPE_INF, errco.LVL_2, errco.ERROR_NIL, "ms tellraw: %s%s%s\t(origin: %s)", errco.COLOR_YELLOW, string(gameMessage), errco.COLOR_RESET, origin)
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_2, errco.ERROR_NIL, "ms tellraw: %s%s%s\t(origin: %s)", errco.COLOR_YELLOW, command, errco.COLOR_RESET, origin)
+
+	// execute via rcon if available
+	_, sent, logMsh := ms.rcon.exec(command)
+	if sent {
+		if logMsh != nil {
+			return logMsh.AddTrace()
+		}
+		return nil
+	} else if logMsh != nil {
+		logMsh.Log(true)
+	}
+
+	logMsh = ms.termInput(command)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	return nil
+}
+
+// termInput writes a command to ms terminal.
+// Returns an error if ms is not started by msh (ms terminal is not available).
+func (ms *Server) termInput(command string) *errco.MshLog {
+	if ms.Term.inPipe == nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_TERMINAL_NOT_ACTIVE, "minecraft server terminal not available with lifecycle mode %s: enable rcon in server.properties", ms.Config.Lifecycle.Mode)
+	}
 
 	// write to server terminal (\n indicates the enter key)
-	_, err = ServTerm.inPipe.Write(gameMessage)
+	_, err := ms.Term.inPipe.Write([]byte(command + "\n"))
 	if err != nil {
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_PIPE_INPUT_WRITE, err.Error())
 	}
@@ -105,22 +156,61 @@ func TellRaw(reason, text, origin string) *errco.MshLog {
 
 // TermUpTime returns the current minecraft server terminal uptime.
 // If ms terminal is not running returns -1.
-func TermUpTime() int {
-	if !ServTerm.IsActive {
+func (ms *Server) TermUpTime() int {
+	if !ms.Term.IsActive.Load() {
 		return -1
 	}
 
-	return utility.RoundSec(time.Since(ServTerm.startTime))
+	return utility.RoundSec(time.Since(ms.Term.startTime))
 }
 
 // WarmUpTime returns the current minecraft server warmed uptime.
 // If ms is not warm returns -1.
-func WarmUpTime() int {
-	if err := CheckMSWarm(); err != nil {
+func (ms *Server) WarmUpTime() int {
+	if err := ms.CheckMSWarm(); err != nil {
 		return -1
 	}
 
-	return utility.RoundSec(time.Since(servstats.Stats.WarmUpTime))
+	return utility.RoundSec(time.Since(ms.Stats.WarmUpTime))
+}
+
+// StartETA returns the estimated time remaining until minecraft server is online and not suspended,
+// based on the durations of its previous starts (or resumes if ms is suspended).
+// Returns false if the time remaining can't be estimated.
+func (ms *Server) StartETA() (time.Duration, bool) {
+	switch ms.Stats.Status.Load() {
+	case errco.SERVER_STATUS_OFFLINE:
+		est, n := servstats.EstimateStart(ms.Config.Name, servstats.START_COLD)
+		return est, n > 0
+
+	case errco.SERVER_STATUS_STARTING:
+		est, n := servstats.EstimateStart(ms.Config.Name, servstats.START_COLD)
+		remaining := est - time.Since(ms.Term.startTime)
+		return remaining, n > 0 && remaining > 0
+
+	case errco.SERVER_STATUS_ONLINE:
+		if !ms.Stats.Suspended.Load() {
+			return 0, true
+		}
+		est, n := servstats.EstimateStart(ms.Config.Name, servstats.START_RESUME)
+		return est, n > 0
+
+	default:
+		return 0, false
+	}
+}
+
+// StatusReport returns a description of minecraft server status and of the estimated time remaining until it's online
+func (ms *Server) StatusReport() []string {
+	eta := "unknown"
+	if d, ok := ms.StartETA(); ok {
+		eta = d.Round(time.Second).String()
+	}
+
+	return []string{
+		fmt.Sprintf("%s: status %s | suspended %t | connections %d | load progress %s | ready in %s", ms.Config.Name, statusNames[ms.Stats.Status.Load()], ms.Stats.Suspended.Load(), ms.Stats.ConnCount, ms.Stats.LoadProgress, eta),
+		fmt.Sprintf("%s: start durations: %s", ms.Config.Name, servstats.DescribeStarts(ms.Config.Name)),
+	}
 }
 
 // CheckMSWarm checks if minecraft server is warm and it's possible to interact with it.
@@ -128,15 +218,15 @@ func WarmUpTime() int {
 // Checks if there is no major error, terminal is active, ms status is online and ms process not suspended.
 //
 // If ms is warm and interactable, returns nil
-func CheckMSWarm() *errco.MshLog {
+func (ms *Server) CheckMSWarm() *errco.MshLog {
 	switch {
-	case servstats.Stats.MajorError != nil:
+	case ms.Stats.MajorError != nil:
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_SERVER_UNRESPONDING, "minecraft server not responding")
-	case !ServTerm.IsActive:
+	case !ms.Term.IsActive.Load():
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_TERMINAL_NOT_ACTIVE, "minecraft server terminal not active")
-	case servstats.Stats.Status != errco.SERVER_STATUS_ONLINE:
+	case ms.Stats.Status.Load() != errco.SERVER_STATUS_ONLINE:
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_SERVER_NOT_ONLINE, "minecraft server not online")
-	case servstats.Stats.Suspended:
+	case ms.Stats.Suspended.Load():
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_2, errco.ERROR_SERVER_SUSPENDED, "minecraft server is suspended")
 	}
 
@@ -146,54 +236,54 @@ func CheckMSWarm() *errco.MshLog {
 // termStart starts a new terminal.
 // If server terminal is already active it returns without doing anything
 // [non-blocking]
-func termStart() *errco.MshLog {
-	if ServTerm.IsActive {
+func (ms *Server) termStart() *errco.MshLog {
+	if ms.Term.IsActive.Load() {
 		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_IS_WARM, "minecraft server terminal already active")
 		return nil
 	}
 
-	logMsh := termLoad()
+	logMsh := ms.termLoad()
 	if logMsh != nil {
 		return logMsh.AddTrace()
 	}
 
-	go printerOutErr()
+	go ms.printerOutErr()
 
-	err := ServTerm.cmd.Start()
+	err := ms.Term.cmd.Start()
 	if err != nil {
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_TERMINAL_START, err.Error())
 	}
 
-	go waitForExit()
+	go ms.waitForExit()
 
 	return nil
 }
 
-// termLoad loads cmd/pipes into ServTerm
-func termLoad() *errco.MshLog {
+// termLoad loads cmd/pipes into ms terminal
+func (ms *Server) termLoad() *errco.MshLog {
 	// set terminal cmd
-	command, logMsh := config.ConfigRuntime.BuildCommandStartServer()
+	command, logMsh := ms.Config.BuildCommandStartServer()
 	if logMsh != nil {
 		return logMsh.AddTrace()
 	}
-	ServTerm.cmd = exec.Command(command[0], command[1:]...)
-	ServTerm.cmd.Dir = config.ConfigRuntime.Server.Folder
+	ms.Term.cmd = exec.Command(command[0], command[1:]...)
+	ms.Term.cmd.Dir = ms.Config.Server.Folder
 
 	// launch as new process group so that signals (ex: SIGINT) are sent to msh
 	// (not relayed to the java server child process)
-	ServTerm.cmd.SysProcAttr = opsys.NewProcGroupAttr()
+	ms.Term.cmd.SysProcAttr = opsys.NewProcGroupAttr()
 
 	// set terminal pipes
 	var err error
-	ServTerm.outPipe, err = ServTerm.cmd.StdoutPipe()
+	ms.Term.outPipe, err = ms.Term.cmd.StdoutPipe()
 	if err != nil {
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PIPE_LOAD, "StdoutPipe load: "+err.Error())
 	}
-	ServTerm.errPipe, err = ServTerm.cmd.StderrPipe()
+	ms.Term.errPipe, err = ms.Term.cmd.StderrPipe()
 	if err != nil {
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PIPE_LOAD, "StderrPipe load: "+err.Error())
 	}
-	ServTerm.inPipe, err = ServTerm.cmd.StdinPipe()
+	ms.Term.inPipe, err = ms.Term.cmd.StdinPipe()
 	if err != nil {
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_PIPE_LOAD, "StdinPipe load: "+err.Error())
 	}
@@ -205,103 +295,32 @@ func termLoad() *errco.MshLog {
 // Launches 1 goroutine to scan StdoutPipe and 1 goroutine to scan StderrPipe
 // (Should be called before cmd.Start())
 // [goroutine]
-func printerOutErr() {
+func (ms *Server) printerOutErr() {
 	// add printer-out + printer-err to waitgroup
-	ServTerm.Wg.Add(2)
+	ms.Term.Wg.Add(2)
 
 	// print terminal StdoutPipe
 	// [goroutine]
 	go func() {
 		var line string
 
-		defer ServTerm.Wg.Done()
+		defer ms.Term.Wg.Done()
 
-		scanner := bufio.NewScanner(ServTerm.outPipe)
+		scanner := bufio.NewScanner(ms.Term.outPipe)
 
 		for scanner.Scan() {
 			line = scanner.Text()
 
-			errco.NewLogln(errco.TYPE_SER, errco.LVL_2, errco.ERROR_NIL, line)
+			errco.NewLogln(errco.TYPE_SER, errco.LVL_2, errco.ERROR_NIL, ms.outPrefix()+line)
 
-			// communicate to lastOut so that func Execute() can return the output of the command.
+			// communicate to ms.lastOut so that func ms.Execute() can return the output of the command.
 			// must be a non-blocking select or it might cause hanging
 			select {
-			case lastOut <- line:
+			case ms.lastOut <- line:
 			default:
 			}
 
-			switch servstats.Stats.Status {
-
-			case errco.SERVER_STATUS_STARTING:
-				// for modded server terminal compatibility, use separate check for "INFO" and flag-word
-				// using only "INFO" and not "[Server thread/INFO]"" because paper minecraft servers don't use "[Server thread/INFO]"
-
-				// "Preparing spawn area: " -> update ServStats.LoadProgress
-				if strings.Contains(line, "INFO") && strings.Contains(line, "Preparing spawn area: ") {
-					servstats.Stats.LoadProgress = strings.Split(strings.Split(line, "Preparing spawn area: ")[1], "\n")[0]
-				}
-
-				// ": Done (" -> set ServStats.Status = ONLINE
-				// using ": Done (" instead of "Done" to avoid false positives (issue #112)
-				if strings.Contains(line, "INFO") && strings.Contains(line, ": Done (") {
-					servstats.Stats.Status = errco.SERVER_STATUS_ONLINE
-					errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER IS ONLINE!")
-
-					// schedule soft freeze of ms
-					// (if no players connect the server will shutdown)
-					FreezeMSSchedule()
-				}
-
-			case errco.SERVER_STATUS_ONLINE:
-				// It is possible that a player could send a message that contains text similar to server output:
-				// 		[14:08:43] [Server thread/INFO]: <player> Stopping
-				// 		[14:09:32] [Server thread/INFO]: [player] Stopping
-				//
-				// These are the correct shutdown logs:
-				// 		[14:09:46] [Server thread/INFO]: Stopping the server
-				// 		[15Mar2021 14:09:46.581] [Server thread/INFO] [net.minecraft.server.dedicated.DedicatedServer/]: Stopping the server
-				//
-				// lineSplit is therefore implemented:
-				//
-				// [14:09:46] [Server thread/INFO]: <player> ciao
-				// ^-----------header------------^##^--content--^
-
-				// Continue if line does not contain ": "
-				// (it does not adhere to expected log format or it is a multiline java exception)
-				if !strings.Contains(line, ": ") {
-					continue
-				}
-
-				lineSplit := strings.SplitN(line, ": ", 2)
-				lineHeader := lineSplit[0]
-				lineContent := lineSplit[1]
-
-				if strings.Contains(lineHeader, "INFO") {
-					switch {
-					// player leaves the server
-					case strings.Contains(lineContent, "lost connection:"): // "lost connection" is more general compared to "left the game" (even too much: player might write it in chat -> added ":")
-						FreezeMSSchedule()
-
-					// the server is stopping
-					case strings.Contains(lineContent, "Stopping") && strings.Contains(lineContent, "server"):
-						servstats.Stats.Status = errco.SERVER_STATUS_STOPPING
-						errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER IS STOPPING!")
-					}
-				}
-
-				if strings.Contains(lineHeader, "ERROR") {
-					switch {
-					case strings.Contains(lineContent, "stopped responding!") || strings.Contains(lineContent, "----------"):
-						// example:
-						// PROCESS TREE UNSUSPEDED!
-						// [18:49:08 WARN]: Can't keep up! Is the server overloaded? Running 121938ms or 2438 ticks behind
-						// [18:49:08 ERROR]: ------------------------------
-						// [18:49:08 ERROR]: The server has stopped responding! This is (probably) not a Paper bug.
-						LogMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_SERVER_UNRESPONDING, "MINECRAFT SERVER IS NOT RESPONDING!")
-						servstats.Stats.SetMajorError(LogMsh)
-					}
-				}
-			}
+			ms.parseOutLine(line)
 		}
 	}()
 
@@ -310,61 +329,122 @@ func printerOutErr() {
 	go func() {
 		var line string
 
-		defer ServTerm.Wg.Done()
+		defer ms.Term.Wg.Done()
 
-		scanner := bufio.NewScanner(ServTerm.errPipe)
+		scanner := bufio.NewScanner(ms.Term.errPipe)
 
 		for scanner.Scan() {
 			line = scanner.Text()
 
-			errco.NewLogln(errco.TYPE_SER, errco.LVL_2, errco.ERROR_NIL, line)
+			errco.NewLogln(errco.TYPE_SER, errco.LVL_2, errco.ERROR_NIL, ms.outPrefix()+line)
 		}
 	}()
 }
 
+// parseOutLine updates ms status according to a line of ms output:
+//
+// - starting: load progress and online status.
+//
+// - online: freeze schedule when a player leaves, stopping status and unresponsiveness.
+func (ms *Server) parseOutLine(line string) {
+	switch ms.Stats.Status.Load() {
+
+	case errco.SERVER_STATUS_STARTING:
+		// for modded server terminal compatibility, use separate check for "INFO" and flag-word
+		// using only "INFO" and not "[Server thread/INFO]"" because paper minecraft servers don't use "[Server thread/INFO]"
+
+		// "Preparing spawn area: " -> update ServStats.LoadProgress
+		if strings.Contains(line, "INFO") && strings.Contains(line, "Preparing spawn area: ") {
+			ms.Stats.LoadProgress = strings.Split(strings.Split(line, "Preparing spawn area: ")[1], "\n")[0]
+		}
+
+		// ": Done (" -> set ServStats.Status = ONLINE
+		// using ": Done (" instead of "Done" to avoid false positives (issue #112)
+		if strings.Contains(line, "INFO") && strings.Contains(line, ": Done (") {
+			ms.setOnline(true)
+		}
+
+	case errco.SERVER_STATUS_ONLINE:
+		// It is possible that a player could send a message that contains text similar to server output:
+		// 		[14:08:43] [Server thread/INFO]: <player> Stopping
+		// 		[14:09:32] [Server thread/INFO]: [player] Stopping
+		//
+		// These are the correct shutdown logs:
+		// 		[14:09:46] [Server thread/INFO]: Stopping the server
+		// 		[15Mar2021 14:09:46.581] [Server thread/INFO] [net.minecraft.server.dedicated.DedicatedServer/]: Stopping the server
+		//
+		// lineSplit is therefore implemented:
+		//
+		// [14:09:46] [Server thread/INFO]: <player> ciao
+		// ^-----------header------------^##^--content--^
+
+		// Return if line does not contain ": "
+		// (it does not adhere to expected log format or it is a multiline java exception)
+		if !strings.Contains(line, ": ") {
+			return
+		}
+
+		lineSplit := strings.SplitN(line, ": ", 2)
+		lineHeader := lineSplit[0]
+		lineContent := lineSplit[1]
+
+		if strings.Contains(lineHeader, "INFO") {
+			switch {
+			// player leaves the server
+			case strings.Contains(lineContent, "lost connection:"): // "lost connection" is more general compared to "left the game" (even too much: player might write it in chat -> added ":")
+				ms.FreezeMSSchedule()
+
+			// the server is stopping
+			case strings.Contains(lineContent, "Stopping") && strings.Contains(lineContent, "server"):
+				ms.setStopping()
+			}
+		}
+
+		if strings.Contains(lineHeader, "ERROR") {
+			switch {
+			case strings.Contains(lineContent, "stopped responding!") || strings.Contains(lineContent, "----------"):
+				// example:
+				// PROCESS TREE UNSUSPEDED!
+				// [18:49:08 WARN]: Can't keep up! Is the server overloaded? Running 121938ms or 2438 ticks behind
+				// [18:49:08 ERROR]: ------------------------------
+				// [18:49:08 ERROR]: The server has stopped responding! This is (probably) not a Paper bug.
+				LogMsh := errco.NewLogln(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_SERVER_UNRESPONDING, "MINECRAFT SERVER IS NOT RESPONDING! (%s)", ms.Config.Name)
+				ms.Stats.SetMajorError(LogMsh)
+			}
+		}
+	}
+}
+
 // waitForExit waits for server terminal to exit and manages:
 //
-// - ServTerm.isActive, ServTerm.startTime.
+// - ms.Term.isActive, ms.Term.startTime.
 //
-// - Stats.Status, Stats.Suspended, Stats.ConnCount, Stats.LoadProgress.
+// - Stats.Status (starting/offline), Stats.Suspended, Stats.ConnCount, Stats.LoadProgress.
 //
 // - Suspension refresher.
 //
 // [goroutine]
-func waitForExit() {
-	ServTerm.IsActive = true
-	ServTerm.startTime = time.Now()
-	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "ms terminal started")
-
-	servstats.Stats.Status = errco.SERVER_STATUS_STARTING
-	servstats.Stats.Suspended = false
-	servstats.Stats.ConnCount = 0
-	servstats.Stats.LoadProgress = "0%"
-	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER IS STARTING!")
+func (ms *Server) waitForExit() {
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "ms terminal started (%s)", ms.Config.Name)
+	ms.setStarting()
 
 	// start suspension refresher
 	stopSuspendRefresherC := make(chan bool, 1)
-	go suspendRefresher(stopSuspendRefresherC)
+	go ms.suspendRefresher(stopSuspendRefresherC)
 
 	// wait for server process to finish
-	ServTerm.Wg.Wait()  // wait terminal StdoutPipe/StderrPipe to exit
-	ServTerm.cmd.Wait() // wait process (to avoid defunct java server process)
+	ms.Term.Wg.Wait()  // wait terminal StdoutPipe/StderrPipe to exit
+	ms.Term.cmd.Wait() // wait process (to avoid defunct java server process)
 
-	ServTerm.outPipe.Close()
-	ServTerm.errPipe.Close()
-	ServTerm.inPipe.Close()
+	ms.Term.outPipe.Close()
+	ms.Term.errPipe.Close()
+	ms.Term.inPipe.Close()
 
 	// stop suspension refresher
 	stopSuspendRefresherC <- true
 
-	servstats.Stats.Status = errco.SERVER_STATUS_OFFLINE
-	servstats.Stats.Suspended = false
-	servstats.Stats.ConnCount = 0
-	servstats.Stats.LoadProgress = "0%"
-	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER IS OFFLINE!")
-
-	ServTerm.IsActive = false
-	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "ms terminal exited")
+	ms.setOffline()
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "ms terminal exited (%s)", ms.Config.Name)
 }
 
 // suspendRefresher refreshes ms suspension by warming and freezing the server every set amount of time.
@@ -372,18 +452,18 @@ func waitForExit() {
 // If (suspension || suspension refresh) is not allowed this func just returns.
 //
 // [goroutine stoppable]
-func suspendRefresher(stop chan bool) {
-	if !config.ConfigRuntime.Msh.SuspendAllow {
+func (ms *Server) suspendRefresher(stop chan bool) {
+	if !ms.Config.Msh.SuspendAllow {
 		return
 	}
 
-	if config.ConfigRuntime.Msh.SuspendRefresh <= 0 {
+	if ms.Config.Msh.SuspendRefresh <= 0 {
 		return
 	}
 
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "suspension refresher is starting")
 
-	ticker := time.NewTicker(time.Duration(config.ConfigRuntime.Msh.SuspendRefresh) * time.Second)
+	ticker := time.NewTicker(time.Duration(ms.Config.Msh.SuspendRefresh) * time.Second)
 
 	for {
 		select {
@@ -396,27 +476,27 @@ func suspendRefresher(stop chan bool) {
 		case <-ticker.C:
 			// check if ms is responding, not offline, suspended
 			switch {
-			case servstats.Stats.MajorError != nil:
+			case ms.Stats.MajorError != nil:
 				errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_UNRESPONDING, "minecraft server is not responding")
 				continue
-			case servstats.Stats.Status == errco.SERVER_STATUS_OFFLINE:
+			case ms.Stats.Status.Load() == errco.SERVER_STATUS_OFFLINE:
 				errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_OFFLINE, "minecraft server is offline")
 				continue
-			case !servstats.Stats.Suspended:
+			case !ms.Stats.Suspended.Load():
 				errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_NOT_SUSPENDED, "minecraft server terminal is not suspended")
 				continue
 			}
 
 			// warm ms unsuspending process
 			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "suspension refresh will warm minecraft server...")
-			WarmMS()
+			ms.WarmMS()
 
 			// give time to ms to recover from suspension
 			time.Sleep(1 * time.Second)
 
 			// freeze ms suspending process (softly in case a player has joined in the meantime)
 			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "suspension refresh will freeze minecraft server...")
-			FreezeMS(false)
+			ms.FreezeMS(false)
 		}
 	}
 }
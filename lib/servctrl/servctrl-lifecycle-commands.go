@@ -0,0 +1,159 @@
+package servctrl
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"msh/lib/errco"
+	"msh/lib/opsys"
+)
+
+const lifecycleCommandTimeout time.Duration = 1 * time.Minute // max execution time of a lifecycle command
+
+// cmdLifecycle manages ms with the lifecycle commands set in config
+// (ms is run by an external manager: systemd, tmux, another machine...).
+//
+// ms status is tracked with status pings to ms and with the status command (if set).
+type cmdLifecycle struct {
+	ms *Server
+}
+
+func (lc *cmdLifecycle) attach() {
+	online := lc.online()
+	if running, ok := lc.running(); !online && (!ok || !running) {
+		return
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "minecraft server is already running (%s)", lc.ms.Config.Name)
+	lc.ms.setStarting()
+	if online {
+		lc.ms.setOnline(false)
+	}
+
+	go lc.ms.monitor(lc)
+}
+
+func (lc *cmdLifecycle) start() *errco.MshLog {
+	if lc.ms.Term.IsActive.Load() {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_IS_WARM, "minecraft server already running")
+		return nil
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "executing lifecycle start command (%s)", lc.ms.Config.Name)
+	_, logMsh := lc.run("start", lc.ms.Config.Lifecycle.Start)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	lc.ms.setStarting()
+	go lc.ms.monitor(lc)
+
+	return nil
+}
+
+func (lc *cmdLifecycle) stop() *errco.MshLog {
+	if lc.ms.Config.Lifecycle.Stop == "" {
+		// stop command not set: execute stop command on ms
+		_, logMsh := lc.ms.Execute(lc.ms.Config.Commands.StopServer)
+		if logMsh != nil {
+			return logMsh.AddTrace()
+		}
+	} else {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "executing lifecycle stop command (%s)", lc.ms.Config.Name)
+		_, logMsh := lc.run("stop", lc.ms.Config.Lifecycle.Stop)
+		if logMsh != nil {
+			return logMsh.AddTrace()
+		}
+	}
+
+	lc.ms.setStopping()
+
+	return nil
+}
+
+func (lc *cmdLifecycle) kill() *errco.MshLog {
+	return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_KILL, "minecraft server can't be killed with lifecycle mode %s (check lifecycle stop command)", lc.ms.Config.Lifecycle.Mode)
+}
+
+// suspend and resume execute the lifecycle commands only if ms suspension changes
+// (lifecycle commands might not be idempotent)
+func (lc *cmdLifecycle) suspend() (bool, *errco.MshLog) {
+	if lc.ms.Stats.Suspended.Load() {
+		return true, nil
+	}
+
+	_, logMsh := lc.run("suspend", lc.ms.Config.Lifecycle.Suspend)
+	if logMsh != nil {
+		return false, logMsh.AddTrace()
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "EXECUTED LIFECYCLE SUSPEND! (%s)", lc.ms.Config.Name)
+
+	return true, nil
+}
+
+func (lc *cmdLifecycle) resume() (bool, *errco.MshLog) {
+	if !lc.ms.Stats.Suspended.Load() {
+		return false, nil
+	}
+
+	_, logMsh := lc.run("resume", lc.ms.Config.Lifecycle.Resume)
+	if logMsh != nil {
+		return true, logMsh.AddTrace()
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "EXECUTED LIFECYCLE RESUME! (%s)", lc.ms.Config.Name)
+
+	return false, nil
+}
+
+// online returns true if ms answers status pings
+func (lc *cmdLifecycle) online() bool {
+	_, logMsh := lc.ms.requestServInfo()
+	return logMsh == nil
+}
+
+// running returns true if ms is running according to the status command.
+// If the status command is not set, ms running status is unknown.
+func (lc *cmdLifecycle) running() (bool, bool) {
+	if lc.ms.Config.Lifecycle.Status == "" {
+		return false, false
+	}
+
+	_, logMsh := lc.run("status", lc.ms.Config.Lifecycle.Status)
+
+	return logMsh == nil, true
+}
+
+// run executes a lifecycle command with the system shell and returns its output.
+// The name of ms is passed to the command in the MSH_SERVER environment variable.
+func (lc *cmdLifecycle) run(name, command string) (string, *errco.MshLog) {
+	ctx, cancel := context.WithTimeout(context.Background(), lifecycleCommandTimeout)
+	defer cancel()
+
+	// the output is written to a file instead of a pipe:
+	// processes started in background by the command would keep a pipe open (blocking msh)
+	outFile, err := os.CreateTemp("", "msh-lifecycle-*")
+	if err != nil {
+		return "", errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_LIFECYCLE, err.Error())
+	}
+	defer os.Remove(outFile.Name())
+	defer outFile.Close()
+
+	cmd := opsys.ShellCommand(ctx, command)
+	cmd.Env = append(os.Environ(), "MSH_SERVER="+lc.ms.Config.Name)
+	cmd.Stdout, cmd.Stderr = outFile, outFile
+	err = cmd.Run()
+
+	outData, _ := os.ReadFile(outFile.Name())
+	out := strings.TrimSpace(string(outData))
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_4, errco.ERROR_NIL, "lifecycle %s command output: %s", name, out)
+
+	if err != nil {
+		return out, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_LIFECYCLE_COMMAND, "lifecycle %s command failed: %s (%s)", name, err.Error(), out)
+	}
+
+	return out, nil
+}
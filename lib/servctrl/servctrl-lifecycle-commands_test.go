@@ -0,0 +1,158 @@
+package servctrl
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/conn/protocol"
+	"msh/lib/errco"
+)
+
+// fakeStatus answers status pings like an empty minecraft server
+func fakeStatus(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		go func(conn net.Conn) {
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			for i := 0; i < 2; i++ { // handshake + status request
+				if _, logMsh := protocol.ReadPacket(r); logMsh != nil {
+					return
+				}
+			}
+			info := `{"version":{"name":"1.20.1","protocol":763},"players":{"max":20,"online":0},"description":{"text":"test"}}`
+			conn.Write(protocol.NewPacket(protocol.ID_STATUS_RESPONSE, protocol.AppendString(nil, info)).Bytes())
+		}(conn)
+	}
+}
+
+func Test_cmdLifecycle(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("lifecycle commands of the test require sh")
+	}
+
+	// start durations are recorded in the working directory
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(wd)
+
+	running, suspended := filepath.Join(dir, "running"), filepath.Join(dir, "suspended")
+	c := &config.Configuration{}
+	c.Name, c.ServHost = "test-lifecycle", "127.0.0.1"
+	c.Msh.TimeBeforeStoppingEmptyServer = 3600
+	c.Msh.SuspendAllow = true
+	c.Lifecycle.Mode = config.LIFECYCLE_COMMANDS
+	c.Lifecycle.Start = "touch " + running
+	c.Lifecycle.Stop = "rm " + running
+	c.Lifecycle.Status = "test -f " + running
+	c.Lifecycle.Suspend = "echo $MSH_SERVER > " + suspended
+	c.Lifecycle.Resume = "rm " + suspended
+
+	// reserve a port for the fake minecraft server
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.ServPort = l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	// waitStatus waits for ms to reach the status
+	waitStatus := func(ms *Server, status int32) {
+		t.Helper()
+		for maxWait := time.Now().Add(5 * time.Second); ms.Stats.Status.Load() != status; time.Sleep(100 * time.Millisecond) {
+			if time.Now().After(maxWait) {
+				t.Fatalf("status is %s (expected %s)", statusNames[ms.Stats.Status.Load()], statusNames[status])
+			}
+		}
+	}
+
+	ms := NewServer(c)
+
+	// ms not running
+	ms.lc.attach()
+	if ms.Stats.Status.Load() != errco.SERVER_STATUS_OFFLINE || ms.Term.IsActive.Load() {
+		t.Fatalf("ms not running is %s", statusNames[ms.Stats.Status.Load()])
+	}
+
+	// start: ms is online when it answers status pings
+	if logMsh := ms.WarmMS(); logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	if _, err := os.Stat(running); err != nil || ms.Stats.Status.Load() != errco.SERVER_STATUS_STARTING {
+		t.Fatalf("ms not starting after warm (%v)", err)
+	}
+	l, err = net.Listen("tcp", net.JoinHostPort(c.ServHost, strconv.Itoa(c.ServPort)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go fakeStatus(l)
+	waitStatus(ms, errco.SERVER_STATUS_ONLINE)
+
+	// suspend/resume
+	if logMsh := ms.FreezeMS(false); logMsh != nil || !ms.Stats.Suspended.Load() {
+		t.Fatalf("ms not suspended by soft freeze (%v)", logMsh)
+	}
+	if data, err := os.ReadFile(suspended); err != nil || strings.TrimSpace(string(data)) != c.Name {
+		t.Errorf("suspend command not executed with MSH_SERVER (%q, %v)", data, err)
+	}
+	if logMsh := ms.WarmMS(); logMsh != nil || ms.Stats.Suspended.Load() {
+		t.Fatalf("ms not resumed by warm (%v)", logMsh)
+	}
+
+	// stop: ms is offline when it's not running
+	if logMsh := ms.FreezeMS(true); logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	if _, err := os.Stat(running); !os.IsNotExist(err) {
+		t.Errorf("stop command not executed (%v)", err)
+	}
+	waitStatus(ms, errco.SERVER_STATUS_OFFLINE)
+
+	// ms already running when msh starts
+	if err := os.WriteFile(running, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	ms = NewServer(c)
+	ms.lc.attach()
+	if ms.Stats.Status.Load() != errco.SERVER_STATUS_ONLINE || ms.CheckMSWarm() != nil {
+		t.Fatalf("running ms is %s after attach", statusNames[ms.Stats.Status.Load()])
+	}
+	ms.FreezeMS(true)
+	waitStatus(ms, errco.SERVER_STATUS_OFFLINE)
+
+	// running status unknown (no status command): online ms that does not answer status pings
+	// is not offline after a few failed status checks, but only when it's stopped
+	if err := os.WriteFile(running, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cu := *c
+	cu.Lifecycle.Status = ""
+	ms = NewServer(&cu)
+	ms.lc.attach()
+	if ms.Stats.Status.Load() != errco.SERVER_STATUS_ONLINE {
+		t.Fatalf("ms answering status pings is %s after attach", statusNames[ms.Stats.Status.Load()])
+	}
+	l.Close()
+	time.Sleep(lifecycleTick * time.Duration(lifecycleMaxFails+2))
+	if ms.Stats.Status.Load() != errco.SERVER_STATUS_ONLINE {
+		t.Fatalf("ms with unknown running status is %s after %d failed status checks", statusNames[ms.Stats.Status.Load()], lifecycleMaxFails+2)
+	}
+	if logMsh := ms.FreezeMS(true); logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	waitStatus(ms, errco.SERVER_STATUS_OFFLINE)
+}
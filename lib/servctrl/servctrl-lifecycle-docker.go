@@ -0,0 +1,343 @@
+package servctrl
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"msh/lib/errco"
+)
+
+const (
+	dockerAPIVersion     string        = "v1.41"          // docker engine api version (docker 20.10+)
+	dockerRequestTimeout time.Duration = 30 * time.Second // timeout of docker engine api requests (log stream excluded)
+)
+
+// dockerLifecycle manages ms running in a docker container with the docker engine api
+// (the container is started, stopped, paused and unpaused).
+//
+// ms status is parsed from the container logs.
+type dockerLifecycle struct {
+	ms     *Server
+	client *http.Client // http client of the docker engine api unix socket
+}
+
+// dockerContainer is the state of a docker container (subset of docker inspect response)
+type dockerContainer struct {
+	State struct {
+		Running bool `json:"Running"`
+		Paused  bool `json:"Paused"`
+	} `json:"State"`
+	Config struct {
+		Tty bool `json:"Tty"`
+	} `json:"Config"`
+}
+
+// newDockerLifecycle returns the docker lifecycle of ms, connected to the docker engine api unix socket in ms config
+func newDockerLifecycle(ms *Server) *dockerLifecycle {
+	socket := ms.Config.Lifecycle.DockerSocket
+
+	return &dockerLifecycle{
+		ms: ms,
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+func (lc *dockerLifecycle) attach() {
+	container, logMsh := lc.inspect()
+	if logMsh != nil {
+		logMsh.Log(true)
+		return
+	}
+	if !container.State.Running {
+		return
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "minecraft server container is already running (%s)", lc.ms.Config.Name)
+	lc.ms.setStarting()
+
+	switch _, logMsh := lc.ms.requestServInfo(); {
+	case container.State.Paused:
+		// paused ms can't answer status pings
+		lc.ms.setOnline(false)
+		lc.ms.Stats.Suspended.Store(true)
+		if !lc.ms.Config.Msh.SuspendAllow {
+			suspended, logMsh := lc.resume()
+			lc.ms.Stats.Suspended.Store(suspended)
+			if logMsh != nil {
+				logMsh.Log(true)
+			}
+		}
+	case logMsh == nil:
+		lc.ms.setOnline(false)
+	}
+
+	go lc.follow(time.Now())
+}
+
+func (lc *dockerLifecycle) start() *errco.MshLog {
+	if lc.ms.Term.IsActive.Load() {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_IS_WARM, "minecraft server container already running")
+		return nil
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "starting minecraft server container %s (%s)", lc.ms.Config.Lifecycle.Container, lc.ms.Config.Name)
+	since := time.Now()
+	logMsh := lc.do(http.MethodPost, "start", nil, dockerRequestTimeout)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	lc.ms.setStarting()
+	go lc.follow(since)
+
+	return nil
+}
+
+// (the container is killed by docker if ms is not stopped after StopServerAllowKill seconds,
+// if StopServerAllowKill is disabled docker waits for ms to stop without killing it)
+func (lc *dockerLifecycle) stop() *errco.MshLog {
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "stopping minecraft server container %s (%s)", lc.ms.Config.Lifecycle.Container, lc.ms.Config.Name)
+
+	// without t docker kills the container after its stop timeout (10 seconds by default)
+	query, timeout := url.Values{}, time.Duration(0)
+	if lc.ms.Config.Commands.StopServerAllowKill > 0 {
+		query.Set("t", strconv.Itoa(lc.ms.Config.Commands.StopServerAllowKill))
+		timeout = dockerRequestTimeout + time.Duration(lc.ms.Config.Commands.StopServerAllowKill)*time.Second
+	} else {
+		query.Set("t", "-1")
+	}
+
+	lc.ms.setStopping()
+
+	// the stop request returns when the container has stopped
+	// [goroutine]
+	go func() {
+		logMsh := lc.do(http.MethodPost, "stop", query, timeout)
+		if logMsh != nil {
+			logMsh.Log(true)
+		}
+	}()
+
+	return nil
+}
+
+// docker kills the container if ms does not stop within StopServerAllowKill seconds
+func (lc *dockerLifecycle) enforcesStopTimeout() bool {
+	return true
+}
+
+func (lc *dockerLifecycle) kill() *errco.MshLog {
+	return lc.do(http.MethodPost, "kill", nil, dockerRequestTimeout)
+}
+
+// suspend and resume pause/unpause the container only if ms suspension changes
+// (the docker engine refuses to pause a paused container)
+func (lc *dockerLifecycle) suspend() (bool, *errco.MshLog) {
+	if lc.ms.Stats.Suspended.Load() {
+		return true, nil
+	}
+
+	logMsh := lc.do(http.MethodPost, "pause", nil, dockerRequestTimeout)
+	if logMsh != nil {
+		return false, logMsh.AddTrace()
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "EXECUTED CONTAINER PAUSE! (%s)", lc.ms.Config.Name)
+
+	return true, nil
+}
+
+func (lc *dockerLifecycle) resume() (bool, *errco.MshLog) {
+	if !lc.ms.Stats.Suspended.Load() {
+		return false, nil
+	}
+
+	logMsh := lc.do(http.MethodPost, "unpause", nil, dockerRequestTimeout)
+	if logMsh != nil {
+		return true, logMsh.AddTrace()
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "EXECUTED CONTAINER UNPAUSE! (%s)", lc.ms.Config.Name)
+
+	return false, nil
+}
+
+// follow parses the container logs (since the specified time) to track ms status until the container stops
+// [goroutine]
+func (lc *dockerLifecycle) follow(since time.Time) {
+	ms := lc.ms
+
+	// start suspension refresher
+	stopSuspendRefresherC := make(chan bool, 1)
+	go ms.suspendRefresher(stopSuspendRefresherC)
+
+	for {
+		logMsh := lc.readLogs(since)
+		if logMsh != nil {
+			logMsh.Log(true)
+		}
+
+		// the log stream ends when the container stops
+		// (or when the connection to the docker engine is lost: in this case logs are followed again)
+		container, logMsh := lc.inspect()
+		if logMsh == nil && !container.State.Running {
+			break
+		} else if logMsh != nil {
+			logMsh.Log(true)
+		}
+
+		since = time.Now()
+		time.Sleep(lifecycleTick)
+	}
+
+	// stop suspension refresher
+	stopSuspendRefresherC <- true
+
+	ms.setOffline()
+}
+
+// readLogs follows the container log stream since the specified time and parses ms output lines until the stream ends
+func (lc *dockerLifecycle) readLogs(since time.Time) *errco.MshLog {
+	container, logMsh := lc.inspect()
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	query := url.Values{}
+	query.Set("follow", "1")
+	query.Set("stdout", "1")
+	query.Set("stderr", "1")
+	query.Set("since", fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond()))
+	resp, logMsh := lc.request(context.Background(), http.MethodGet, "logs", query)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+	defer resp.Body.Close()
+
+	// without tty stdout and stderr are multiplexed
+	var r io.Reader = resp.Body
+	if !container.Config.Tty {
+		r = &dockerLogReader{r: resp.Body}
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		errco.NewLogln(errco.TYPE_SER, errco.LVL_2, errco.ERROR_NIL, lc.ms.outPrefix()+line)
+
+		lc.ms.parseOutLine(line)
+	}
+
+	return nil
+}
+
+// inspect returns the state of the container
+func (lc *dockerLifecycle) inspect() (*dockerContainer, *errco.MshLog) {
+	ctx, cancel := context.WithTimeout(context.Background(), dockerRequestTimeout)
+	defer cancel()
+
+	resp, logMsh := lc.request(ctx, http.MethodGet, "json", nil)
+	if logMsh != nil {
+		return nil, logMsh.AddTrace()
+	}
+	defer resp.Body.Close()
+
+	container := &dockerContainer{}
+	err := json.NewDecoder(resp.Body).Decode(container)
+	if err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_JSON_UNMARSHAL, err.Error())
+	}
+
+	return container, nil
+}
+
+// do sends a request to the docker engine api for the container (with the specified timeout, 0 for no timeout) and discards the response
+func (lc *dockerLifecycle) do(method, action string, query url.Values, timeout time.Duration) *errco.MshLog {
+	ctx, cancel := context.WithCancel(context.Background())
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	}
+	defer cancel()
+
+	resp, logMsh := lc.request(ctx, method, action, query)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	return nil
+}
+
+// request sends a request to the docker engine api for the container of ms.
+// Error responses are returned as errors (with the message of the docker engine).
+func (lc *dockerLifecycle) request(ctx context.Context, method, action string, query url.Values) (*http.Response, *errco.MshLog) {
+	u := "http://docker/" + dockerAPIVersion + "/containers/" + url.PathEscape(lc.ms.Config.Lifecycle.Container) + "/" + action
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_LIFECYCLE_API, "docker %s request: %s", action, err.Error())
+	}
+
+	resp, err := lc.client.Do(req)
+	if err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_LIFECYCLE_API, "docker %s request: %s", action, err.Error())
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		var rsp struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&rsp)
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_LIFECYCLE_API, "docker %s request: %s (%s)", action, rsp.Message, resp.Status)
+	}
+
+	return resp, nil
+}
+
+// dockerLogReader reads the payload of a multiplexed docker log stream
+// (frames: [stream type, 0, 0, 0, payload size (uint32 big endian)] + payload)
+type dockerLogReader struct {
+	r    io.Reader
+	left uint32 // payload bytes left in the current frame
+}
+
+func (dr *dockerLogReader) Read(p []byte) (int, error) {
+	for dr.left == 0 {
+		header := make([]byte, 8)
+		_, err := io.ReadFull(dr.r, header)
+		if err != nil {
+			return 0, err
+		}
+		dr.left = binary.BigEndian.Uint32(header[4:])
+	}
+
+	if uint32(len(p)) > dr.left {
+		p = p[:dr.left]
+	}
+	n, err := dr.r.Read(p)
+	dr.left -= uint32(n)
+
+	return n, err
+}
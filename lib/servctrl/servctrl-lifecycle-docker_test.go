@@ -0,0 +1,187 @@
+package servctrl
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+)
+
+// fakeDocker serves the docker engine api for the container "mc"
+// (the container logs the lines of a minecraft server start and stop)
+type fakeDocker struct {
+	m       sync.Mutex
+	running bool
+	paused  bool
+	logs    chan string // log stream of the running container (closed when the container stops)
+	stopT   string      // timeout of the last stop request (t query parameter)
+}
+
+func (fd *fakeDocker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fd.m.Lock()
+
+	action := strings.TrimPrefix(r.URL.Path, "/"+dockerAPIVersion+"/containers/mc/")
+	if action == r.URL.Path {
+		fd.m.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"message": "No such container"})
+		return
+	}
+
+	switch {
+	case action == "json" && r.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(map[string]interface{}{"State": map[string]bool{"Running": fd.running, "Paused": fd.paused}, "Config": map[string]bool{"Tty": false}})
+
+	case action == "start" && r.Method == http.MethodPost:
+		fd.start()
+		w.WriteHeader(http.StatusNoContent)
+
+	case action == "stop" && r.Method == http.MethodPost:
+		fd.stopT = r.URL.Query().Get("t")
+		if fd.running {
+			fd.logs <- "[12:00:05] [Server thread/INFO]: Stopping the server"
+			close(fd.logs)
+		}
+		fd.running, fd.paused = false, false
+		w.WriteHeader(http.StatusNoContent)
+
+	case (action == "pause" || action == "unpause") && r.Method == http.MethodPost:
+		if fd.paused == (action == "pause") {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"message": "container is already " + action + "d"})
+			break
+		}
+		fd.paused = action == "pause"
+		w.WriteHeader(http.StatusNoContent)
+
+	case action == "logs" && r.Method == http.MethodGet:
+		logs := fd.logs
+		fd.m.Unlock()
+
+		// stream multiplexed log frames until the container stops
+		w.WriteHeader(http.StatusOK)
+		for line := range logs {
+			frame := append([]byte{1, 0, 0, 0}, binary.BigEndian.AppendUint32(nil, uint32(len(line)+1))...)
+			w.Write(append(append(frame, line...), '\n'))
+			w.(http.Flusher).Flush()
+		}
+		return
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+
+	fd.m.Unlock()
+}
+
+// start starts the container (fd.m must be locked by the caller)
+func (fd *fakeDocker) start() {
+	fd.running, fd.logs = true, make(chan string, 10)
+	fd.logs <- "[12:00:01] [Server thread/INFO]: Preparing spawn area: 50%"
+	fd.logs <- "[12:00:02] [Server thread/INFO]: Done (1.234s)! For help, type \"help\""
+}
+
+func Test_dockerLifecycle(t *testing.T) {
+	// start durations are recorded in the working directory
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(wd)
+
+	l, err := net.Listen("unix", filepath.Join(dir, "docker.sock"))
+	if err != nil {
+		t.Skip("unix sockets not available: ", err)
+	}
+	fd := &fakeDocker{}
+	srv := httptest.NewUnstartedServer(fd)
+	srv.Listener = l
+	srv.Start()
+	defer srv.Close()
+
+	c := &config.Configuration{}
+	c.Name, c.ServHost = "test-docker", "127.0.0.1"
+	c.Msh.TimeBeforeStoppingEmptyServer = 3600
+	c.Msh.SuspendAllow = true
+	c.Lifecycle.Mode = config.LIFECYCLE_DOCKER
+	c.Lifecycle.Container = "mc"
+	c.Lifecycle.DockerSocket = filepath.Join(dir, "docker.sock")
+
+	// waitStatus waits for ms to reach the status
+	waitStatus := func(ms *Server, status int32) {
+		t.Helper()
+		for maxWait := time.Now().Add(5 * time.Second); ms.Stats.Status.Load() != status; time.Sleep(50 * time.Millisecond) {
+			if time.Now().After(maxWait) {
+				t.Fatalf("status is %s (expected %s)", statusNames[ms.Stats.Status.Load()], statusNames[status])
+			}
+		}
+	}
+
+	ms := NewServer(c)
+
+	// container not running
+	ms.lc.attach()
+	if ms.Stats.Status.Load() != errco.SERVER_STATUS_OFFLINE || ms.Term.IsActive.Load() {
+		t.Fatalf("container not running is %s", statusNames[ms.Stats.Status.Load()])
+	}
+
+	// start: ms is online when the container logs "Done"
+	if logMsh := ms.WarmMS(); logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	waitStatus(ms, errco.SERVER_STATUS_ONLINE)
+
+	// suspend/resume: pause/unpause
+	if logMsh := ms.FreezeMS(false); logMsh != nil || !ms.Stats.Suspended.Load() || !fd.paused {
+		t.Fatalf("container not paused by soft freeze (%v)", logMsh)
+	}
+	if logMsh := ms.WarmMS(); logMsh != nil || ms.Stats.Suspended.Load() || fd.paused {
+		t.Fatalf("container not unpaused by warm (%v)", logMsh)
+	}
+
+	// stop: ms is offline when the container stops
+	// (StopServerAllowKill disabled: docker waits for ms to stop without killing it)
+	if logMsh := ms.FreezeMS(true); logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	waitStatus(ms, errco.SERVER_STATUS_OFFLINE)
+	fd.m.Lock()
+	if fd.stopT != "-1" {
+		t.Errorf("container stopped with timeout %q (expected no timeout)", fd.stopT)
+	}
+	fd.m.Unlock()
+
+	// paused container when msh starts
+	fd.m.Lock()
+	fd.start()
+	fd.paused = true
+	fd.m.Unlock()
+	c.Commands.StopServerAllowKill = 60
+	ms = NewServer(c)
+	ms.lc.attach()
+	if ms.Stats.Status.Load() != errco.SERVER_STATUS_ONLINE || !ms.Stats.Suspended.Load() {
+		t.Fatalf("paused container is %s (suspended %t) after attach", statusNames[ms.Stats.Status.Load()], ms.Stats.Suspended.Load())
+	}
+	ms.FreezeMS(true)
+	waitStatus(ms, errco.SERVER_STATUS_OFFLINE)
+	fd.m.Lock()
+	if fd.running || fd.paused || fd.stopT != "60" {
+		t.Errorf("container not stopped with StopServerAllowKill timeout (running %t, paused %t, timeout %q)", fd.running, fd.paused, fd.stopT)
+	}
+	fd.m.Unlock()
+
+	// unknown container
+	c.Lifecycle.Container = "unknown"
+	if logMsh := NewServer(c).WarmMS(); logMsh == nil || logMsh.Cod != errco.ERROR_LIFECYCLE_API {
+		t.Errorf("unknown container warmed (%v)", logMsh)
+	}
+}
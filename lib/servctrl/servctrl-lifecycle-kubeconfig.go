@@ -0,0 +1,342 @@
+package servctrl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// reference:
+// - kubernetes.io/docs/concepts/configuration/organize-cluster-access-kubeconfig
+// - yaml.org/spec/1.2.2 (block collections, flow scalars)
+
+// kubeconfig is a kubeconfig file (subset of the fields used by kubectl)
+type kubeconfig struct {
+	CurrentContext string `json:"current-context"`
+	Contexts       []struct {
+		Name    string `json:"name"`
+		Context struct {
+			Cluster   string `json:"cluster"`
+			User      string `json:"user"`
+			Namespace string `json:"namespace"`
+		} `json:"context"`
+	} `json:"contexts"`
+	Clusters []struct {
+		Name    string `json:"name"`
+		Cluster struct {
+			Server                   string `json:"server"`
+			CertificateAuthority     string `json:"certificate-authority"`
+			CertificateAuthorityData []byte `json:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `json:"insecure-skip-tls-verify"`
+		} `json:"cluster"`
+	} `json:"clusters"`
+	Users []struct {
+		Name string `json:"name"`
+		User struct {
+			Token                 string `json:"token"`
+			TokenFile             string `json:"tokenFile"`
+			ClientCertificate     string `json:"client-certificate"`
+			ClientCertificateData []byte `json:"client-certificate-data"`
+			ClientKey             string `json:"client-key"`
+			ClientKeyData         []byte `json:"client-key-data"`
+		} `json:"user"`
+	} `json:"users"`
+}
+
+// yamlLine is a non empty line of a yaml document
+type yamlLine struct {
+	num    int    // line number
+	indent int    // number of leading spaces
+	text   string // line without indentation
+}
+
+// parseKubeconfig parses a kubeconfig file in json or yaml format.
+//
+// Yaml kubeconfig files are parsed as written by kubectl and cloud providers:
+// block mappings and sequences, plain and quoted scalars, empty flow collections and comments.
+// Anchors, tags, block scalars and multi-document files are not supported.
+func parseKubeconfig(data []byte) (*kubeconfig, error) {
+	kc := &kubeconfig{}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return kc, json.Unmarshal(data, kc)
+	}
+
+	doc, err := yamlDecode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// the yaml document is converted to json to decode it into kubeconfig
+	// (base64 encoded certificates are decoded as []byte)
+	jsonData, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return kc, json.Unmarshal(jsonData, kc)
+}
+
+// yamlDecode decodes a yaml document into maps (map[string]interface{}), slices ([]interface{}), strings, bools and nil
+func yamlDecode(data []byte) (interface{}, error) {
+	lines := []yamlLine{}
+	for i, l := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		text := strings.TrimLeft(l, " ")
+		switch {
+		case strings.TrimSpace(text) == "", strings.HasPrefix(text, "#"):
+			continue
+		case strings.HasPrefix(text, "\t"):
+			return nil, fmt.Errorf("line %d: tabs can't be used for indentation", i+1)
+		case len(lines) == 0 && strings.TrimSpace(text) == "---":
+			continue
+		case strings.HasPrefix(text, "---"), strings.HasPrefix(text, "..."):
+			return nil, fmt.Errorf("line %d: multiple documents are not supported", i+1)
+		}
+		lines = append(lines, yamlLine{num: i + 1, indent: len(l) - len(text), text: strings.TrimRight(text, " ")})
+	}
+
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	doc, next, err := yamlBlock(lines, 0)
+	if err != nil {
+		return nil, err
+	}
+	if next < len(lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", lines[next].num)
+	}
+
+	return doc, nil
+}
+
+// yamlBlock decodes the block collection (or the scalar) that starts at lines[i].
+// Returns the decoded value and the index of the first line after the block.
+func yamlBlock(lines []yamlLine, i int) (interface{}, int, error) {
+	indent := lines[i].indent
+
+	// block sequence
+	if yamlIsItem(lines[i].text) {
+		seq := []interface{}{}
+		for i < len(lines) && lines[i].indent == indent && yamlIsItem(lines[i].text) {
+			rest := strings.TrimLeft(lines[i].text[1:], " ")
+
+			var item interface{}
+			var err error
+			switch {
+			case rest == "":
+				// item value is the nested block
+				item, i, err = yamlNested(lines, i, indent)
+
+			case yamlIsItem(rest) || yamlIsKey(rest):
+				// item value is a collection that starts on the same line of the item indicator:
+				// the rest of the line is parsed as the first line of the collection
+				lines[i] = yamlLine{num: lines[i].num, indent: indent + len(lines[i].text) - len(rest), text: rest}
+				item, i, err = yamlBlock(lines, i)
+
+			default:
+				item, err = yamlScalar(rest)
+				if err != nil {
+					err = fmt.Errorf("line %d: %w", lines[i].num, err)
+				}
+				i++
+			}
+			if err != nil {
+				return nil, i, err
+			}
+			seq = append(seq, item)
+		}
+		return seq, i, nil
+	}
+
+	// scalar document
+	if !yamlIsKey(lines[i].text) {
+		value, err := yamlScalar(lines[i].text)
+		if err != nil {
+			return nil, i, fmt.Errorf("line %d: %w", lines[i].num, err)
+		}
+		return value, i + 1, nil
+	}
+
+	// block mapping
+	mapping := map[string]interface{}{}
+	for i < len(lines) && lines[i].indent == indent {
+		if !yamlIsKey(lines[i].text) {
+			return nil, i, fmt.Errorf("line %d: expected a mapping key", lines[i].num)
+		}
+		key, rest, err := yamlSplitKey(lines[i].text)
+		if err != nil {
+			return nil, i, fmt.Errorf("line %d: %w", lines[i].num, err)
+		}
+
+		var value interface{}
+		if rest == "" {
+			// value is the nested block
+			// (sequences can be nested at the same indentation of the key)
+			if i+1 < len(lines) && lines[i+1].indent == indent && yamlIsItem(lines[i+1].text) {
+				value, i, err = yamlBlock(lines, i+1)
+			} else {
+				value, i, err = yamlNested(lines, i, indent)
+			}
+		} else {
+			value, err = yamlScalar(rest)
+			if err != nil {
+				err = fmt.Errorf("line %d: %w", lines[i].num, err)
+			}
+			i++
+		}
+		if err != nil {
+			return nil, i, err
+		}
+		mapping[key] = value
+	}
+
+	if i < len(lines) && lines[i].indent > indent {
+		return nil, i, fmt.Errorf("line %d: unexpected indentation", lines[i].num)
+	}
+
+	return mapping, i, nil
+}
+
+// yamlNested decodes the block nested in lines[i] (more indented than indent).
+// If there is no nested block, the value is nil.
+func yamlNested(lines []yamlLine, i, indent int) (interface{}, int, error) {
+	if i+1 >= len(lines) || lines[i+1].indent <= indent {
+		return nil, i + 1, nil
+	}
+	return yamlBlock(lines, i+1)
+}
+
+// yamlIsItem returns true if text starts with a block sequence item indicator
+func yamlIsItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// yamlIsKey returns true if text starts with a mapping key
+func yamlIsKey(text string) bool {
+	_, _, err := yamlSplitKey(text)
+	return err == nil
+}
+
+// yamlSplitKey splits a mapping line into its key and the rest of the line (value)
+func yamlSplitKey(text string) (string, string, error) {
+	if strings.HasPrefix(text, "\"") || strings.HasPrefix(text, "'") {
+		key, end, err := yamlQuoted(text)
+		if err != nil {
+			return "", "", err
+		}
+		rest := strings.TrimLeft(text[end:], " ")
+		if !strings.HasPrefix(rest, ":") || (len(rest) > 1 && rest[1] != ' ') {
+			return "", "", fmt.Errorf("expected a mapping key")
+		}
+		return key, strings.TrimSpace(rest[1:]), nil
+	}
+
+	if strings.HasPrefix(text, "{") || strings.HasPrefix(text, "[") {
+		return "", "", fmt.Errorf("expected a mapping key")
+	}
+
+	key, rest, found := strings.Cut(text, ": ")
+	if !found {
+		if !strings.HasSuffix(text, ":") {
+			return "", "", fmt.Errorf("expected a mapping key")
+		}
+		key = strings.TrimSuffix(text, ":")
+	}
+	if strings.Contains(key, " #") {
+		return "", "", fmt.Errorf("expected a mapping key")
+	}
+
+	rest = strings.TrimSpace(rest)
+	if strings.HasPrefix(rest, "#") {
+		rest = ""
+	}
+
+	return strings.TrimSpace(key), rest, nil
+}
+
+// yamlScalar decodes a flow scalar or an empty flow collection (trailing comments are removed)
+func yamlScalar(text string) (interface{}, error) {
+	if strings.HasPrefix(text, "\"") || strings.HasPrefix(text, "'") {
+		value, end, err := yamlQuoted(text)
+		if err != nil {
+			return nil, err
+		}
+		if rest := strings.TrimSpace(text[end:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return nil, fmt.Errorf("unexpected characters after quoted scalar: %s", rest)
+		}
+		return value, nil
+	}
+
+	if i := strings.Index(text, " #"); i >= 0 {
+		text = strings.TrimSpace(text[:i])
+	}
+
+	switch text {
+	case "", "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	case "{}":
+		return map[string]interface{}{}, nil
+	case "[]":
+		return []interface{}{}, nil
+	}
+
+	switch text[0] {
+	case '{', '[':
+		// flow collections are accepted only in json syntax
+		var value interface{}
+		if err := json.Unmarshal([]byte(text), &value); err != nil {
+			return nil, fmt.Errorf("flow collections are supported only in json syntax: %s", text)
+		}
+		return value, nil
+	case '|', '>':
+		return nil, fmt.Errorf("block scalars are not supported")
+	case '&', '*', '!':
+		return nil, fmt.Errorf("anchors, aliases and tags are not supported")
+	}
+
+	return text, nil
+}
+
+// yamlQuoted decodes the quoted scalar at the start of text.
+// Returns the scalar and the index of text after the closing quote.
+func yamlQuoted(text string) (string, int, error) {
+	if text[0] == '\'' {
+		// single quoted: '' is an escaped quote
+		value := strings.Builder{}
+		for i := 1; i < len(text); i++ {
+			if text[i] != '\'' {
+				value.WriteByte(text[i])
+				continue
+			}
+			if i+1 < len(text) && text[i+1] == '\'' {
+				value.WriteByte('\'')
+				i++
+				continue
+			}
+			return value.String(), i + 1, nil
+		}
+		return "", 0, fmt.Errorf("unterminated quoted scalar")
+	}
+
+	// double quoted: escape sequences are the same of go strings
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '"':
+			value, err := strconv.Unquote(text[:i+1])
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid quoted scalar %s", text[:i+1])
+			}
+			return value, i + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated quoted scalar")
+}
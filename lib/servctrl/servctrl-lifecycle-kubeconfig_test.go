@@ -0,0 +1,85 @@
+package servctrl
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func Test_parseKubeconfig(t *testing.T) {
+	// kubeconfig as written by kubectl and cloud providers (quoted scalars, comments, sequences nested at the key indentation)
+	yamlKubeconfig := `---
+# cluster access
+apiVersion: v1
+clusters:
+  - cluster:
+      certificate-authority-data: bXNo
+      insecure-skip-tls-verify: true
+      server: "https://10.0.0.1:6443"   # api server
+    name: 'prod ''eu'''
+contexts:
+- context:
+    cluster: prod 'eu'
+    namespace: minecraft
+    user: admin
+  name: admin@prod
+current-context: "admin@prod"
+kind: Config
+preferences: {}
+users:
+- name: admin
+  user:
+    exec:
+      apiVersion: client.authentication.k8s.io/v1beta1
+      args:
+      - eks
+      - get-token
+      command: aws
+      env: null
+    token: "t\u00f6ken"
+`
+	kc, err := parseKubeconfig([]byte(yamlKubeconfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kc.CurrentContext != "admin@prod" || len(kc.Contexts) != 1 || kc.Contexts[0].Context.Cluster != "prod 'eu'" || kc.Contexts[0].Context.Namespace != "minecraft" {
+		t.Errorf("unexpected contexts: %+v", kc)
+	}
+	if len(kc.Clusters) != 1 || kc.Clusters[0].Name != "prod 'eu'" || kc.Clusters[0].Cluster.Server != "https://10.0.0.1:6443" ||
+		!kc.Clusters[0].Cluster.InsecureSkipTLSVerify || !bytes.Equal(kc.Clusters[0].Cluster.CertificateAuthorityData, []byte("msh")) {
+		t.Errorf("unexpected clusters: %+v", kc.Clusters)
+	}
+	if len(kc.Users) != 1 || kc.Users[0].Name != "admin" || kc.Users[0].User.Token != "töken" {
+		t.Errorf("unexpected users: %+v", kc.Users)
+	}
+
+	// json kubeconfig
+	kc, err = parseKubeconfig([]byte(`{"current-context": "test", "users": [{"name": "msh", "user": {"token": "abc"}}]}`))
+	if err != nil || kc.CurrentContext != "test" || len(kc.Users) != 1 || kc.Users[0].User.Token != "abc" {
+		t.Errorf("unexpected json kubeconfig: %+v (%v)", kc, err)
+	}
+
+	// nested sequences and empty values
+	doc, err := yamlDecode([]byte("a:\n- - 1\n  - 2\n- b: \"x\"\n  c:\nd: []\n"))
+	expected := map[string]interface{}{
+		"a": []interface{}{[]interface{}{"1", "2"}, map[string]interface{}{"b": "x", "c": nil}},
+		"d": []interface{}{},
+	}
+	if err != nil || !reflect.DeepEqual(doc, expected) {
+		t.Errorf("unexpected document: %#v (%v)", doc, err)
+	}
+
+	// unsupported yaml
+	for _, data := range []string{
+		"users:\n\t- name: msh\n",
+		"token: |\n  abc\n",
+		"base: &base\n  server: x\n",
+		"a: 1\n---\nb: 2\n",
+		"a:\n    b: 1\n  c: 2\n",
+		"a: \"unterminated\n",
+	} {
+		if _, err := parseKubeconfig([]byte(data)); err == nil {
+			t.Errorf("unsupported yaml parsed: %q", data)
+		}
+	}
+}
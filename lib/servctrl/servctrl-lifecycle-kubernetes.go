@@ -0,0 +1,522 @@
+package servctrl
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"msh/lib/errco"
+)
+
+const (
+	kubeServiceAccountDir string        = "/var/run/secrets/kubernetes.io/serviceaccount" // service account credentials mounted in kubernetes pods
+	kubeRequestTimeout    time.Duration = 30 * time.Second                                // timeout of kubernetes api requests
+
+	kubeCoreAPI string = "/api/v1"       // kubernetes core api (pods)
+	kubeAppsAPI string = "/apis/apps/v1" // kubernetes apps api (statefulsets, deployments)
+)
+
+// kubeLifecycle manages ms running in a kubernetes workload (statefulset or deployment) with the kubernetes api
+// (the workload is scaled to 1 replica to start ms and to 0 replicas to stop it).
+//
+// ms is online when a pod of the workload is ready and ms answers status pings.
+type kubeLifecycle struct {
+	ms *Server
+
+	m        sync.Mutex // protects api and selector (loaded on first use by the monitor and by msh requests)
+	api      *kubeAPI   // kubernetes api client (nil if the api config could not be loaded)
+	selector string     // label selector of the workload pods (read from the workload scale subresource)
+}
+
+// kubeAPI is a client of the kubernetes api server
+type kubeAPI struct {
+	server    string // url of the api server
+	namespace string // namespace of the workload
+	token     string // bearer token
+	tokenFile string // file containing the bearer token (read at every request: service account tokens are rotated)
+	client    *http.Client
+}
+
+// kubeScale is the scale subresource of a kubernetes workload
+type kubeScale struct {
+	Spec struct {
+		Replicas int `json:"replicas"`
+	} `json:"spec"`
+	Status struct {
+		Replicas int    `json:"replicas"`
+		Selector string `json:"selector"`
+	} `json:"status"`
+}
+
+// kubePod is a kubernetes pod (subset of the kubernetes api response)
+type kubePod struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Status struct {
+		Phase      string `json:"phase"`
+		Conditions []struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+// newKubeLifecycle returns the kubernetes lifecycle of ms, authenticated with the kubeconfig in ms config
+// (or with msh service account if the kubeconfig is not set)
+func newKubeLifecycle(ms *Server) *kubeLifecycle {
+	api, logMsh := newKubeAPI(ms.Config.Lifecycle.Kubeconfig, ms.Config.Lifecycle.Namespace)
+	if logMsh != nil {
+		// the api config is loaded again at the next request
+		logMsh.Log(true)
+	}
+
+	return &kubeLifecycle{ms: ms, api: api}
+}
+
+func (lc *kubeLifecycle) attach() {
+	scale, logMsh := lc.getScale()
+	if logMsh != nil {
+		logMsh.Log(true)
+		return
+	}
+	if running, ok := lc.running(); scale.Spec.Replicas == 0 && (!ok || !running) {
+		return
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "minecraft server workload is already running (%s)", lc.ms.Config.Name)
+	lc.ms.setStarting()
+
+	switch {
+	case scale.Spec.Replicas == 0:
+		// workload scaled to 0 replicas while its pod is still terminating
+		lc.ms.setStopping()
+	case lc.online():
+		lc.ms.setOnline(false)
+	}
+
+	go lc.ms.monitor(lc)
+}
+
+func (lc *kubeLifecycle) start() *errco.MshLog {
+	if lc.ms.Term.IsActive.Load() {
+		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_IS_WARM, "minecraft server workload already running")
+		return nil
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "scaling minecraft server workload %s to 1 replica (%s)", lc.ms.Config.Lifecycle.Workload, lc.ms.Config.Name)
+	logMsh := lc.scale(1)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	lc.ms.setStarting()
+	go lc.ms.monitor(lc)
+
+	return nil
+}
+
+// (the pod is stopped by kubernetes: ms receives SIGTERM and it's killed after the pod termination grace period)
+func (lc *kubeLifecycle) stop() *errco.MshLog {
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "scaling minecraft server workload %s to 0 replicas (%s)", lc.ms.Config.Lifecycle.Workload, lc.ms.Config.Name)
+	logMsh := lc.scale(0)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	lc.ms.setStopping()
+
+	return nil
+}
+
+// kill deletes the pods of the workload without grace period
+func (lc *kubeLifecycle) kill() *errco.MshLog {
+	pods, logMsh := lc.pods()
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	query := url.Values{}
+	query.Set("gracePeriodSeconds", "0")
+	for _, pod := range pods {
+		logMsh := lc.request(http.MethodDelete, kubeCoreAPI, "pods/"+url.PathEscape(pod.Metadata.Name), query, nil, nil)
+		if logMsh != nil {
+			return logMsh.AddTrace()
+		}
+	}
+
+	return nil
+}
+
+// kubernetes can't suspend pods (SuspendAllow is disabled by config check)
+func (lc *kubeLifecycle) suspend() (bool, *errco.MshLog) {
+	return false, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_LIFECYCLE, "minecraft server can't be suspended with lifecycle mode %s", lc.ms.Config.Lifecycle.Mode)
+}
+
+func (lc *kubeLifecycle) resume() (bool, *errco.MshLog) {
+	return false, nil
+}
+
+// online returns true if ms answers status pings and, while ms is starting, a pod of the workload is ready.
+// The pods are not listed while ms is online: the workload is checked only after failed status pings (see running).
+func (lc *kubeLifecycle) online() bool {
+	if _, logMsh := lc.ms.requestServInfo(); logMsh != nil {
+		return false
+	}
+	if lc.ms.Stats.Status.Load() != errco.SERVER_STATUS_STARTING {
+		return true
+	}
+
+	pods, logMsh := lc.pods()
+	if logMsh != nil {
+		logMsh.Log(true)
+		return false
+	}
+
+	for _, pod := range pods {
+		if pod.ready() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// running returns true if the workload has pods that have not terminated
+// (ms running status is unknown if the pods can't be listed)
+func (lc *kubeLifecycle) running() (bool, bool) {
+	pods, logMsh := lc.pods()
+	if logMsh != nil {
+		logMsh.Log(true)
+		return false, false
+	}
+
+	for _, pod := range pods {
+		if pod.Status.Phase != "Succeeded" && pod.Status.Phase != "Failed" {
+			return true, true
+		}
+	}
+
+	return false, true
+}
+
+// ready returns true if the pod is ready to serve requests
+func (pod *kubePod) ready() bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == "Ready" {
+			return cond.Status == "True"
+		}
+	}
+
+	return false
+}
+
+// getScale returns the scale subresource of the workload
+func (lc *kubeLifecycle) getScale() (*kubeScale, *errco.MshLog) {
+	scale := &kubeScale{}
+	logMsh := lc.request(http.MethodGet, kubeAppsAPI, lc.workloadPath()+"/scale", nil, nil, scale)
+	if logMsh != nil {
+		return nil, logMsh.AddTrace()
+	}
+
+	return scale, nil
+}
+
+// scale sets the replicas of the workload
+func (lc *kubeLifecycle) scale(replicas int) *errco.MshLog {
+	patch := map[string]interface{}{"spec": map[string]int{"replicas": replicas}}
+	logMsh := lc.request(http.MethodPatch, kubeAppsAPI, lc.workloadPath()+"/scale", nil, patch, nil)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	return nil
+}
+
+// pods returns the pods of the workload
+func (lc *kubeLifecycle) pods() ([]kubePod, *errco.MshLog) {
+	lc.m.Lock()
+	selector := lc.selector
+	lc.m.Unlock()
+
+	if selector == "" {
+		scale, logMsh := lc.getScale()
+		if logMsh != nil {
+			return nil, logMsh.AddTrace()
+		}
+		if scale.Status.Selector == "" {
+			// an empty selector would list all the pods of the namespace
+			return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_LIFECYCLE, "workload %s has no pod selector", lc.ms.Config.Lifecycle.Workload)
+		}
+		selector = scale.Status.Selector
+
+		lc.m.Lock()
+		lc.selector = selector
+		lc.m.Unlock()
+	}
+
+	var podList struct {
+		Items []kubePod `json:"items"`
+	}
+	query := url.Values{}
+	query.Set("labelSelector", selector)
+	logMsh := lc.request(http.MethodGet, kubeCoreAPI, "pods", query, nil, &podList)
+	if logMsh != nil {
+		return nil, logMsh.AddTrace()
+	}
+
+	return podList.Items, nil
+}
+
+// workloadPath returns the path of the workload in the namespace
+// (the workload is "<api resource>/<name>", normalized by config check)
+func (lc *kubeLifecycle) workloadPath() string {
+	resource, name, _ := strings.Cut(lc.ms.Config.Lifecycle.Workload, "/")
+	return url.PathEscape(resource) + "/" + url.PathEscape(name)
+}
+
+// request sends a request for a resource of the workload namespace to the kubernetes api: body is sent as json merge patch (PATCH) or json,
+// the json response is decoded into out (if not nil).
+// Error responses are returned as errors (with the message of the kubernetes api).
+func (lc *kubeLifecycle) request(method, apiPath, resource string, query url.Values, body, out interface{}) *errco.MshLog {
+	api, logMsh := lc.client()
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kubeRequestTimeout)
+	defer cancel()
+
+	path := apiPath + "/namespaces/" + url.PathEscape(api.namespace) + "/" + resource
+	u := api.server + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_JSON_MARSHAL, err.Error())
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, reqBody)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_LIFECYCLE_API, "kubernetes %s %s request: %s", method, path, err.Error())
+	}
+	req.Header.Set("Accept", "application/json")
+	if method == http.MethodPatch {
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+	} else if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	token := api.token
+	if api.tokenFile != "" {
+		data, err := os.ReadFile(api.tokenFile)
+		if err != nil {
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_LIFECYCLE, "kubernetes token: %s", err.Error())
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_LIFECYCLE_API, "kubernetes %s %s request: %s", method, path, err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var status struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&status)
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_LIFECYCLE_API, "kubernetes %s %s request: %s (%s)", method, path, status.Message, resp.Status)
+	}
+
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(out)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_JSON_UNMARSHAL, err.Error())
+	}
+
+	return nil
+}
+
+// client returns the kubernetes api client
+// (the api config is loaded again if it could not be loaded before)
+func (lc *kubeLifecycle) client() (*kubeAPI, *errco.MshLog) {
+	lc.m.Lock()
+	defer lc.m.Unlock()
+
+	if lc.api == nil {
+		api, logMsh := newKubeAPI(lc.ms.Config.Lifecycle.Kubeconfig, lc.ms.Config.Lifecycle.Namespace)
+		if logMsh != nil {
+			return nil, logMsh.AddTrace()
+		}
+		lc.api = api
+	}
+
+	return lc.api, nil
+}
+
+// newKubeAPI returns a kubernetes api client configured with the kubeconfig file (yaml or json format)
+// or, if the kubeconfig file is not specified, with the service account of the pod running msh.
+// If namespace is empty the namespace of the kubeconfig context / service account is used.
+func newKubeAPI(kubeconfigPath, namespace string) (*kubeAPI, *errco.MshLog) {
+	if kubeconfigPath == "" {
+		return newKubeAPIInCluster(namespace)
+	}
+
+	data, err := os.ReadFile(kubeconfigPath)
+	if err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_LIFECYCLE, "kubeconfig: %s", err.Error())
+	}
+	kc, err := parseKubeconfig(data)
+	if err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_LIFECYCLE, "kubeconfig %s could not be parsed: %s (export it as json with: kubectl config view --minify --flatten -o json)", kubeconfigPath, err.Error())
+	}
+
+	// relative paths in kubeconfig are relative to the kubeconfig file
+	readFile := func(name string) ([]byte, error) {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(filepath.Dir(kubeconfigPath), name)
+		}
+		return os.ReadFile(name)
+	}
+
+	api := &kubeAPI{namespace: namespace}
+	tlsConfig := &tls.Config{}
+
+	ctxFound := false
+	for _, kctx := range kc.Contexts {
+		if kctx.Name != kc.CurrentContext {
+			continue
+		}
+		ctxFound = true
+
+		if api.namespace == "" {
+			api.namespace = kctx.Context.Namespace
+		}
+
+		for _, cluster := range kc.Clusters {
+			if cluster.Name != kctx.Context.Cluster {
+				continue
+			}
+			api.server = strings.TrimSuffix(cluster.Cluster.Server, "/")
+			tlsConfig.InsecureSkipVerify = cluster.Cluster.InsecureSkipTLSVerify
+
+			ca := cluster.Cluster.CertificateAuthorityData
+			if cluster.Cluster.CertificateAuthority != "" {
+				ca, err = readFile(cluster.Cluster.CertificateAuthority)
+				if err != nil {
+					return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_LIFECYCLE, "kubeconfig certificate authority: %s", err.Error())
+				}
+			}
+			if len(ca) > 0 {
+				tlsConfig.RootCAs = x509.NewCertPool()
+				if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+					return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_LIFECYCLE, "kubeconfig certificate authority of cluster %s is not valid", cluster.Name)
+				}
+			}
+		}
+
+		for _, user := range kc.Users {
+			if user.Name != kctx.Context.User {
+				continue
+			}
+			api.token = user.User.Token
+			if user.User.TokenFile != "" {
+				api.tokenFile = user.User.TokenFile
+				if !filepath.IsAbs(api.tokenFile) {
+					api.tokenFile = filepath.Join(filepath.Dir(kubeconfigPath), api.tokenFile)
+				}
+			}
+
+			cert, key := user.User.ClientCertificateData, user.User.ClientKeyData
+			if user.User.ClientCertificate != "" {
+				cert, err = readFile(user.User.ClientCertificate)
+				if err != nil {
+					return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_LIFECYCLE, "kubeconfig client certificate: %s", err.Error())
+				}
+			}
+			if user.User.ClientKey != "" {
+				key, err = readFile(user.User.ClientKey)
+				if err != nil {
+					return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_LIFECYCLE, "kubeconfig client key: %s", err.Error())
+				}
+			}
+			if len(cert) > 0 {
+				clientCert, err := tls.X509KeyPair(cert, key)
+				if err != nil {
+					return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_LIFECYCLE, "kubeconfig client certificate of user %s: %s", user.Name, err.Error())
+				}
+				tlsConfig.Certificates = []tls.Certificate{clientCert}
+			}
+		}
+	}
+
+	if !ctxFound {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_LIFECYCLE, "kubeconfig current context %q not found", kc.CurrentContext)
+	}
+	if api.server == "" {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_LIFECYCLE, "kubeconfig cluster of context %q not found", kc.CurrentContext)
+	}
+	if api.namespace == "" {
+		api.namespace = "default"
+	}
+
+	api.client = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+
+	return api, nil
+}
+
+// newKubeAPIInCluster returns a kubernetes api client authenticated with the service account of the pod running msh
+func newKubeAPIInCluster(namespace string) (*kubeAPI, *errco.MshLog) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_LIFECYCLE, "msh is not running in a kubernetes pod (kubeconfig must be specified)")
+	}
+
+	ca, err := os.ReadFile(filepath.Join(kubeServiceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_LIFECYCLE, "service account certificate authority: %s", err.Error())
+	}
+	rootCAs := x509.NewCertPool()
+	rootCAs.AppendCertsFromPEM(ca)
+
+	if namespace == "" {
+		data, err := os.ReadFile(filepath.Join(kubeServiceAccountDir, "namespace"))
+		if err != nil {
+			return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_LIFECYCLE, "service account namespace: %s", err.Error())
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+
+	return &kubeAPI{
+		server:    "https://" + net.JoinHostPort(host, port),
+		namespace: namespace,
+		tokenFile: filepath.Join(kubeServiceAccountDir, "token"),
+		client:    &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: rootCAs}}},
+	}, nil
+}
@@ -0,0 +1,235 @@
+package servctrl
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+)
+
+// fakeKube serves the kubernetes api for the statefulset "minecraft" in the namespace "mc"
+// (the pod of the statefulset is ready as soon as the statefulset is scaled to 1 replica)
+type fakeKube struct {
+	m        sync.Mutex
+	replicas int
+	pod      bool // the pod of the statefulset exists
+	killed   bool // the pod was deleted without grace period
+	podLists int  // number of pod list requests
+}
+
+func (fk *fakeKube) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fk.m.Lock()
+	defer fk.m.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer test-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"kind": "Status", "message": "Unauthorized"})
+		return
+	}
+
+	switch path := r.URL.Path; {
+	case path == "/apis/apps/v1/namespaces/mc/statefulsets/minecraft/scale" && r.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(fk.scale())
+
+	case path == "/apis/apps/v1/namespaces/mc/statefulsets/minecraft/scale" && r.Method == http.MethodPatch:
+		var patch kubeScale
+		if r.Header.Get("Content-Type") != "application/merge-patch+json" || json.NewDecoder(r.Body).Decode(&patch) != nil {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		fk.replicas, fk.pod = patch.Spec.Replicas, patch.Spec.Replicas > 0
+		json.NewEncoder(w).Encode(fk.scale())
+
+	case path == "/api/v1/namespaces/mc/pods" && r.Method == http.MethodGet && r.URL.Query().Get("labelSelector") == "app=minecraft":
+		fk.podLists++
+		pods := []interface{}{}
+		if fk.pod {
+			pods = append(pods, map[string]interface{}{
+				"metadata": map[string]string{"name": "minecraft-0"},
+				"status":   map[string]interface{}{"phase": "Running", "conditions": []map[string]string{{"type": "Ready", "status": "True"}}},
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"kind": "PodList", "items": pods})
+
+	case path == "/api/v1/namespaces/mc/pods/minecraft-0" && r.Method == http.MethodDelete && fk.pod:
+		fk.pod, fk.killed = false, r.URL.Query().Get("gracePeriodSeconds") == "0"
+		json.NewEncoder(w).Encode(map[string]string{"kind": "Pod"})
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"kind": "Status", "message": "not found"})
+	}
+}
+
+// podListener is a listener of the fake minecraft server that accepts connections only while the pod of the statefulset exists
+type podListener struct {
+	net.Listener
+	fk *fakeKube
+}
+
+func (pl podListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := pl.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		pl.fk.m.Lock()
+		pod := pl.fk.pod
+		pl.fk.m.Unlock()
+		if pod {
+			return conn, nil
+		}
+		conn.Close()
+	}
+}
+
+// scale returns the scale subresource of the statefulset (fk.m must be locked by the caller)
+func (fk *fakeKube) scale() *kubeScale {
+	scale := &kubeScale{}
+	scale.Spec.Replicas, scale.Status.Replicas, scale.Status.Selector = fk.replicas, fk.replicas, "app=minecraft"
+	return scale
+}
+
+func Test_kubeLifecycle(t *testing.T) {
+	// start durations are recorded in the working directory
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(wd)
+
+	fk := &fakeKube{}
+	srv := httptest.NewServer(fk)
+	defer srv.Close()
+
+	// kubeconfig of the fake api server (namespace from context, yaml format as written by kubectl)
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	writeKubeconfig := func(token string) {
+		t.Helper()
+		data := "apiVersion: v1\n" +
+			"clusters:\n" +
+			"- cluster:\n" +
+			"    server: " + srv.URL + "\n" +
+			"  name: fake\n" +
+			"contexts:\n" +
+			"- context:\n" +
+			"    cluster: fake\n" +
+			"    namespace: mc\n" +
+			"    user: msh\n" +
+			"  name: test\n" +
+			"current-context: test\n" +
+			"kind: Config\n" +
+			"preferences: {}\n" +
+			"users:\n" +
+			"- name: msh\n" +
+			"  user:\n" +
+			"    token: " + token + "\n"
+		if err := os.WriteFile(kubeconfig, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeKubeconfig("test-token")
+
+	// fake minecraft server (answers status pings while the pod exists)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go fakeStatus(podListener{l, fk})
+
+	c := &config.Configuration{}
+	c.Name, c.ServHost, c.ServPort = "test-kubernetes", "127.0.0.1", l.Addr().(*net.TCPAddr).Port
+	c.Msh.TimeBeforeStoppingEmptyServer = 3600
+	c.Lifecycle.Mode = config.LIFECYCLE_KUBE
+	c.Lifecycle.Workload = "statefulsets/minecraft"
+	c.Lifecycle.Kubeconfig = kubeconfig
+
+	// waitStatus waits for ms to reach the status
+	// (online ms is offline after lifecycleMaxFails failed status checks)
+	waitStatus := func(ms *Server, status int32) {
+		t.Helper()
+		for maxWait := time.Now().Add(lifecycleTick * time.Duration(2*lifecycleMaxFails)); ms.Stats.Status.Load() != status; time.Sleep(50 * time.Millisecond) {
+			if time.Now().After(maxWait) {
+				t.Fatalf("status is %s (expected %s)", statusNames[ms.Stats.Status.Load()], statusNames[status])
+			}
+		}
+	}
+
+	ms := NewServer(c)
+
+	// workload scaled to 0 replicas
+	ms.lc.attach()
+	if ms.Stats.Status.Load() != errco.SERVER_STATUS_OFFLINE || ms.Term.IsActive.Load() {
+		t.Fatalf("workload with 0 replicas is %s", statusNames[ms.Stats.Status.Load()])
+	}
+
+	// start: workload is scaled to 1 replica, ms is online when its pod is ready and it answers status pings
+	if logMsh := ms.WarmMS(); logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	if fk.replicas != 1 {
+		t.Fatalf("workload not scaled to 1 replica by warm (%d replicas)", fk.replicas)
+	}
+	waitStatus(ms, errco.SERVER_STATUS_ONLINE)
+
+	// pods are not listed while ms is online and answers status pings
+	fk.m.Lock()
+	podLists := fk.podLists
+	fk.m.Unlock()
+	time.Sleep(3 * lifecycleTick)
+	fk.m.Lock()
+	if fk.podLists != podLists {
+		t.Errorf("pods listed %d times while ms is online", fk.podLists-podLists)
+	}
+	fk.m.Unlock()
+
+	// stop: workload is scaled to 0 replicas, ms is offline when its pod is deleted
+	if logMsh := ms.FreezeMS(true); logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	if fk.replicas != 0 {
+		t.Fatalf("workload not scaled to 0 replicas by freeze (%d replicas)", fk.replicas)
+	}
+	waitStatus(ms, errco.SERVER_STATUS_OFFLINE)
+
+	// workload running when msh starts
+	fk.m.Lock()
+	fk.replicas, fk.pod = 1, true
+	fk.m.Unlock()
+	ms = NewServer(c)
+	ms.lc.attach()
+	if ms.Stats.Status.Load() != errco.SERVER_STATUS_ONLINE || ms.CheckMSWarm() != nil {
+		t.Fatalf("running workload is %s after attach", statusNames[ms.Stats.Status.Load()])
+	}
+
+	// kill: the pod is deleted without grace period
+	if logMsh := ms.lc.kill(); logMsh != nil || !fk.killed {
+		t.Fatalf("pod not killed (%v)", logMsh)
+	}
+	fk.m.Lock()
+	fk.replicas = 0
+	fk.m.Unlock()
+	waitStatus(ms, errco.SERVER_STATUS_OFFLINE)
+
+	// unknown workload
+	c.Lifecycle.Workload = "statefulsets/unknown"
+	if logMsh := NewServer(c).WarmMS(); logMsh == nil || logMsh.Cod != errco.ERROR_LIFECYCLE_API {
+		t.Errorf("unknown workload warmed (%v)", logMsh)
+	}
+
+	// unauthorized token
+	c.Lifecycle.Workload = "statefulsets/minecraft"
+	writeKubeconfig("wrong-token")
+	if logMsh := NewServer(c).WarmMS(); logMsh == nil || logMsh.Cod != errco.ERROR_LIFECYCLE_API {
+		t.Errorf("workload warmed with unauthorized token (%v)", logMsh)
+	}
+}
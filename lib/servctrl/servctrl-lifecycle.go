@@ -0,0 +1,229 @@
+package servctrl
+
+import (
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/opsys"
+	"msh/lib/servstats"
+)
+
+const (
+	lifecycleStartTimeout time.Duration = 10 * time.Minute // max time for ms to be online after start (if ms running status is unknown)
+	lifecycleMaxOutage    time.Duration = 10 * time.Minute // max time online ms does not answer status checks before it's offline (if ms running status is unknown)
+	lifecycleTick         time.Duration = 1 * time.Second  // interval between ms status checks
+	lifecycleMaxFails     int           = 5                // consecutive failed status checks after which online ms is checked to be running
+)
+
+// lifecycle manages the start, stop and suspension of a minecraft server.
+//
+// The lifecycle keeps ms status updated from the start until ms is offline.
+type lifecycle interface {
+	// attach tracks ms status if it's already running when msh starts
+	attach()
+	// start starts ms [non-blocking]
+	start() *errco.MshLog
+	// stop makes ms stop (ms is online)
+	stop() *errco.MshLog
+	// kill forcefully terminates ms
+	kill() *errco.MshLog
+	// suspend suspends ms, returns ms suspension status
+	suspend() (bool, *errco.MshLog)
+	// resume resumes ms, returns ms suspension status
+	resume() (bool, *errco.MshLog)
+}
+
+// statusProbe checks the status of ms for the lifecycles that can't parse ms output
+type statusProbe interface {
+	// online returns true if ms is ready to accept players
+	online() bool
+	// running returns true if ms is running (ok is false if ms running status is unknown)
+	running() (running bool, ok bool)
+}
+
+// stopEnforcer is implemented by the lifecycles that kill ms themselves if it does not stop in time
+// (msh does not kill ms after StopServerAllowKill seconds)
+type stopEnforcer interface {
+	// enforcesStopTimeout returns true if ms is killed by the lifecycle when it does not stop within StopServerAllowKill seconds
+	enforcesStopTimeout() bool
+}
+
+// newLifecycle returns the lifecycle of ms specified by ms config
+func newLifecycle(ms *Server) lifecycle {
+	switch ms.Config.Lifecycle.Mode {
+	case config.LIFECYCLE_COMMANDS:
+		return &cmdLifecycle{ms: ms}
+	case config.LIFECYCLE_DOCKER:
+		return newDockerLifecycle(ms)
+	case config.LIFECYCLE_KUBE:
+		return newKubeLifecycle(ms)
+	default:
+		return &procLifecycle{ms: ms}
+	}
+}
+
+// procLifecycle manages ms as a child process of msh (started with Commands.StartServer).
+// ms status is parsed from ms terminal output.
+type procLifecycle struct {
+	ms *Server
+}
+
+func (lc *procLifecycle) attach() {}
+
+func (lc *procLifecycle) start() *errco.MshLog {
+	return lc.ms.termStart()
+}
+
+func (lc *procLifecycle) stop() *errco.MshLog {
+	_, logMsh := lc.ms.Execute(lc.ms.Config.Commands.StopServer)
+	if logMsh != nil {
+		return logMsh.AddTrace()
+	}
+
+	return nil
+}
+
+func (lc *procLifecycle) kill() *errco.MshLog {
+	return opsys.ProcTreeKill(uint32(lc.ms.Term.cmd.Process.Pid))
+}
+
+func (lc *procLifecycle) suspend() (bool, *errco.MshLog) {
+	return opsys.ProcTreeSuspend(uint32(lc.ms.Term.cmd.Process.Pid))
+}
+
+func (lc *procLifecycle) resume() (bool, *errco.MshLog) {
+	return opsys.ProcTreeResume(uint32(lc.ms.Term.cmd.Process.Pid))
+}
+
+// monitor tracks ms status with the status probe until ms is offline:
+//
+// - starting: ms is online when the probe reports it online.
+//
+// - online: ms is offline when it's not online for a while and it's not running.
+//
+// - stopping: ms is offline when it's not running.
+//
+// If ms running status is unknown, stopping ms is considered running while it's online
+// and online ms is offline only after it has not been online for lifecycleMaxOutage
+// (unreachable ms might still be running).
+//
+// [goroutine]
+func (ms *Server) monitor(p statusProbe) {
+	// start suspension refresher
+	stopSuspendRefresherC := make(chan bool, 1)
+	go ms.suspendRefresher(stopSuspendRefresherC)
+
+	fails, lastOnline := 0, time.Now()
+	for ms.Stats.Status.Load() != errco.SERVER_STATUS_OFFLINE {
+		time.Sleep(lifecycleTick)
+
+		// suspended ms does not answer status pings
+		if ms.Stats.Suspended.Load() {
+			fails, lastOnline = 0, time.Now()
+			continue
+		}
+
+		online := p.online()
+		if online {
+			fails, lastOnline = 0, time.Now()
+		} else {
+			fails++
+		}
+
+		switch ms.Stats.Status.Load() {
+		case errco.SERVER_STATUS_STARTING:
+			if online {
+				ms.setOnline(true)
+				break
+			}
+			if fails < lifecycleMaxFails {
+				break
+			}
+			switch running, ok := p.running(); {
+			case ok && !running:
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_SERVER_OFFLINE, "minecraft server stopped while starting (%s)", ms.Config.Name)
+				ms.setOffline()
+			case !ok && time.Since(ms.Term.startTime) > lifecycleStartTimeout:
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_SERVER_OFFLINE, "minecraft server not online %s after start (%s)", lifecycleStartTimeout, ms.Config.Name)
+				ms.setOffline()
+			}
+
+		case errco.SERVER_STATUS_ONLINE:
+			if fails < lifecycleMaxFails {
+				break
+			}
+			switch running, ok := p.running(); {
+			case ok && !running:
+				ms.setOffline()
+			case !ok && time.Since(lastOnline) > lifecycleMaxOutage:
+				errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_SERVER_OFFLINE, "minecraft server not online for %s (%s)", lifecycleMaxOutage, ms.Config.Name)
+				ms.setOffline()
+			}
+
+		case errco.SERVER_STATUS_STOPPING:
+			running, ok := p.running()
+			if !ok {
+				running = online
+			}
+			if !running {
+				ms.setOffline()
+			}
+		}
+	}
+
+	// stop suspension refresher
+	stopSuspendRefresherC <- true
+}
+
+// setStarting sets ms status to starting (ms has just been started)
+func (ms *Server) setStarting() {
+	ms.Term.IsActive.Store(true)
+	ms.Term.startTime = time.Now()
+
+	ms.Stats.Status.Store(errco.SERVER_STATUS_STARTING)
+	ms.Stats.Suspended.Store(false)
+	ms.Stats.ConnCount = 0
+	ms.Stats.LoadProgress = "0%"
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER IS STARTING! (%s)", ms.Config.Name)
+}
+
+// setOnline sets ms status to online and schedules a soft freeze of ms.
+// If record is true, the start duration is recorded to estimate the next ones.
+func (ms *Server) setOnline(record bool) {
+	ms.Stats.Status.Store(errco.SERVER_STATUS_ONLINE)
+	ms.Stats.OnlineTime = time.Now()
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER IS ONLINE! (%s)", ms.Config.Name)
+
+	// record start duration to estimate the next ones
+	if record {
+		logMsh := servstats.RecordStart(ms.Config.Name, servstats.START_COLD, ms.Stats.OnlineTime.Sub(ms.Term.startTime))
+		if logMsh != nil {
+			logMsh.Log(true)
+		}
+	}
+
+	// schedule soft freeze of ms
+	// (if no players connect the server will shutdown)
+	ms.FreezeMSSchedule()
+}
+
+// setStopping sets ms status to stopping
+func (ms *Server) setStopping() {
+	ms.Stats.Status.Store(errco.SERVER_STATUS_STOPPING)
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER IS STOPPING! (%s)", ms.Config.Name)
+}
+
+// setOffline sets ms status to offline (ms has exited)
+func (ms *Server) setOffline() {
+	ms.rcon.disconnect()
+
+	ms.Stats.Status.Store(errco.SERVER_STATUS_OFFLINE)
+	ms.Stats.Suspended.Store(false)
+	ms.Stats.ConnCount = 0
+	ms.Stats.LoadProgress = "0%"
+	ms.Stats.HibernateTime = time.Now()
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "MINECRAFT SERVER IS OFFLINE! (%s)", ms.Config.Name)
+
+	ms.Term.IsActive.Store(false)
+}
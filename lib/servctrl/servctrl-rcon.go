@@ -0,0 +1,183 @@
+package servctrl
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"msh/lib/config"
+	"msh/lib/conn/protocol"
+	"msh/lib/errco"
+)
+
+// rconTimeout is the timeout of rcon dial / request
+const rconTimeout time.Duration = 5 * time.Second
+
+// rconClient is a client of the minecraft server rcon.
+// It is configured from Lifecycle.RconPort and Lifecycle.RconPassword
+// or from enable-rcon, rcon.port and rcon.password in server.properties.
+type rconClient struct {
+	m      *sync.Mutex
+	c      *config.Configuration
+	conn   net.Conn // authenticated rcon connection (nil if not connected)
+	lastID int32    // id of the last request
+}
+
+// newRconClient returns an rcon client (not connected) for the minecraft server config
+func newRconClient(c *config.Configuration) *rconClient {
+	return &rconClient{m: &sync.Mutex{}, c: c}
+}
+
+// exec executes a command via rcon and returns its output.
+// Commands are executed one at a time, so the output corresponds exactly to the command.
+//
+// sent is false if the command was not sent to ms
+// (rcon is disabled, it's not reachable or the command is too long):
+// in this case the command can be executed in another way.
+func (rc *rconClient) exec(command string) (out string, sent bool, logMsh *errco.MshLog) {
+	if len(command) > protocol.RCON_MAX_COMMAND {
+		return "", false, nil
+	}
+
+	rc.m.Lock()
+	defer rc.m.Unlock()
+
+	// send the command on the current connection, if it fails try again with a new connection
+	// (the connection might have been closed by a restart of ms)
+	for attempt := 0; ; attempt++ {
+		if rc.conn == nil {
+			logMsh = rc.connect()
+			if logMsh != nil || rc.conn == nil {
+				return "", false, logMsh
+			}
+		}
+
+		rc.lastID++
+		id := rc.lastID
+		rc.conn.SetDeadline(time.Now().Add(rconTimeout))
+
+		// the command is sent in its own write:
+		// ms reads a packet with a single read and closes the connection if it contains more bytes than the packet length
+		_, err := rc.conn.Write((&protocol.RconPacket{ID: id, Type: protocol.RCON_COMMAND, Body: command}).Bytes())
+		if err != nil {
+			rc.close()
+			if attempt == 0 {
+				continue
+			}
+			return "", false, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_RCON, "error while sending rcon command: %s", err.Error())
+		}
+
+		return rc.readResponse(id)
+	}
+}
+
+// readResponse reads the response to the command with the specified id.
+//
+// A response shorter than protocol.RCON_MAX_RESPONSE is complete.
+// Otherwise it might be fragmented in more packets: an empty response packet is sent
+// and the fragments are read until ms answers it (ms answers requests in order).
+// rc.m must be locked by the caller.
+func (rc *rconClient) readResponse(id int32) (out string, sent bool, logMsh *errco.MshLog) {
+	var received, sentinel bool
+	for {
+		resp, logMsh := protocol.ReadRconPacket(rc.conn)
+		if logMsh != nil {
+			rc.close()
+			// commands that stop ms might not get the end of the response
+			if received {
+				return out, true, nil
+			}
+			return out, true, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_RCON, "error while reading rcon response: %s", fmt.Sprintf(logMsh.Mex, logMsh.Arg...))
+		}
+
+		switch resp.ID {
+		case id:
+			out += resp.Body
+			received = true
+
+			switch {
+			case sentinel:
+				// fragments are read until the empty response packet is answered
+			case len(resp.Body) < protocol.RCON_MAX_RESPONSE:
+				return out, true, nil
+			default:
+				// the response might be fragmented: the empty response packet is sent after the first fragment
+				sentinel = true
+				rc.lastID++
+				_, err := rc.conn.Write((&protocol.RconPacket{ID: id + 1, Type: protocol.RCON_RESPONSE}).Bytes())
+				if err != nil {
+					rc.close()
+					return out, true, nil
+				}
+			}
+
+		case id + 1:
+			return out, true, nil
+		}
+	}
+}
+
+// close closes the rcon connection.
+// rc.m must be locked by the caller.
+func (rc *rconClient) close() {
+	if rc.conn != nil {
+		rc.conn.Close()
+		rc.conn = nil
+	}
+}
+
+// disconnect closes the rcon connection (a new one is opened by the next command)
+func (rc *rconClient) disconnect() {
+	rc.m.Lock()
+	defer rc.m.Unlock()
+
+	rc.close()
+}
+
+// connect opens an authenticated rcon connection to ms.
+// If rcon is not enabled, rc.conn stays nil and no error is returned.
+// rc.m must be locked by the caller.
+func (rc *rconClient) connect() *errco.MshLog {
+	port, password := rc.c.MSRcon()
+	if password == "" {
+		return nil
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(rc.c.ServHost, strconv.Itoa(port)), rconTimeout)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_RCON, "error while connecting to rcon: %s", err.Error())
+	}
+	conn.SetDeadline(time.Now().Add(rconTimeout))
+
+	// authenticate
+	rc.lastID++
+	_, err = conn.Write((&protocol.RconPacket{ID: rc.lastID, Type: protocol.RCON_AUTH, Body: password}).Bytes())
+	if err != nil {
+		conn.Close()
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_RCON, "error while authenticating to rcon: %s", err.Error())
+	}
+
+	// (an empty response packet might precede the auth response)
+	for {
+		resp, logMsh := protocol.ReadRconPacket(conn)
+		if logMsh != nil {
+			conn.Close()
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_RCON, "error while authenticating to rcon: %s", fmt.Sprintf(logMsh.Mex, logMsh.Arg...))
+		}
+		if resp.Type != protocol.RCON_AUTH_RESPONSE {
+			continue
+		}
+		if resp.ID == -1 {
+			conn.Close()
+			return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_RCON_AUTH, "rcon authentication failed: check Lifecycle.RconPassword or rcon.password in server.properties")
+		}
+		break
+	}
+
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "connected to rcon on port %d (%s)", port, rc.c.Name)
+	rc.conn = conn
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package servctrl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"msh/lib/config"
+	"msh/lib/conn/protocol"
+	"msh/lib/errco"
+)
+
+// fakeRcon serves rcon connections like a vanilla minecraft server:
+// each packet is read with a single read of max 1460 bytes and the connection is closed
+// if the bytes read don't match the packet length (as when more packets are sent in a single write).
+// Command responses longer than protocol.RCON_MAX_RESPONSE are fragmented.
+func fakeRcon(l net.Listener, password string) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		go func(conn net.Conn) {
+			defer conn.Close()
+			buf := make([]byte, 1460)
+			for {
+				n, err := conn.Read(buf)
+				if err != nil || n < 14 || int(binary.LittleEndian.Uint32(buf)) != n-4 {
+					return
+				}
+				req, logMsh := protocol.ReadRconPacket(bytes.NewReader(buf[:n]))
+				if logMsh != nil {
+					return
+				}
+
+				switch req.Type {
+				case protocol.RCON_AUTH:
+					if req.Body != password {
+						req.ID = -1
+					}
+					conn.Write((&protocol.RconPacket{ID: req.ID, Type: protocol.RCON_AUTH_RESPONSE}).Bytes())
+				case protocol.RCON_COMMAND:
+					out := "output of " + req.Body
+					switch req.Body {
+					case "restart":
+						return
+					case "help":
+						out = strings.Repeat("help line\n", protocol.RCON_MAX_RESPONSE/5)
+					}
+					rsp := []byte{}
+					for len(out) > protocol.RCON_MAX_RESPONSE {
+						rsp = append(rsp, (&protocol.RconPacket{ID: req.ID, Type: protocol.RCON_RESPONSE, Body: out[:protocol.RCON_MAX_RESPONSE]}).Bytes()...)
+						out = out[protocol.RCON_MAX_RESPONSE:]
+					}
+					conn.Write(append(rsp, (&protocol.RconPacket{ID: req.ID, Type: protocol.RCON_RESPONSE, Body: out}).Bytes()...))
+				default:
+					conn.Write((&protocol.RconPacket{ID: req.ID, Type: protocol.RCON_RESPONSE, Body: fmt.Sprintf("Unknown request %x", req.Type)}).Bytes())
+				}
+			}
+		}(conn)
+	}
+}
+
+func Test_rconClient(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go fakeRcon(l, "secret")
+
+	c := &config.Configuration{}
+	c.Name, c.ServHost, c.Server.Folder = "test-rcon", "127.0.0.1", t.TempDir()
+	properties := func(p string) {
+		if err := os.WriteFile(filepath.Join(c.Server.Folder, "server.properties"), []byte(p), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rc := newRconClient(c)
+
+	// rcon disabled: command not sent
+	properties("enable-rcon=false\n")
+	if _, sent, logMsh := rc.exec("list"); sent || logMsh != nil {
+		t.Errorf("command sent with rcon disabled (%v)", logMsh)
+	}
+
+	// wrong password: command not sent
+	properties(fmt.Sprintf("enable-rcon=true\nrcon.port=%d\nrcon.password=wrong\n", l.Addr().(*net.TCPAddr).Port))
+	if _, sent, logMsh := rc.exec("list"); sent || logMsh == nil || logMsh.Cod != errco.ERROR_RCON_AUTH {
+		t.Errorf("command sent with wrong password (%v)", logMsh)
+	}
+
+	// commands are executed
+	properties(fmt.Sprintf("enable-rcon=true\nrcon.port=%d\nrcon.password=secret\n", l.Addr().(*net.TCPAddr).Port))
+	if out, sent, logMsh := rc.exec("list"); !sent || logMsh != nil || out != "output of list" {
+		t.Errorf("unexpected output %q (sent %t, %v)", out, sent, logMsh)
+	}
+
+	// fragmented responses are joined
+	if out, sent, logMsh := rc.exec("help"); !sent || logMsh != nil || out != strings.Repeat("help line\n", protocol.RCON_MAX_RESPONSE/5) {
+		t.Errorf("unexpected fragmented output of %d bytes (sent %t, %v)", len(out), sent, logMsh)
+	}
+
+	// concurrent commands get their own output
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			command := fmt.Sprintf("say %s", strings.Repeat(fmt.Sprint(i), i))
+			if out, _, logMsh := rc.exec(command); logMsh != nil || out != "output of "+command {
+				t.Errorf("unexpected output %q of %q (%v)", out, command, logMsh)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// a closed connection is replaced by a new one
+	rc.exec("restart")
+	if out, sent, logMsh := rc.exec("list"); !sent || logMsh != nil || out != "output of list" {
+		t.Errorf("unexpected output after reconnection %q (sent %t, %v)", out, sent, logMsh)
+	}
+
+	// lifecycle rcon port and password are used instead of server.properties
+	properties("enable-rcon=false\nrcon.port=1\nrcon.password=wrong\n")
+	c.Lifecycle.RconPort, c.Lifecycle.RconPassword = l.Addr().(*net.TCPAddr).Port, "secret"
+	rc = newRconClient(c)
+	if out, sent, logMsh := rc.exec("list"); !sent || logMsh != nil || out != "output of list" {
+		t.Errorf("unexpected output with lifecycle rcon config %q (sent %t, %v)", out, sent, logMsh)
+	}
+}
+
+func Test_countListCom(t *testing.T) {
+	tests := map[string]int{
+		"There are 3 of a max of 20 players online: Steve, Alex, Notch": 3,
+		"There are §c2§6 out of maximum §c20§6 players online.":         2,
+	}
+
+	for s, expect := range tests {
+		if n, logMsh := countListCom(s); logMsh != nil || n != expect {
+			t.Errorf("player count of %q: %d (expected %d, %v)", s, n, expect, logMsh)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package servctrl
+
+import (
+	"strings"
+
+	"msh/lib/config"
+	"msh/lib/errco"
+	"msh/lib/servstats"
+)
+
+// Servers contains the minecraft servers managed by msh.
+// Servers[0] is the default minecraft server.
+var Servers []*Server = []*Server{NewServer(config.ConfigRuntime)}
+
+// Server represents a minecraft server managed by msh
+type Server struct {
+	Config  *config.Configuration  // runtime config of the minecraft server
+	Stats   *servstats.ServerStats // stats of the minecraft server
+	Term    *servTerminal          // terminal of the minecraft server
+	lastOut chan string            // channel used to communicate the last line got from the printer function
+	rcon    *rconClient            // rcon client of the minecraft server (used to execute commands if rcon is enabled)
+	lc      lifecycle              // lifecycle of the minecraft server (start, stop, suspension)
+}
+
+// NewServer returns a new minecraft server using the specified runtime config.
+// Major errors found while loading config are reported to the server stats.
+func NewServer(c *config.Configuration) *Server {
+	ms := &Server{
+		Config:  c,
+		Stats:   servstats.NewStats(),
+		Term:    &servTerminal{},
+		lastOut: make(chan string),
+		rcon:    newRconClient(c),
+	}
+	ms.lc = newLifecycle(ms)
+
+	if c.MajorError != nil {
+		ms.Stats.SetMajorError(c.MajorError)
+	}
+
+	return ms
+}
+
+// LoadServers loads a minecraft server for each runtime config in config.ConfigServers.
+// Minecraft servers that are already running (not started by msh) are tracked by their lifecycle.
+// Should be called after config is loaded.
+func LoadServers() {
+	Servers = []*Server{}
+	for _, c := range config.ConfigServers {
+		Servers = append(Servers, NewServer(c))
+	}
+
+	for _, ms := range Servers {
+		ms.lc.attach()
+	}
+}
+
+// ServerByName returns the minecraft server with the specified name (case insensitive)
+func ServerByName(name string) (*Server, *errco.MshLog) {
+	for _, ms := range Servers {
+		if strings.EqualFold(ms.Config.Name, name) {
+			return ms, nil
+		}
+	}
+
+	return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_UNKNOWN, "minecraft server %s not found", name)
+}
+
+// ServersByPort returns the minecraft servers that clients reach on the specified msh port
+func ServersByPort(mshPort int) []*Server {
+	servers := []*Server{}
+	for _, ms := range Servers {
+		if ms.Config.Msh.MshPort == mshPort {
+			servers = append(servers, ms)
+		}
+	}
+
+	return servers
+}
+
+// ServerByHost returns the minecraft server that clients reach with the specified msh port and hostname.
+//
+// Hostnames are matched exactly (case insensitive) before wildcard hostnames ("*.example.com").
+// If no server matches, the first minecraft server on the msh port is returned
+// (nil if there are no servers on the msh port).
+func ServerByHost(mshPort int, host string) *Server {
+	servers := ServersByPort(mshPort)
+	if len(servers) == 0 {
+		return nil
+	}
+
+	host = strings.ToLower(host)
+
+	// exact hostnames
+	for _, ms := range servers {
+		for _, h := range ms.Config.Hostnames {
+			if strings.ToLower(h) == host {
+				return ms
+			}
+		}
+	}
+
+	// wildcard hostnames
+	for _, ms := range servers {
+		for _, h := range ms.Config.Hostnames {
+			h = strings.ToLower(h)
+			if strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:]) {
+				return ms
+			}
+		}
+	}
+
+	return servers[0]
+}
+
+// outPrefix returns the prefix of the minecraft server output lines.
+// When msh manages more than one server, the output lines are prefixed with the server name.
+func (ms *Server) outPrefix() string {
+	if len(Servers) < 2 {
+		return ""
+	}
+
+	return "[" + ms.Config.Name + "] "
+}
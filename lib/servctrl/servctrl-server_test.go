@@ -0,0 +1,55 @@
+package servctrl
+
+import (
+	"testing"
+
+	"msh/lib/config"
+)
+
+func Test_ServerByHost(t *testing.T) {
+	newServer := func(name string, mshPort int, hostnames ...string) *Server {
+		c := &config.Configuration{}
+		c.Name, c.Hostnames, c.Msh.MshPort = name, hostnames, mshPort
+		return NewServer(c)
+	}
+
+	defer func(s []*Server) { Servers = s }(Servers)
+	Servers = []*Server{
+		newServer("default", 25555),
+		newServer("survival", 25555, "survival.example.com", "*.survival.example.com"),
+		newServer("creative", 25555, "Creative.example.com"),
+		newServer("wildcard", 25555, "*.example.com"),
+		newServer("modpack", 25556),
+		newServer("modpack-lan", 25556, "192.168.1.10"),
+	}
+
+	type test struct {
+		port   int
+		host   string
+		expect string
+	}
+
+	var tests []test = []test{
+		{25555, "survival.example.com", "survival"},
+		{25555, "eu.survival.example.com", "survival"},
+		{25555, "creative.example.com", "creative"},
+		{25555, "CREATIVE.EXAMPLE.COM", "creative"},
+		{25555, "modpack.example.com", "wildcard"},
+		{25555, "example.com", "default"},
+		{25555, "127.0.0.1", "default"},
+		{25555, "", "default"},
+		{25556, "survival.example.com", "modpack"},
+		{25556, "192.168.1.10", "modpack-lan"},
+	}
+
+	for _, tt := range tests {
+		if ms := ServerByHost(tt.port, tt.host); ms.Config.Name != tt.expect {
+			t.Errorf("%s:%d routed to %s (expected %s)", tt.host, tt.port, ms.Config.Name, tt.expect)
+		}
+	}
+
+	// no servers on msh port
+	if ms := ServerByHost(25557, "survival.example.com"); ms != nil {
+		t.Errorf("survival.example.com:25557 routed to %s (expected none)", ms.Config.Name)
+	}
+}
@@ -1,10 +1,9 @@
 package servctrl
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
-	"fmt"
-	"math/big"
 	"net"
 	"regexp"
 	"strconv"
@@ -12,6 +11,8 @@ import (
 	"time"
 
 	"msh/lib/config"
+	"msh/lib/conn/protocol"
+	"msh/lib/conn/proxyproto"
 	"msh/lib/errco"
 	"msh/lib/model"
 	"msh/lib/servstats"
@@ -25,28 +26,28 @@ import (
 //
 // no error is returned: the return integer is always meaningful
 // (might be more or less reliable depending from where it retrieved).
-func countPlayerSafe() int {
+func (ms *Server) countPlayerSafe() int {
 	var logMsh *errco.MshLog
 	var playerCount int
 	var method string
 
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "retrieving player count...")
 
-	if playerCount, logMsh = getPlayersByServInfo(); logMsh.Log(true) == nil {
+	if playerCount, logMsh = ms.getPlayersByServInfo(); logMsh.Log(true) == nil {
 		method = "server info"
-		if playerCount != servstats.Stats.ConnCount {
-			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_WRONG_CONNECTION_COUNT, "connection count (%d) different from %s player count (%d)", servstats.Stats.ConnCount, method, playerCount)
+		if playerCount != ms.Stats.ConnCount {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_WRONG_CONNECTION_COUNT, "connection count (%d) different from %s player count (%d)", ms.Stats.ConnCount, method, playerCount)
 		}
 
-	} else if playerCount, logMsh = getPlayersByListCom(); logMsh.Log(true) == nil {
+	} else if playerCount, logMsh = ms.getPlayersByListCom(); logMsh.Log(true) == nil {
 		method = "list command"
-		if playerCount != servstats.Stats.ConnCount {
-			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_WRONG_CONNECTION_COUNT, "connection count (%d) different from %s player count (%d)", servstats.Stats.ConnCount, method, playerCount)
+		if playerCount != ms.Stats.ConnCount {
+			errco.NewLogln(errco.TYPE_WAR, errco.LVL_1, errco.ERROR_WRONG_CONNECTION_COUNT, "connection count (%d) different from %s player count (%d)", ms.Stats.ConnCount, method, playerCount)
 		}
 
 	} else {
 		method = "connection count"
-		playerCount = servstats.Stats.ConnCount
+		playerCount = ms.Stats.ConnCount
 	}
 
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "%d online players - method for player count: %s", playerCount, method)
@@ -55,13 +56,25 @@ func countPlayerSafe() int {
 }
 
 // getPlayersByListCom returns the number of players using "list" command
-func getPlayersByListCom() (int, *errco.MshLog) {
-	output, logMsh := Execute("list")
+func (ms *Server) getPlayersByListCom() (int, *errco.MshLog) {
+	// check if ms is warm and interactable
+	logMsh := ms.CheckMSWarm()
 	if logMsh != nil {
 		return -1, logMsh.AddTrace()
 	}
 
-	playerCount, logMsh := searchListCom(output)
+	output, rcon, logMsh := ms.execute("list")
+	if logMsh != nil {
+		return -1, logMsh.AddTrace()
+	}
+
+	// rcon output is the exact output of the list command (without log format)
+	var playerCount int
+	if rcon {
+		playerCount, logMsh = countListCom(output)
+	} else {
+		playerCount, logMsh = searchListCom(output)
+	}
 	if logMsh != nil {
 		return -1, logMsh.AddTrace()
 	}
@@ -69,13 +82,21 @@ func getPlayersByListCom() (int, *errco.MshLog) {
 	return playerCount, nil
 }
 
-// searchListCom analyzes the output of the list command to extract player count
+// searchListCom analyzes the terminal output of the list command to extract player count
 func searchListCom(s string) (int, *errco.MshLog) {
 	// return if string has unexpected format
 	if !strings.Contains(s, "INFO]:") {
 		return -1, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_UNEXP_OUTPUT, "string does not contain \"INFO]:\"")
 	}
 
+	return countListCom(s)
+}
+
+// countListCom extracts the player count from the output of the list command
+func countListCom(s string) (int, *errco.MshLog) {
+	// remove formatting codes (used by plugins)
+	s = regexp.MustCompile(`§.`).ReplaceAllString(s, "")
+
 	playerCount := regexp.MustCompile(` \d+ `).FindString(s)
 	playerCount = strings.ReplaceAll(playerCount, " ", "")
 
@@ -93,8 +114,8 @@ func searchListCom(s string) (int, *errco.MshLog) {
 }
 
 // getPlayersByServInfo returns the number of players using server info request
-func getPlayersByServInfo() (int, *errco.MshLog) {
-	servInfo, logMsh := getServInfo()
+func (ms *Server) getPlayersByServInfo() (int, *errco.MshLog) {
+	servInfo, logMsh := ms.getServInfo()
 	if logMsh != nil {
 		return -1, logMsh.AddTrace()
 	}
@@ -103,89 +124,115 @@ func getPlayersByServInfo() (int, *errco.MshLog) {
 }
 
 // getServInfo returns server info after emulating a server info request to the minecraft server
-func getServInfo() (*model.DataInfo, *errco.MshLog) {
-	var recInfoData []byte = []byte{}
-	var recInfo *model.DataInfo = &model.DataInfo{}
-	var buf []byte = make([]byte, 1024)
-
+func (ms *Server) getServInfo() (*model.DataInfo, *errco.MshLog) {
 	// check if ms is warm and interactable
-	logMsh := CheckMSWarm()
+	logMsh := ms.CheckMSWarm()
 	if logMsh != nil {
 		return nil, logMsh.AddTrace()
 	}
 
+	recInfo, logMsh := ms.requestServInfo()
+	if logMsh != nil {
+		return nil, logMsh.AddTrace()
+	}
+
+	// update server version and protocol in config
+	if recInfo.Version.Name != ms.Config.Server.Version || recInfo.Version.Protocol != ms.Config.Server.Protocol {
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "server version found! serverVersion: %s serverProtocol: %d", recInfo.Version.Name, recInfo.Version.Protocol)
+
+		// update runtime config if version is not specified
+		if ms.Config.Server.Version == "" {
+			ms.Config.Server.Version = recInfo.Version.Name
+			ms.Config.Server.Protocol = recInfo.Version.Protocol
+		}
+
+		// update and save default config
+		// (only the version of the default minecraft server is saved to config file)
+		if ms.Config == config.ConfigRuntime {
+			config.ConfigDefault.Server.Version = recInfo.Version.Name
+			config.ConfigDefault.Server.Protocol = recInfo.Version.Protocol
+			logMsh := config.ConfigDefault.Save()
+			if logMsh != nil {
+				return nil, logMsh.AddTrace()
+			}
+		}
+	}
+
+	return recInfo, nil
+}
+
+// requestServInfo emulates a server info request (status ping) to the minecraft server and returns the server info.
+// (ms status is not checked)
+func (ms *Server) requestServInfo() (*model.DataInfo, *errco.MshLog) {
+	var recInfo *model.DataInfo = &model.DataInfo{}
+
 	// open connection to minecraft server
-	serverSocket, err := net.Dial("tcp", fmt.Sprintf("%s:%d", config.ServHost, config.ServPort))
+	serverSocket, err := net.DialTimeout("tcp", net.JoinHostPort(ms.Config.ServHost, strconv.Itoa(ms.Config.ServPort)), 2*time.Second)
 	if err != nil {
 		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_DIAL, err.Error())
 	}
 	defer serverSocket.Close()
 
-	// building byte array to request minecraft server info
-	// [16 0 244 5 9 49 50 55 46 48 46 48 46 49 99 211 1 1 0 ]
-	//                                          └port┘ └info┘
-	reqInfoMessage := bytes.NewBuffer([]byte{16, 0, 244, 5, 9, 49, 50, 55, 46, 48, 46, 48, 46, 49})
-	reqInfoMessage.Write(big.NewInt(int64(config.MshPort)).Bytes())
-	reqInfoMessage.Write([]byte{1, 1, 0})
+	// ms accepts only connections that send the proxy protocol header
+	if ms.Config.Msh.SendProxyProtocol {
+		serverSocket.Write(proxyproto.NewHeader(serverSocket.LocalAddr(), serverSocket.RemoteAddr()).Bytes())
+	}
 
-	mes := reqInfoMessage.Bytes()
+	// request minecraft server info: handshake (next state: status) + status request
+	handshake := &protocol.Handshake{
+		ProtocolVersion: int32(ms.Config.Server.Protocol),
+		ServerAddress:   ms.Config.ServHost,
+		ServerPort:      uint16(ms.Config.ServPort),
+		NextState:       protocol.STATE_STATUS,
+	}
+	mes := append(handshake.Packet().Bytes(), protocol.NewPacket(protocol.ID_STATUS_REQUEST, nil).Bytes()...)
 	serverSocket.Write(mes)
 	errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%smsh --> server%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, mes)
 
-	// read response from server
-	for {
-		// timeout can be low since its a connection to 127.0.0.1
-		// the first time the ms info are requested it timeout is <100 mills
-		// (probably the ms function that handles ms info needs time to load the first time it's called)
-		serverSocket.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
-
-		dataLen, err := serverSocket.Read(buf)
-		if err != nil {
-			// cannot break on io.EOF since it's not sent, so break happens on timeout
-			// using io.EOF would be better
-			if err, ok := err.(net.Error); ok && err.Timeout() {
-				break
-			}
-
-			return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_REQUEST_INFO, err.Error())
-		}
-
-		errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%sserver --> msh%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, buf[:dataLen])
-
-		recInfoData = append(recInfoData, buf[:dataLen]...)
+	// read status response from server
+	// (the first time the ms info are requested the response might take some time:
+	// probably the ms function that handles ms info needs time to load the first time it's called)
+	serverSocket.SetReadDeadline(time.Now().Add(2 * time.Second))
+	statusPacket, logMsh := protocol.ReadPacket(bufio.NewReader(serverSocket))
+	if logMsh != nil {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_REQUEST_INFO, logMsh.Mex, logMsh.Arg...)
 	}
+	errco.NewLogln(errco.TYPE_BYT, errco.LVL_4, errco.ERROR_NIL, "%sserver --> msh%s: %v", errco.COLOR_PURPLE, errco.COLOR_RESET, statusPacket.Bytes())
 
-	// remove first 5 bytes that are used as header to get only the json data
-	// [178 88 0 175 88]{"description":{ ...
-	if len(recInfoData) < 5 {
-		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_REQUEST_INFO, "not enough data received (%v)", recInfoData)
+	if statusPacket.ID != protocol.ID_STATUS_RESPONSE {
+		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_REQUEST_INFO, "unexpected packet received (id: %d)", statusPacket.ID)
+	}
+	recInfoData, logMsh := protocol.ReadString(bytes.NewReader(statusPacket.Data))
+	if logMsh != nil {
+		return nil, logMsh.AddTrace()
 	}
-	recInfoData = recInfoData[5:]
 
 	// load data into struct
-	err = json.Unmarshal(recInfoData, recInfo)
+	err = json.Unmarshal([]byte(recInfoData), recInfo)
 	if err != nil {
 		return nil, errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_JSON_UNMARSHAL, err.Error())
 	}
 
-	// update server version and protocol in config
-	if recInfo.Version.Name != config.ConfigRuntime.Server.Version || recInfo.Version.Protocol != config.ConfigRuntime.Server.Protocol {
-		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "server version found! serverVersion: %s serverProtocol: %d", recInfo.Version.Name, recInfo.Version.Protocol)
-
-		// update runtime config if version is not specified
-		if config.ConfigRuntime.Server.Version == "" {
-			config.ConfigRuntime.Server.Version = recInfo.Version.Name
-			config.ConfigRuntime.Server.Protocol = recInfo.Version.Protocol
-		}
+	return recInfo, nil
+}
 
-		// update and save default config
-		config.ConfigDefault.Server.Version = recInfo.Version.Name
-		config.ConfigDefault.Server.Protocol = recInfo.Version.Protocol
-		logMsh := config.ConfigDefault.Save()
-		if logMsh != nil {
-			return nil, logMsh.AddTrace()
+// resumeReadyTimeout is the max time waited for minecraft server to respond after resume
+const resumeReadyTimeout time.Duration = 30 * time.Second
+
+// recordResume records the duration of a minecraft server resume,
+// from the resume time to the first server info response.
+// [goroutine]
+func (ms *Server) recordResume(resumeTime time.Time) {
+	for time.Since(resumeTime) < resumeReadyTimeout {
+		if _, logMsh := ms.getServInfo(); logMsh == nil {
+			logMsh = servstats.RecordStart(ms.Config.Name, servstats.START_RESUME, time.Since(resumeTime))
+			if logMsh != nil {
+				logMsh.Log(true)
+			}
+			return
 		}
+		time.Sleep(100 * time.Millisecond)
 	}
 
-	return recInfo, nil
+	errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_NIL, "minecraft server %s not ready %s after resume (resume duration not recorded)", ms.Config.Name, resumeReadyTimeout)
 }
@@ -3,54 +3,58 @@ package servctrl
 import (
 	"time"
 
-	"msh/lib/config"
 	"msh/lib/errco"
-	"msh/lib/opsys"
-	"msh/lib/servstats"
 )
 
 // WarmMS warms the minecraft server
 // [non-blocking]
-func WarmMS() *errco.MshLog {
+func (ms *Server) WarmMS() *errco.MshLog {
 	var logMsh *errco.MshLog
 
-	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "issued minecraft server warm...")
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "issued minecraft server warm... (%s)", ms.Config.Name)
 
 	// don't try to warm ms if it has encountered major errors
-	if servstats.Stats.MajorError != nil {
+	if ms.Stats.MajorError != nil {
 		return errco.NewLog(errco.TYPE_ERR, errco.LVL_1, errco.ERROR_MINECRAFT_SERVER, "minecraft server has encountered major problems")
 	}
 
-	switch servstats.Stats.Status {
+	switch ms.Stats.Status.Load() {
 
 	case errco.SERVER_STATUS_OFFLINE:
 		// ms is offline, log error if ms process is set to suspended
 
-		if servstats.Stats.Suspended {
+		if ms.Stats.Suspended.Load() {
 			errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_SERVER_OFFLINE_SUSPENDED, "minecraft server is suspended and offline")
-			servstats.Stats.Suspended = false // if ms is offline it's process can't be suspended
+			ms.Stats.Suspended.Store(false) // if ms is offline it's process can't be suspended
 		}
 
-		logMsh = termStart()
+		logMsh = ms.lc.start()
 		if logMsh != nil {
-			servstats.Stats.SetMajorError(errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_MINECRAFT_SERVER, "error starting minecraft server (check logs)"))
+			ms.Stats.SetMajorError(errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_MINECRAFT_SERVER, "error starting minecraft server (check logs)"))
 			return logMsh.AddTrace()
 		}
 
 	default:
-		if config.ConfigRuntime.Msh.SuspendAllow {
-			servstats.Stats.Suspended, logMsh = opsys.ProcTreeResume(uint32(ServTerm.cmd.Process.Pid))
+		if ms.Config.Msh.SuspendAllow {
+			wasSuspended, resumeTime := ms.Stats.Suspended.Load(), time.Now()
+			suspended, logMsh := ms.lc.resume()
+			ms.Stats.Suspended.Store(suspended)
 			if logMsh != nil {
 				return logMsh.AddTrace()
 			}
+
+			// record resume duration to estimate the next ones
+			if wasSuspended && ms.Stats.Status.Load() == errco.SERVER_STATUS_ONLINE {
+				go ms.recordResume(resumeTime)
+			}
 		}
 	}
 
 	// set mc warmup time
-	servstats.Stats.WarmUpTime = time.Now()
+	ms.Stats.WarmUpTime = time.Now()
 
 	// schedule soft freeze of ms
-	FreezeMSSchedule()
+	ms.FreezeMSSchedule()
 
 	return nil
 }
@@ -59,24 +63,25 @@ func WarmMS() *errco.MshLog {
 // When force == true, it does not perform player check and orders the server shutdown (according to ms status)
 //
 // If force freeze is issued while ms is starting, this func waits for ms to reach online state and then force freeze it.
-func FreezeMS(force bool) *errco.MshLog {
+func (ms *Server) FreezeMS(force bool) *errco.MshLog {
 	var logMsh *errco.MshLog
 
 	if force {
-		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "executing ms force freeze...")
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "executing ms force freeze... (%s)", ms.Config.Name)
 	} else {
-		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "executing ms soft freeze...")
+		errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "executing ms soft freeze... (%s)", ms.Config.Name)
 	}
 
-	switch servstats.Stats.Status {
+	switch ms.Stats.Status.Load() {
 
 	case errco.SERVER_STATUS_STARTING:
 		// ms is starting, resume the ms process and freeze ms
 
 		// resume ms process (un/suspended)
 		// to be sure that ms process is running to allow ms start
-		if config.ConfigRuntime.Msh.SuspendAllow {
-			servstats.Stats.Suspended, logMsh = opsys.ProcTreeResume(uint32(ServTerm.cmd.Process.Pid))
+		if ms.Config.Msh.SuspendAllow {
+			suspended, logMsh := ms.lc.resume()
+			ms.Stats.Suspended.Store(suspended)
 			if logMsh != nil {
 				return logMsh.AddTrace()
 			}
@@ -85,12 +90,12 @@ func FreezeMS(force bool) *errco.MshLog {
 		if force {
 			// wait ms to go online
 			errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "waiting for minecraft server to go online... (msh will stop it after)")
-			for servstats.Stats.Status == errco.SERVER_STATUS_STARTING {
+			for ms.Stats.Status.Load() == errco.SERVER_STATUS_STARTING {
 				time.Sleep(1 * time.Second)
 			}
 
 			// if ms not online return error
-			if servstats.Stats.Status != errco.SERVER_STATUS_ONLINE {
+			if ms.Stats.Status.Load() != errco.SERVER_STATUS_ONLINE {
 				return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_NOT_ONLINE, "minecraft server did not reach online status after starting")
 			}
 
@@ -102,7 +107,7 @@ func FreezeMS(force bool) *errco.MshLog {
 		} else {
 			// schedule soft freeze of ms
 			// (give ms more time to start)
-			FreezeMSSchedule()
+			ms.FreezeMSSchedule()
 			return nil
 		}
 
@@ -114,7 +119,7 @@ func FreezeMS(force bool) *errco.MshLog {
 
 		// if force freeze, resume and stop ms
 		if force {
-			logMsh = resumeStopMS()
+			logMsh = ms.resumeStopMS()
 			if logMsh != nil {
 				return logMsh.AddTrace()
 			}
@@ -122,19 +127,21 @@ func FreezeMS(force bool) *errco.MshLog {
 		}
 
 		// check how many players are on the server
-		if countPlayerSafe() > 0 {
+		if ms.countPlayerSafe() > 0 {
 			return errco.NewLog(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_NOT_EMPTY, "server is not empty")
 		}
 
 		// suspend/stop ms
-		if config.ConfigRuntime.Msh.SuspendAllow {
-			servstats.Stats.Suspended, logMsh = opsys.ProcTreeSuspend(uint32(ServTerm.cmd.Process.Pid))
+		if ms.Config.Msh.SuspendAllow {
+			suspended, logMsh := ms.lc.suspend()
+			ms.Stats.Suspended.Store(suspended)
 			if logMsh != nil {
 				return logMsh.AddTrace()
 			}
+			ms.Stats.HibernateTime = time.Now()
 		} else {
 			// resume and stop ms
-			logMsh = resumeStopMS()
+			logMsh = ms.resumeStopMS()
 			if logMsh != nil {
 				return logMsh.AddTrace()
 			}
@@ -146,8 +153,9 @@ func FreezeMS(force bool) *errco.MshLog {
 		// is ms is stopping, resume the process and let it stop
 
 		// resume ms process (un/suspended)
-		if config.ConfigRuntime.Msh.SuspendAllow {
-			servstats.Stats.Suspended, logMsh = opsys.ProcTreeResume(uint32(ServTerm.cmd.Process.Pid))
+		if ms.Config.Msh.SuspendAllow {
+			suspended, logMsh := ms.lc.resume()
+			ms.Stats.Suspended.Store(suspended)
 			if logMsh != nil {
 				return logMsh.AddTrace()
 			}
@@ -156,7 +164,7 @@ func FreezeMS(force bool) *errco.MshLog {
 		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_STOPPING, "waiting for minecraft server to go offline...")
 
 		// wait for ms to go offline
-		for servstats.Stats.Status == errco.SERVER_STATUS_STOPPING {
+		for ms.Stats.Status.Load() == errco.SERVER_STATUS_STOPPING {
 			time.Sleep(1 * time.Second)
 		}
 
@@ -166,9 +174,9 @@ func FreezeMS(force bool) *errco.MshLog {
 		// ms is offline
 
 		// log error if ms process is set to suspended
-		if servstats.Stats.Suspended {
+		if ms.Stats.Suspended.Load() {
 			errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_OFFLINE_SUSPENDED, "minecraft server is suspended and offline")
-			servstats.Stats.Suspended = false // if ms is offline it's process can't be suspended
+			ms.Stats.Suspended.Store(false) // if ms is offline it's process can't be suspended
 		}
 
 		errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_OFFLINE, "minecraft server is offline")
@@ -181,23 +189,28 @@ func FreezeMS(force bool) *errco.MshLog {
 }
 
 // FreezeMSSchedule stops freeze timer and schedules a soft freeze of ms
-func FreezeMSSchedule() {
-	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "scheduling ms soft freeze in %d seconds", config.ConfigRuntime.Msh.TimeBeforeStoppingEmptyServer)
+func (ms *Server) FreezeMSSchedule() {
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "scheduling ms soft freeze in %d seconds (%s)", ms.Config.Msh.TimeBeforeStoppingEmptyServer, ms.Config.Name)
+
+	// the freeze timer is replaced while holding the stats mutex
+	// (ms soft freeze is scheduled both by the lifecycle and by clients)
+	ms.Stats.M.Lock()
+	defer ms.Stats.M.Unlock()
 
 	// stop freeze timer so that it can be reset
 	// don't use drain channel procedure described in Stop() as it might happen
 	// that at this point a signal has already been received from t.C
 	// (calling a <-channel might be blocking)
-	_ = servstats.Stats.FreezeTimer.Stop()
+	_ = ms.Stats.FreezeTimer.Stop()
 
 	// schedule soft freeze of ms in TimeBeforeStoppingEmptyServer seconds
 	// [goroutine]
-	servstats.Stats.FreezeTimer = time.AfterFunc(
-		time.Duration(config.ConfigRuntime.Msh.TimeBeforeStoppingEmptyServer)*time.Second,
+	ms.Stats.FreezeTimer = time.AfterFunc(
+		time.Duration(ms.Config.Msh.TimeBeforeStoppingEmptyServer)*time.Second,
 		func() {
 			// perform soft freeze of ms
-			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "performing scheduled ms soft freeze")
-			logMsh := FreezeMS(false)
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "performing scheduled ms soft freeze (%s)", ms.Config.Name)
+			logMsh := ms.FreezeMS(false)
 			if logMsh != nil {
 				logMsh.Log(true)
 			}
@@ -205,28 +218,32 @@ func FreezeMSSchedule() {
 	)
 }
 
-// resumeStopMS resumes ms process and executes a stop command in ms terminal.
+// resumeStopMS resumes ms process and stops ms (with a stop command in ms terminal or as specified by ms lifecycle).
 //
-// Should be called only when servstats.Stats.Status == ONLINE
-func resumeStopMS() *errco.MshLog {
+// Should be called only when ms.Stats.Status == ONLINE
+func (ms *Server) resumeStopMS() *errco.MshLog {
 	var logMsh *errco.MshLog
 
 	// resume ms process (un/suspended)
-	if config.ConfigRuntime.Msh.SuspendAllow {
-		servstats.Stats.Suspended, logMsh = opsys.ProcTreeResume(uint32(ServTerm.cmd.Process.Pid))
+	if ms.Config.Msh.SuspendAllow {
+		suspended, logMsh := ms.lc.resume()
+		ms.Stats.Suspended.Store(suspended)
 		if logMsh != nil {
 			return logMsh.AddTrace()
 		}
 	}
 
-	// execute stop command
-	_, logMsh = Execute(config.ConfigRuntime.Commands.StopServer)
+	// stop ms
+	logMsh = ms.lc.stop()
 	if logMsh != nil {
 		return logMsh.AddTrace()
 	}
 
 	// launch a function to check the shutdown of minecraft server
-	go killMSifOnlineAfterTimeout()
+	// (unless ms lifecycle kills ms itself when it does not stop in time)
+	if se, ok := ms.lc.(stopEnforcer); !ok || !se.enforcesStopTimeout() {
+		go ms.killMSifOnlineAfterTimeout()
+	}
 
 	return nil
 }
@@ -235,20 +252,19 @@ func resumeStopMS() *errco.MshLog {
 // if the server is still online, kills the server process.
 //
 // if StopServerAllowKill is disabled this function does nothing.
-func killMSifOnlineAfterTimeout() {
-	var logMsh *errco.MshLog
-
+func (ms *Server) killMSifOnlineAfterTimeout() {
 	// if StopServerAllowKill is disabled in config, do nothing
-	if config.ConfigRuntime.Commands.StopServerAllowKill <= 0 {
+	if ms.Config.Commands.StopServerAllowKill <= 0 {
 		return
 	}
 
-	countdown := config.ConfigRuntime.Commands.StopServerAllowKill
+	countdown := ms.Config.Commands.StopServerAllowKill
 
 	// resume ms process (un/suspended)
 	// to be sure that ms is running to stop itself
-	if config.ConfigRuntime.Msh.SuspendAllow {
-		servstats.Stats.Suspended, logMsh = opsys.ProcTreeResume(uint32(ServTerm.cmd.Process.Pid))
+	if ms.Config.Msh.SuspendAllow {
+		suspended, logMsh := ms.lc.resume()
+		ms.Stats.Suspended.Store(suspended)
 		if logMsh != nil {
 			logMsh.Log(true)
 		}
@@ -256,7 +272,7 @@ func killMSifOnlineAfterTimeout() {
 
 	for countdown > 0 {
 		// if server goes offline it's the correct behaviour -> return
-		if servstats.Stats.Status == errco.SERVER_STATUS_OFFLINE {
+		if ms.Stats.Status.Load() == errco.SERVER_STATUS_OFFLINE {
 			return
 		}
 
@@ -266,14 +282,14 @@ func killMSifOnlineAfterTimeout() {
 
 	// save world before killing the server, do not check for errors
 	errco.NewLogln(errco.TYPE_INF, errco.LVL_3, errco.ERROR_NIL, "saving word before killing the minecraft server process")
-	_, _ = Execute("save-all")
+	_, _ = ms.Execute("save-all")
 
 	// give time to save word
 	time.Sleep(10 * time.Second)
 
 	// send kill signal to server
 	errco.NewLogln(errco.TYPE_WAR, errco.LVL_3, errco.ERROR_SERVER_KILL, "minecraft server process won't stop normally: sending kill signal")
-	LogMsh := opsys.ProcTreeKill(uint32(ServTerm.cmd.Process.Pid))
+	LogMsh := ms.lc.kill()
 	if LogMsh != nil {
 		LogMsh.Log(true)
 	}
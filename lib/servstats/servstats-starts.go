@@ -0,0 +1,136 @@
+package servstats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"msh/lib/errco"
+)
+
+// kinds of recorded starts
+const (
+	START_COLD   string = "start"  // minecraft server process started (from warm to online)
+	START_RESUME string = "resume" // suspended minecraft server process resumed (from warm to ready)
+)
+
+const (
+	keepStarts     int = 20 // start durations kept in starts file for each server and kind of start
+	estimateStarts int = 5  // most recent start durations used to estimate the next one
+)
+
+// startsFileName is the file where start durations are persisted
+var startsFileName string = "msh-starts.json"
+
+var (
+	startsM *sync.Mutex                   = &sync.Mutex{}
+	starts  map[string]map[string][]int64 = map[string]map[string][]int64{} // start durations (ms): server -> kind of start -> durations (oldest first)
+)
+
+// RecordStart adds the duration of a minecraft server start to the start history and saves it to starts file
+func RecordStart(server, kind string, d time.Duration) *errco.MshLog {
+	startsM.Lock()
+	defer startsM.Unlock()
+
+	if starts[server] == nil {
+		starts[server] = map[string][]int64{}
+	}
+
+	durations := append(starts[server][kind], d.Milliseconds())
+	if len(durations) > keepStarts {
+		durations = durations[len(durations)-keepStarts:]
+	}
+	starts[server][kind] = durations
+
+	data, err := json.MarshalIndent(starts, "", "  ")
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_STARTS_SAVE, err.Error())
+	}
+
+	err = os.WriteFile(startsFileName, data, 0644)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_STARTS_SAVE, err.Error())
+	}
+
+	return nil
+}
+
+// LoadStarts loads the start history from starts file.
+// A missing starts file is not an error.
+func LoadStarts() *errco.MshLog {
+	data, err := os.ReadFile(startsFileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_STARTS_LOAD, err.Error())
+	}
+
+	loaded := map[string]map[string][]int64{}
+	err = json.Unmarshal(data, &loaded)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_STARTS_LOAD, "%s is not json formatted: %s", startsFileName, err.Error())
+	}
+
+	startsM.Lock()
+	defer startsM.Unlock()
+
+	// starts recorded before loading are kept as most recent
+	for server, kinds := range loaded {
+		if starts[server] == nil {
+			starts[server] = map[string][]int64{}
+		}
+		for kind, durations := range kinds {
+			durations = append(durations, starts[server][kind]...)
+			if len(durations) > keepStarts {
+				durations = durations[len(durations)-keepStarts:]
+			}
+			starts[server][kind] = durations
+		}
+	}
+
+	return nil
+}
+
+// EstimateStart returns the estimated duration of the next start of the minecraft server
+// (median of the most recent start durations) and the number of recorded starts.
+// If no start was recorded, the estimate is 0.
+func EstimateStart(server, kind string) (time.Duration, int) {
+	startsM.Lock()
+	defer startsM.Unlock()
+
+	durations := starts[server][kind]
+	if len(durations) == 0 {
+		return 0, 0
+	}
+
+	if len(durations) > estimateStarts {
+		durations = durations[len(durations)-estimateStarts:]
+	}
+	recent := append([]int64{}, durations...)
+	sort.Slice(recent, func(i, j int) bool { return recent[i] < recent[j] })
+
+	median := recent[len(recent)/2]
+	if len(recent)%2 == 0 {
+		median = (recent[len(recent)/2-1] + recent[len(recent)/2]) / 2
+	}
+
+	return time.Duration(median) * time.Millisecond, len(starts[server][kind])
+}
+
+// DescribeStarts returns a description of the start history of the minecraft server
+func DescribeStarts(server string) string {
+	desc := []string{}
+	for _, kind := range []string{START_COLD, START_RESUME} {
+		if est, n := EstimateStart(server, kind); n == 0 {
+			desc = append(desc, fmt.Sprintf("%s: none recorded", kind))
+		} else {
+			desc = append(desc, fmt.Sprintf("%s: ~%s (%d recorded)", kind, est.Round(100*time.Millisecond), n))
+		}
+	}
+	return strings.Join(desc, " | ")
+}
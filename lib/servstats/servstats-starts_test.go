@@ -0,0 +1,57 @@
+package servstats
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_EstimateStart(t *testing.T) {
+	startsFileName = filepath.Join(t.TempDir(), "msh-starts.json")
+	starts = map[string]map[string][]int64{}
+
+	if est, n := EstimateStart("survival", START_COLD); est != 0 || n != 0 {
+		t.Errorf("estimate without records: %s (%d recorded)", est, n)
+	}
+
+	// the estimate is the median of the most recent starts (an outlier start is ignored)
+	for _, d := range []time.Duration{5 * time.Minute, 40 * time.Second, 20 * time.Second, 30 * time.Second, 25 * time.Second, 3 * time.Minute} {
+		if logMsh := RecordStart("survival", START_COLD, d); logMsh != nil {
+			t.Fatalf(logMsh.Mex, logMsh.Arg...)
+		}
+	}
+	if est, n := EstimateStart("survival", START_COLD); est != 30*time.Second || n != 6 {
+		t.Errorf("cold start estimate: %s (%d recorded)", est, n)
+	}
+
+	// kinds of start and servers are estimated separately
+	RecordStart("survival", START_RESUME, 1*time.Second)
+	RecordStart("survival", START_RESUME, 2*time.Second)
+	if est, n := EstimateStart("survival", START_RESUME); est != 1500*time.Millisecond || n != 2 {
+		t.Errorf("resume estimate: %s (%d recorded)", est, n)
+	}
+	if _, n := EstimateStart("creative", START_COLD); n != 0 {
+		t.Errorf("creative has %d recorded starts", n)
+	}
+
+	// only the last keepStarts starts are kept
+	for i := 0; i < keepStarts; i++ {
+		RecordStart("creative", START_COLD, time.Minute)
+	}
+	RecordStart("creative", START_COLD, time.Minute)
+	if _, n := EstimateStart("creative", START_COLD); n != keepStarts {
+		t.Errorf("creative has %d recorded starts (expected %d)", n, keepStarts)
+	}
+
+	// starts are loaded from file and starts recorded before loading are kept as most recent
+	starts = map[string]map[string][]int64{"survival": {START_COLD: {int64(10 * time.Second / time.Millisecond)}}}
+	if logMsh := LoadStarts(); logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	if est, n := EstimateStart("survival", START_COLD); est != 25*time.Second || n != 7 {
+		t.Errorf("cold start estimate after load: %s (%d recorded)", est, n)
+	}
+	if _, n := EstimateStart("survival", START_RESUME); n != 2 {
+		t.Errorf("survival has %d recorded resumes after load", n)
+	}
+}
@@ -0,0 +1,356 @@
+package traffic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"msh/lib/errco"
+)
+
+const (
+	dayFormat    string        = "2006-01-02" // format of daily totals keys
+	keepDays     int           = 90           // days of daily totals kept in traffic file
+	keepClosed   int           = 20           // recently closed connections kept in memory
+	saveInterval time.Duration = time.Minute  // interval between traffic file saves
+)
+
+// trafficFileName is the file where daily totals are persisted
+var trafficFileName string = "msh-traffic.json"
+
+// Conn contains the traffic of a proxied connection
+type Conn struct {
+	Server   string       // name of the minecraft server
+	Client   string       // client address
+	Player   string       // player name (empty if unknown)
+	Start    time.Time    // time at which the connection was opened
+	End      time.Time    // time at which the connection was closed (zero if still open)
+	ToClient atomic.Int64 // bytes forwarded server -> client
+	ToServer atomic.Int64 // bytes forwarded client -> server
+
+	accToClient int64 // bytes server -> client already added to daily totals
+	accToServer int64 // bytes client -> server already added to daily totals
+}
+
+// Total contains the traffic of a player (or of a client address if player is unknown) in a day
+type Total struct {
+	Server   string    `json:"server"`
+	Player   string    `json:"player,omitempty"`
+	Client   string    `json:"client"` // last client address
+	Conns    int       `json:"conns"`
+	ToClient int64     `json:"to-client"`
+	ToServer int64     `json:"to-server"`
+	LastSeen time.Time `json:"last-seen,omitempty"` // time at which the last connection of the day was closed
+}
+
+// Seen contains the last time a player was seen on a minecraft server
+type Seen struct {
+	Player string
+	Time   time.Time
+	Online bool // player is connected now
+}
+
+var (
+	m      *sync.Mutex                  = &sync.Mutex{}
+	active []*Conn                      = []*Conn{}                      // open connections
+	closed []*Conn                      = []*Conn{}                      // recently closed connections (oldest first)
+	days   map[string]map[string]*Total = map[string]map[string]*Total{} // daily totals: day -> server/player -> total
+	dirty  bool                         = false                          // daily totals changed since last save
+)
+
+// Open starts tracking the traffic of a proxied connection.
+// clientAddr can be an address with or without port.
+func Open(server, clientAddr, player string) *Conn {
+	if host, _, err := net.SplitHostPort(clientAddr); err == nil {
+		clientAddr = host
+	}
+
+	c := &Conn{Server: server, Client: clientAddr, Player: player, Start: time.Now()}
+
+	m.Lock()
+	defer m.Unlock()
+
+	active = append(active, c)
+	total(c, c.Start).Conns++
+	dirty = true
+
+	return c
+}
+
+// Close stops tracking the connection and adds its remaining traffic to daily totals
+func (c *Conn) Close() {
+	m.Lock()
+	defer m.Unlock()
+
+	c.End = time.Now()
+	account(c, c.End)
+	total(c, c.End).LastSeen = c.End
+	dirty = true
+
+	for i, a := range active {
+		if a == c {
+			active = append(active[:i], active[i+1:]...)
+			break
+		}
+	}
+
+	closed = append(closed, c)
+	if len(closed) > keepClosed {
+		closed = closed[len(closed)-keepClosed:]
+	}
+}
+
+// Load loads daily totals from traffic file.
+// A missing traffic file is not an error.
+func Load() *errco.MshLog {
+	data, err := os.ReadFile(trafficFileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_TRAFFIC_LOAD, err.Error())
+	}
+
+	loaded := map[string]map[string]*Total{}
+	err = json.Unmarshal(data, &loaded)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_TRAFFIC_LOAD, "%s is not json formatted: %s", trafficFileName, err.Error())
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	// traffic accounted before loading is kept
+	for day, totals := range loaded {
+		if days[day] == nil {
+			days[day] = map[string]*Total{}
+		}
+		for key, t := range totals {
+			if cur, ok := days[day][key]; ok {
+				cur.Conns += t.Conns
+				cur.ToClient += t.ToClient
+				cur.ToServer += t.ToServer
+				if t.LastSeen.After(cur.LastSeen) {
+					cur.LastSeen = t.LastSeen
+				}
+			} else {
+				days[day][key] = t
+			}
+		}
+	}
+
+	return nil
+}
+
+// Save adds the traffic of open connections to daily totals and saves them to traffic file.
+// Daily totals older than keepDays are discarded.
+func Save() *errco.MshLog {
+	m.Lock()
+	defer m.Unlock()
+
+	now := time.Now()
+	for _, c := range active {
+		account(c, now)
+	}
+
+	if !dirty {
+		return nil
+	}
+
+	oldest := now.AddDate(0, 0, -keepDays).Format(dayFormat)
+	for day := range days {
+		if day < oldest {
+			delete(days, day)
+		}
+	}
+
+	data, err := json.MarshalIndent(days, "", "  ")
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_TRAFFIC_SAVE, err.Error())
+	}
+
+	err = os.WriteFile(trafficFileName, data, 0644)
+	if err != nil {
+		return errco.NewLog(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_TRAFFIC_SAVE, err.Error())
+	}
+
+	dirty = false
+
+	return nil
+}
+
+// SaveMgr saves daily totals to traffic file every saveInterval.
+// [goroutine]
+func SaveMgr() {
+	ticker := time.NewTicker(saveInterval)
+	for {
+		<-ticker.C
+
+		logMsh := Save()
+		if logMsh != nil {
+			logMsh.Log(true)
+		}
+	}
+}
+
+// Report returns a description of open connections, recently closed connections and daily totals of the last n days.
+// If server is not empty, only the traffic of the specified minecraft server is reported.
+func Report(server string, n int) []string {
+	m.Lock()
+	defer m.Unlock()
+
+	now := time.Now()
+	lines := []string{}
+
+	lines = append(lines, "open connections:")
+	for _, c := range active {
+		if server == "" || c.Server == server {
+			lines = append(lines, "  "+c.describe(now))
+		}
+	}
+
+	lines = append(lines, "recently closed connections:")
+	for _, c := range closed {
+		if server == "" || c.Server == server {
+			lines = append(lines, "  "+c.describe(now))
+		}
+	}
+
+	// open connections traffic is included in daily totals
+	for _, c := range active {
+		account(c, now)
+	}
+
+	lines = append(lines, fmt.Sprintf("daily totals (last %d days):", n))
+	for i := n - 1; i >= 0; i-- {
+		day := now.AddDate(0, 0, -i).Format(dayFormat)
+
+		keys := []string{}
+		for key, t := range days[day] {
+			if server == "" || t.Server == server {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			t := days[day][key]
+			lines = append(lines, fmt.Sprintf("  %s  %-16s %-16s %-39s %4d conn  %10s to client | %10s to server", day, t.Server, t.Player, t.Client, t.Conns, formatBytes(t.ToClient), formatBytes(t.ToServer)))
+		}
+	}
+
+	return lines
+}
+
+// LastSeen returns the n players seen most recently on the minecraft server (most recent first).
+// Players connected now come first. Only connections with a known player name are considered.
+func LastSeen(server string, n int) []Seen {
+	m.Lock()
+	defer m.Unlock()
+
+	now := time.Now()
+	seen := map[string]*Seen{}
+
+	for _, totals := range days {
+		for _, t := range totals {
+			if t.Server != server || t.Player == "" || t.LastSeen.IsZero() {
+				continue
+			}
+			if s, ok := seen[t.Player]; !ok || t.LastSeen.After(s.Time) {
+				seen[t.Player] = &Seen{Player: t.Player, Time: t.LastSeen}
+			}
+		}
+	}
+
+	for _, c := range active {
+		if c.Server == server && c.Player != "" {
+			seen[c.Player] = &Seen{Player: c.Player, Time: now, Online: true}
+		}
+	}
+
+	list := []Seen{}
+	for _, s := range seen {
+		list = append(list, *s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Time.Equal(list[j].Time) {
+			return list[i].Player < list[j].Player
+		}
+		return list[i].Time.After(list[j].Time)
+	})
+
+	if len(list) > n {
+		list = list[:n]
+	}
+
+	return list
+}
+
+// describe returns a description of the connection traffic at the specified time
+func (c *Conn) describe(now time.Time) string {
+	end := now
+	if !c.End.IsZero() {
+		end = c.End
+	}
+
+	return fmt.Sprintf("%-16s %-16s %-39s %s (%s)  %10s to client | %10s to server", c.Server, c.Player, c.Client, c.Start.Format("2006-01-02 15:04:05"), end.Sub(c.Start).Round(time.Second), formatBytes(c.ToClient.Load()), formatBytes(c.ToServer.Load()))
+}
+
+// formatBytes returns a human readable representation of an amount of bytes
+func formatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+// account adds the traffic of a connection not yet accounted to the daily total of the specified time.
+// m must be locked by the caller.
+func account(c *Conn, t time.Time) {
+	toClient, toServer := c.ToClient.Load(), c.ToServer.Load()
+	if toClient == c.accToClient && toServer == c.accToServer {
+		return
+	}
+
+	tot := total(c, t)
+	tot.ToClient += toClient - c.accToClient
+	tot.ToServer += toServer - c.accToServer
+	c.accToClient, c.accToServer = toClient, toServer
+	dirty = true
+}
+
+// total returns the daily total of the connection player (or client address) for the specified time.
+// m must be locked by the caller.
+func total(c *Conn, t time.Time) *Total {
+	day := t.Format(dayFormat)
+	if days[day] == nil {
+		days[day] = map[string]*Total{}
+	}
+
+	key := c.Server + "/" + c.Client
+	if c.Player != "" {
+		key = c.Server + "/" + c.Player
+	}
+
+	tot, ok := days[day][key]
+	if !ok {
+		tot = &Total{Server: c.Server, Player: c.Player}
+		days[day][key] = tot
+	}
+	tot.Client = c.Client
+
+	return tot
+}
@@ -0,0 +1,104 @@
+package traffic
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_accounting(t *testing.T) {
+	trafficFileName = filepath.Join(t.TempDir(), "msh-traffic.json")
+	days = map[string]map[string]*Total{}
+	today := time.Now().Format(dayFormat)
+
+	// player connection
+	c := Open("survival", "192.168.1.2:56324", "gekigek99")
+	c.ToClient.Add(1000)
+	c.ToServer.Add(100)
+
+	// traffic of open connections is accounted when saving
+	if logMsh := Save(); logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	if tot := days[today]["survival/gekigek99"]; tot.ToClient != 1000 || tot.ToServer != 100 {
+		t.Errorf("open connection accounted as %+v", tot)
+	}
+
+	// remaining traffic is accounted when closing (without double counting)
+	c.ToClient.Add(24)
+	c.Close()
+	if tot := days[today]["survival/gekigek99"]; tot.ToClient != 1024 || tot.ToServer != 100 || tot.Conns != 1 || tot.Client != "192.168.1.2" {
+		t.Errorf("closed connection accounted as %+v", tot)
+	}
+
+	// connection of unknown player is accounted by client address
+	c = Open("survival", "192.168.1.3:56325", "")
+	c.ToClient.Add(10)
+	c.Close()
+	if tot := days[today]["survival/192.168.1.3"]; tot == nil || tot.ToClient != 10 {
+		t.Errorf("unknown player connection accounted as %+v", tot)
+	}
+
+	// daily totals are persisted
+	if logMsh := Save(); logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	days = map[string]map[string]*Total{}
+	if logMsh := Load(); logMsh != nil {
+		t.Fatalf(logMsh.Mex, logMsh.Arg...)
+	}
+	if tot := days[today]["survival/gekigek99"]; tot == nil || tot.ToClient != 1024 || tot.ToServer != 100 || tot.Conns != 1 {
+		t.Errorf("daily total loaded as %+v", tot)
+	}
+
+	// report filters by server
+	report := strings.Join(Report("survival", 1), "\n")
+	if !strings.Contains(report, "gekigek99") || !strings.Contains(report, "1.0 KiB") {
+		t.Errorf("unexpected report:\n%s", report)
+	}
+	if report := strings.Join(Report("creative", 1), "\n"); strings.Contains(report, "gekigek99") {
+		t.Errorf("report of another server contains player:\n%s", report)
+	}
+}
+
+func Test_LastSeen(t *testing.T) {
+	days = map[string]map[string]*Total{}
+	active, closed = []*Conn{}, []*Conn{}
+
+	yesterday := time.Now().AddDate(0, 0, -1)
+	days[yesterday.Format(dayFormat)] = map[string]*Total{
+		"survival/alice": {Server: "survival", Player: "alice", LastSeen: yesterday},
+		"creative/carol": {Server: "creative", Player: "carol", LastSeen: time.Now()},
+	}
+
+	Open("survival", "192.168.1.2:56324", "bob").Close()
+	Open("survival", "192.168.1.3:56325", "").Close()
+	online := Open("survival", "192.168.1.4:56326", "dave")
+	defer online.Close()
+
+	seen := LastSeen("survival", 5)
+	if len(seen) != 3 || seen[0].Player != "dave" || !seen[0].Online || seen[1].Player != "bob" || seen[2].Player != "alice" {
+		t.Errorf("unexpected last seen players: %+v", seen)
+	}
+	if seen := LastSeen("survival", 1); len(seen) != 1 {
+		t.Errorf("last seen players not limited: %+v", seen)
+	}
+}
+
+func Test_formatBytes(t *testing.T) {
+	tests := map[int64]string{
+		0:               "0 B",
+		1023:            "1023 B",
+		1024:            "1.0 KiB",
+		1536:            "1.5 KiB",
+		5 * 1024 * 1024: "5.0 MiB",
+		3 << 40:         "3.0 TiB",
+	}
+
+	for b, expect := range tests {
+		if s := formatBytes(b); s != expect {
+			t.Errorf("%d bytes formatted as %q (expected %q)", b, s, expect)
+		}
+	}
+}
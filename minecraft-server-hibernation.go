@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"net"
+	"strconv"
 
 	"msh/lib/config"
 	"msh/lib/conn"
@@ -10,6 +11,8 @@ import (
 	"msh/lib/input"
 	"msh/lib/progmgr"
 	"msh/lib/servctrl"
+	"msh/lib/servstats"
+	"msh/lib/traffic"
 	"msh/lib/utility"
 )
 
@@ -36,17 +39,35 @@ func main() {
 		progmgr.AutoTerminate()
 	}
 
+	// load minecraft servers from config
+	servctrl.LoadServers()
+
+	// load traffic daily totals and save them periodically
+	logMsh = traffic.Load()
+	if logMsh != nil {
+		logMsh.Log(true)
+	}
+	go traffic.SaveMgr()
+
+	// load start durations to estimate startup time
+	logMsh = servstats.LoadStarts()
+	if logMsh != nil {
+		logMsh.Log(true)
+	}
+
 	// launch msh manager
 	go progmgr.MshMgr()
 	// wait for the initial update check
 	<-progmgr.ReqSent
 
 	// if ms suspension is allowed, pre-warm the server
-	if config.ConfigRuntime.Msh.SuspendAllow {
-		errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "minecraft server will now pre-warm (SuspendAllow is enabled)...")
-		logMsh = servctrl.WarmMS()
-		if logMsh != nil {
-			logMsh.Log(true)
+	for _, ms := range servctrl.Servers {
+		if ms.Config.Msh.SuspendAllow {
+			errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "minecraft server %s will now pre-warm (SuspendAllow is enabled)...", ms.Config.Name)
+			logMsh = ms.WarmMS()
+			if logMsh != nil {
+				logMsh.Log(true)
+			}
 		}
 	}
 
@@ -55,20 +76,67 @@ func main() {
 
 	// ---------------- connections ---------------- //
 
-	// launch query handler
-	if config.ConfigRuntime.Msh.EnableQuery {
-		go conn.HandlerQuery()
+	// launch query handlers
+	// (one for each msh query port, servers sharing a query port are answered by the first one)
+	queryPorts := map[int]bool{}
+	for _, ms := range servctrl.Servers {
+		if !ms.Config.Msh.EnableQuery || queryPorts[ms.Config.Msh.MshPortQuery] {
+			continue
+		}
+		queryPorts[ms.Config.Msh.MshPortQuery] = true
+		go conn.HandlerQuery(ms)
 	}
 
-	// open a tcp listener
-	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", config.MshHost, config.MshPort))
-	if err != nil {
-		errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CLIENT_LISTEN, err.Error())
-		progmgr.AutoTerminate()
+	// launch bedrock handlers
+	// (one for each msh bedrock port, servers sharing a bedrock port are handled by the first one)
+	bedrockPorts := map[int]bool{}
+	for _, ms := range servctrl.Servers {
+		if ms.Config.Msh.MshPortBedrock == 0 || bedrockPorts[ms.Config.Msh.MshPortBedrock] {
+			continue
+		}
+		bedrockPorts[ms.Config.Msh.MshPortBedrock] = true
+		go conn.HandlerBedrock(ms)
 	}
 
+	// launch rcon handlers
+	// (one for each msh rcon port, servers sharing an rcon port are handled by the first one)
+	rconPorts := map[int]bool{}
+	for _, ms := range servctrl.Servers {
+		if ms.Config.Msh.MshPortRcon == 0 || rconPorts[ms.Config.Msh.MshPortRcon] {
+			continue
+		}
+		rconPorts[ms.Config.Msh.MshPortRcon] = true
+		go conn.HandlerRcon(ms)
+	}
+
+	// open a tcp listener for each msh port
+	// (servers sharing a msh port are routed by hostname)
+	mshPorts := map[int]bool{}
+	for _, ms := range servctrl.Servers {
+		if mshPorts[ms.Config.Msh.MshPort] {
+			continue
+		}
+		mshPorts[ms.Config.Msh.MshPort] = true
+
+		listener, err := net.Listen("tcp", net.JoinHostPort(config.MshHost, strconv.Itoa(ms.Config.Msh.MshPort)))
+		if err != nil {
+			errco.NewLogln(errco.TYPE_ERR, errco.LVL_3, errco.ERROR_CLIENT_LISTEN, err.Error())
+			progmgr.AutoTerminate()
+			continue
+		}
+
+		go handlerListener(listener, ms.Config.Msh.MshPort)
+	}
+
+	// wait for msh termination
+	select {}
+}
+
+// handlerListener handles new clients connecting on the specified msh port.
+// [goroutine]
+func handlerListener(listener net.Listener, mshPort int) {
 	// infinite cycle to handle new clients.
-	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "%-40s %10s:%5d ...", "listening for new clients connections on", config.MshHost, config.MshPort)
+	errco.NewLogln(errco.TYPE_INF, errco.LVL_1, errco.ERROR_NIL, "%-40s %10s:%5d ...", "listening for new clients connections on", config.MshHost, mshPort)
 	for {
 		clientConn, err := listener.Accept()
 		if err != nil {
@@ -76,6 +144,22 @@ func main() {
 			continue
 		}
 
-		go conn.HandlerClientConn(clientConn)
+		// close the connection of banned clients without answering
+		logMsh := conn.CheckBan(clientConn.RemoteAddr())
+		if logMsh != nil {
+			logMsh.Log(true)
+			clientConn.Close()
+			continue
+		}
+
+		// refuse the client if msh is handling too many connections
+		logMsh = conn.Admit()
+		if logMsh != nil {
+			logMsh.Log(true)
+			conn.RejectClient(clientConn, mshPort, logMsh)
+			continue
+		}
+
+		go conn.HandlerClientConn(clientConn, mshPort)
 	}
 }